@@ -0,0 +1,57 @@
+package hystrix
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	aliasesMutex = &sync.RWMutex{}
+	// aliases maps each alias to the name of the command it stands for, which is never itself an alias.
+	aliases = make(map[string]string)
+)
+
+// Alias makes oldName another name for the command newName, for instance while callers migrate to a
+// renamed command. Executions, configuration and metrics lookups under either name share the circuit,
+// settings and metrics of newName, which is the name the circuit reports to dashboards and collectors.
+//
+// If newName is itself an alias, oldName becomes an alias of the command it stands for, as do any aliases
+// of oldName. An error is returned if oldName already has a circuit of its own, since its state could
+// not then be shared, or if the alias would make a command an alias of itself.
+func Alias(oldName, newName string) error {
+	aliasesMutex.Lock()
+	defer aliasesMutex.Unlock()
+
+	target := newName
+	if name, ok := aliases[newName]; ok {
+		target = name
+	}
+	if target == oldName {
+		return fmt.Errorf("hystrix: cannot alias %q to itself", oldName)
+	}
+	circuitBreakersMutex.RLock()
+	_, exists := circuitBreakers[oldName]
+	circuitBreakersMutex.RUnlock()
+	if exists {
+		return fmt.Errorf("hystrix: cannot alias %q, which already has a circuit", oldName)
+	}
+
+	aliases[oldName] = target
+	for alias, name := range aliases {
+		if name == oldName {
+			aliases[alias] = target
+		}
+	}
+	return nil
+}
+
+// resolveAlias returns the name of the command that name stands for, which is name if it isn't an alias.
+func resolveAlias(name string) string {
+	aliasesMutex.RLock()
+	defer aliasesMutex.RUnlock()
+
+	if target, ok := aliases[name]; ok {
+		return target
+	}
+	return name
+}
@@ -0,0 +1,53 @@
+package hystrix
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAlias(t *testing.T) {
+	Convey("given an old command name aliased to a new one", t, func() {
+		defer Flush()
+
+		So(Alias("alias.old", "alias.new"), ShouldBeNil)
+
+		Convey("both names share one circuit and its metrics", func() {
+			Do("alias.old", func() error { return fmt.Errorf("boom") }, nil)
+			Do("alias.new", func() error { return nil }, nil)
+
+			oldCircuit, _, _ := GetCircuit("alias.old")
+			newCircuit, _, _ := GetCircuit("alias.new")
+			So(oldCircuit, ShouldEqual, newCircuit)
+			So(oldCircuit.Name, ShouldEqual, "alias.new")
+			So(CircuitNames(), ShouldResemble, []string{"alias.new"})
+
+			snapshot, err := Metrics("alias.old")
+			So(err, ShouldBeNil)
+			So(snapshot.Attempts, ShouldEqual, 2)
+			So(snapshot.Failures, ShouldEqual, 1)
+		})
+
+		Convey("configuring the old name configures the new one", func() {
+			So(ConfigureCommand("alias.old", CommandConfig{Timeout: 1234}), ShouldBeNil)
+			So(GetConfig("alias.new").Timeout, ShouldEqual, 1234)
+			So(IsConfigured("alias.new"), ShouldBeTrue)
+		})
+
+		Convey("an alias of the old name stands for the new one", func() {
+			So(Alias("alias.older", "alias.old"), ShouldBeNil)
+			So(resolveAlias("alias.older"), ShouldEqual, "alias.new")
+		})
+
+		Convey("a name cannot be aliased to itself", func() {
+			So(Alias("alias.new", "alias.old"), ShouldNotBeNil)
+		})
+
+		Convey("a name which already has a circuit cannot be aliased", func() {
+			Do("alias.existing", func() error { return nil }, nil)
+			So(Alias("alias.existing", "alias.new"), ShouldNotBeNil)
+			So(resolveAlias("alias.existing"), ShouldEqual, "alias.existing")
+		})
+	})
+}
@@ -0,0 +1,48 @@
+package hystrix
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Budget is a total amount of time shared by the commands executed with a context returned by
+// WithBudget. Each command consumes the time it took, and its timeout is capped by what remains.
+type Budget struct {
+	mutex     sync.Mutex
+	remaining time.Duration
+}
+
+type budgetKey struct{}
+
+// WithBudget returns a copy of ctx carrying a Budget of d. Commands executed with it through GoC, DoC
+// and the other context-aware functions share the budget: once it is spent, they fail with ErrTimeout
+// without running. It is meant for commands run one after another, as commands running at the same
+// time each consume their own duration. A budget replaces any budget already carried by ctx.
+func WithBudget(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, budgetKey{}, &Budget{remaining: d})
+}
+
+// BudgetFrom returns the Budget carried by ctx, if any.
+func BudgetFrom(ctx context.Context) (*Budget, bool) {
+	b, ok := ctx.Value(budgetKey{}).(*Budget)
+	return b, ok
+}
+
+// Remaining returns how much of the budget has not been consumed yet. It is never negative.
+func (b *Budget) Remaining() time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.remaining < 0 {
+		return 0
+	}
+	return b.remaining
+}
+
+func (b *Budget) consume(d time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.remaining -= d
+}
@@ -0,0 +1,59 @@
+package hystrix
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBudget(t *testing.T) {
+	Convey("with a request budget of 100 milliseconds", t, func() {
+		defer Flush()
+
+		ctx := WithBudget(context.Background(), 100*time.Millisecond)
+		sleep := func(d time.Duration) func(context.Context) error {
+			return func(ctx context.Context) error {
+				time.Sleep(d)
+				return nil
+			}
+		}
+
+		Convey("a call which takes 60 milliseconds consumes it", func() {
+			So(DoC(ctx, "budget", sleep(60*time.Millisecond), nil), ShouldBeNil)
+
+			budget, ok := BudgetFrom(ctx)
+			So(ok, ShouldBeTrue)
+			So(budget.Remaining(), ShouldBeBetween, 0, 40*time.Millisecond)
+
+			Convey("the next call times out once the rest is spent", func() {
+				start := time.Now()
+				So(errors.Is(DoC(ctx, "budget", sleep(200*time.Millisecond), nil), ErrTimeout), ShouldBeTrue)
+				So(time.Since(start), ShouldBeLessThan, 100*time.Millisecond)
+				So(budget.Remaining(), ShouldEqual, 0)
+
+				Convey("and later calls fail without running", func() {
+					ran := false
+					var fallbackErr error
+					err := DoC(ctx, "budget", func(ctx context.Context) error {
+						ran = true
+						return nil
+					}, func(ctx context.Context, err error) error {
+						fallbackErr = err
+						return nil
+					})
+					So(err, ShouldBeNil)
+					So(errors.Is(fallbackErr, ErrTimeout), ShouldBeTrue)
+					So(ran, ShouldBeFalse)
+				})
+			})
+		})
+
+		Convey("a context without a budget has none", func() {
+			_, ok := BudgetFrom(context.Background())
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
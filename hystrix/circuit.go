@@ -2,6 +2,9 @@ package hystrix
 
 import (
 	"fmt"
+	"math"
+	"math/rand"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -10,58 +13,262 @@ import (
 // CircuitBreaker is created for each ExecutorPool to track whether requests
 // should be attempted, or rejected if the Health of the circuit is too low.
 type CircuitBreaker struct {
-	Name                   string
-	open                   bool
-	forceOpen              bool
-	mutex                  *sync.RWMutex
-	openedOrLastTestedTime int64
+	Name                string
+	forceOpen           bool
+	forceClosed         bool
+	mutex               *sync.RWMutex
+	stateChangeHandlers []func(from, to CircuitState)
+	// store holds whether the circuit is open and when its sleep window started.
+	store StateStore
+	// sleepJitter, between -1 and 1, scales SleepWindowJitter for the current sleep window. It is
+	// drawn each time the sleep window starts.
+	sleepJitter float64
+	// sleepMultiplier scales SleepWindow for the current sleep window. It grows by SleepWindowMultiplier
+	// each time a test request fails, and returns to 1 when the circuit opens or closes.
+	sleepMultiplier float64
+	// forcedFallbackPercent is the percentage of executions sent straight to the fallback by ForceFallback.
+	forcedFallbackPercent int32
+	// blocked is 1 while BlockCommand turns away every execution.
+	blocked int32
+	// activeFallbacks counts the fallbacks running, so that MaxConcurrentFallbacks can be enforced.
+	activeFallbacks int32
+	// halfOpenProbes counts the test requests running while the circuit is half-open, and
+	// halfOpenSuccesses those which have succeeded in a row since the circuit opened or a test last failed.
+	halfOpenProbes    int
+	halfOpenSuccesses int
+	// openCause is what opened the circuit, such as causeErrors, for Health to report. It is empty while
+	// the circuit is closed, or when it was opened through a shared StateStore.
+	openCause string
 
 	executorPool *executorPool
 	metrics      *metricExchange
 }
 
+// CircuitState describes whether a circuit is currently allowing executions.
+type CircuitState int
+
+const (
+	// CircuitClosed allows all executions.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen short-circuits executions because the circuit was measured as unhealthy.
+	CircuitOpen
+	// CircuitHalfOpen is an open circuit whose sleep window has elapsed, so the next execution
+	// will be allowed as a test of whether it should close.
+	CircuitHalfOpen
+	// CircuitForcedOpen short-circuits all executions until ClearForced is called.
+	CircuitForcedOpen
+	// CircuitForcedClosed allows all executions until ClearForced is called.
+	CircuitForcedClosed
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitForcedOpen:
+		return "forced-open"
+	case CircuitForcedClosed:
+		return "forced-closed"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
 var (
 	circuitBreakersMutex *sync.RWMutex
 	circuitBreakers      map[string]*CircuitBreaker
+	// executorPools holds the pools shared by commands with a PoolName, keyed by that name.
+	// It is guarded by circuitBreakersMutex.
+	executorPools map[string]*executorPool
 )
 
 func init() {
 	circuitBreakersMutex = &sync.RWMutex{}
 	circuitBreakers = make(map[string]*CircuitBreaker)
+	executorPools = make(map[string]*executorPool)
 }
 
-// GetCircuit returns the circuit for the given command and whether this call created it.
-func GetCircuit(name string) (*CircuitBreaker, bool, error) {
+// ErrUnknownCircuit is returned when querying a circuit which has not been created yet.
+var ErrUnknownCircuit = CircuitError{Message: "unknown circuit"}
+
+// lookupCircuit returns the circuit for the given command, without creating it.
+func lookupCircuit(name string) (*CircuitBreaker, error) {
+	name = resolveAlias(name)
 	circuitBreakersMutex.RLock()
-	_, ok := circuitBreakers[name]
+	defer circuitBreakersMutex.RUnlock()
+
+	cb, ok := circuitBreakers[name]
 	if !ok {
-		circuitBreakersMutex.RUnlock()
-		circuitBreakersMutex.Lock()
-		defer circuitBreakersMutex.Unlock()
-		// because we released the rlock before we obtained the exclusive lock,
-		// we need to double check that some other thread didn't beat us to
-		// creation.
-		if cb, ok := circuitBreakers[name]; ok {
-			return cb, false, nil
+		return nil, ErrUnknownCircuit
+	}
+	return cb, nil
+}
+
+// CircuitNames returns the names of every command which has a circuit, in sorted order. The slice is
+// a copy, which the caller may modify.
+func CircuitNames() []string {
+	circuitBreakersMutex.RLock()
+	names := make([]string, 0, len(circuitBreakers))
+	for name := range circuitBreakers {
+		names = append(names, name)
+	}
+	circuitBreakersMutex.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// circuitsWhere returns the circuits whose name include accepts, or every circuit if include is nil.
+// They are copied out of the registry, so that callers can inspect them without holding its lock:
+// reading a circuit may open it and run state change handlers, which may create circuits of their own.
+func circuitsWhere(include func(name string) bool) []*CircuitBreaker {
+	circuitBreakersMutex.RLock()
+	defer circuitBreakersMutex.RUnlock()
+
+	circuits := make([]*CircuitBreaker, 0, len(circuitBreakers))
+	for name, cb := range circuitBreakers {
+		if include == nil || include(name) {
+			circuits = append(circuits, cb)
 		}
-		circuitBreakers[name] = newCircuitBreaker(name)
-	} else {
-		defer circuitBreakersMutex.RUnlock()
 	}
+	return circuits
+}
 
-	return circuitBreakers[name], !ok, nil
+// GetCircuit returns the circuit for the given command and whether this call created it. However many
+// goroutines ask for a new command at once, exactly one circuit, with one set of metrics goroutines, is
+// created for it.
+func GetCircuit(name string) (*CircuitBreaker, bool, error) {
+	name = resolveAlias(name)
+	circuitBreakersMutex.RLock()
+	cb, ok := circuitBreakers[name]
+	circuitBreakersMutex.RUnlock()
+	if ok {
+		return cb, false, nil
+	}
+
+	circuitBreakersMutex.Lock()
+	defer circuitBreakersMutex.Unlock()
+	// because we released the rlock before we obtained the exclusive lock,
+	// we need to double check that some other thread didn't beat us to
+	// creation. The circuit, and the goroutines collecting its metrics, are
+	// only created while holding the exclusive lock, so none is ever discarded.
+	if cb, ok := circuitBreakers[name]; ok {
+		return cb, false, nil
+	}
+	cb = newCircuitBreaker(name)
+	circuitBreakers[name] = cb
+	return cb, true, nil
+}
+
+// Warmup creates the circuits of the named commands, along with their executor pools and the goroutines
+// collecting their metrics, so that the first execution of each doesn't pay for it. Circuits which
+// already exist are left alone, so it is safe to call more than once. Configure commands first, as
+// the pool of a circuit is sized when it is created.
+func Warmup(names ...string) error {
+	for _, name := range names {
+		if _, _, err := GetCircuit(name); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// Flush purges all circuit and metric information from memory.
+// Flush purges all circuit and metric information from memory, stopping the goroutines which collect
+// metrics for each circuit. After Shutdown, it lets commands run again.
 func Flush() {
 	circuitBreakersMutex.Lock()
 	defer circuitBreakersMutex.Unlock()
 
+	atomic.StoreInt32(&shuttingDown, 0)
+
 	for name, cb := range circuitBreakers {
 		cb.metrics.Reset()
 		cb.executorPool.Metrics.Reset()
+		cb.stopMetrics()
 		delete(circuitBreakers, name)
 	}
+	for poolName := range executorPools {
+		delete(executorPools, poolName)
+	}
+}
+
+// stopMetrics ends the goroutines collecting metrics for the circuit and its executor pool.
+func (circuit *CircuitBreaker) stopMetrics() {
+	circuit.metrics.Stop()
+	circuit.executorPool.Metrics.Stop()
+}
+
+// ForceOpen holds the named circuit open, short-circuiting all executions until ClearForced is called.
+func ForceOpen(name string) error {
+	circuit, _, err := GetCircuit(name)
+	if err != nil {
+		return err
+	}
+
+	circuit.setForced(true, false)
+	return nil
+}
+
+// ForceClose holds the named circuit closed, allowing all executions regardless of health
+// until ClearForced is called.
+func ForceClose(name string) error {
+	circuit, _, err := GetCircuit(name)
+	if err != nil {
+		return err
+	}
+
+	circuit.setForced(false, true)
+	return nil
+}
+
+// ClearForced returns the named circuit to opening and closing automatically based on its health.
+func ClearForced(name string) error {
+	circuit, _, err := GetCircuit(name)
+	if err != nil {
+		return err
+	}
+
+	circuit.setForced(false, false)
+	return nil
+}
+
+// IsCircuitOpen reports whether the named circuit is currently open, including when it is forced open.
+func IsCircuitOpen(name string) (bool, error) {
+	state, err := GetCircuitState(name)
+	if err != nil {
+		return false, err
+	}
+
+	return state == CircuitOpen || state == CircuitHalfOpen || state == CircuitForcedOpen, nil
+}
+
+// GetCircuitState returns the current state of the named circuit.
+func GetCircuitState(name string) (CircuitState, error) {
+	circuit, _, err := GetCircuit(name)
+	if err != nil {
+		return CircuitClosed, err
+	}
+
+	return circuit.State(), nil
+}
+
+// OnStateChange registers fn to be called each time the named circuit changes state.
+// fn is called synchronously by the goroutine which changed the state, for instance one executing a
+// command or reading the circuit's metrics, so it should return quickly. No lock of hystrix is held
+// while it runs, so it is safe for it to call back into hystrix, even to execute other commands.
+func OnStateChange(name string, fn func(from, to CircuitState)) error {
+	circuit, _, err := GetCircuit(name)
+	if err != nil {
+		return err
+	}
+
+	circuit.mutex.Lock()
+	circuit.stateChangeHandlers = append(circuit.stateChangeHandlers, fn)
+	circuit.mutex.Unlock()
+	return nil
 }
 
 // newCircuitBreaker creates a CircuitBreaker with associated Health
@@ -69,12 +276,84 @@ func newCircuitBreaker(name string) *CircuitBreaker {
 	c := &CircuitBreaker{}
 	c.Name = name
 	c.metrics = newMetricExchange(name)
-	c.executorPool = newExecutorPool(name)
+	c.executorPool = executorPoolFor(name)
 	c.mutex = &sync.RWMutex{}
+	c.store = stateStoreFor()
 
 	return c
 }
 
+// executorPoolFor returns the pool the named command takes its tickets from. Commands with a PoolName
+// share the pool of that name, which is created by the first of them. circuitBreakersMutex must be held.
+func executorPoolFor(name string) *executorPool {
+	poolName := getSettings(name).PoolName
+	if poolName == "" {
+		return newExecutorPool(name)
+	}
+
+	if pool, ok := executorPools[poolName]; ok {
+		return pool
+	}
+	pool := newExecutorPoolWithSize(poolName, getSettings(name).MaxConcurrentRequests)
+	pool.shared = true
+	executorPools[poolName] = pool
+	return pool
+}
+
+// ForceFallback routes percent of the executions of the named command which the circuit allows
+// straight to their fallback, without running them, so that fallbacks can be exercised while the
+// backend is healthy. The fallback receives ErrForcedFallback. These executions are recorded as
+// failures, so a high enough percent will open the circuit. A percent of 0 stops forcing fallbacks.
+func ForceFallback(name string, percent int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("hystrix: forced fallback percent %d for %q must be between 0 and 100", percent, name)
+	}
+
+	circuit, _, err := GetCircuit(name)
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&circuit.forcedFallbackPercent, int32(percent))
+	return nil
+}
+
+// BlockCommand turns away every execution of the named command with ErrCommandBlocked, for instance
+// while a deploy drains the process, until UnblockCommand is called. Unlike ForceOpen, the circuit
+// itself is left alone: blocked executions are recorded as blocked rather than short-circuited, don't
+// count as attempts, and so don't change the health the circuit is judged on once it is unblocked.
+func BlockCommand(name string) error {
+	circuit, _, err := GetCircuit(name)
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&circuit.blocked, 1)
+	return nil
+}
+
+// UnblockCommand lets the executions of a command blocked by BlockCommand run again.
+func UnblockCommand(name string) error {
+	circuit, _, err := GetCircuit(name)
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&circuit.blocked, 0)
+	return nil
+}
+
+// isBlocked reports whether BlockCommand is turning away the executions of the circuit.
+func (circuit *CircuitBreaker) isBlocked() bool {
+	return atomic.LoadInt32(&circuit.blocked) == 1
+}
+
+// forceFallback reports whether an execution should be routed to its fallback by ForceFallback.
+func (circuit *CircuitBreaker) forceFallback() bool {
+	percent := atomic.LoadInt32(&circuit.forcedFallbackPercent)
+	return percent > 0 && rand.Int31n(100) < percent
+}
+
 // toggleForceOpen allows manually causing the fallback logic for all instances
 // of a given command.
 func (circuit *CircuitBreaker) toggleForceOpen(toggle bool) error {
@@ -83,110 +362,566 @@ func (circuit *CircuitBreaker) toggleForceOpen(toggle bool) error {
 		return err
 	}
 
+	circuit.mutex.Lock()
+	from := circuit.stateLocked()
 	circuit.forceOpen = toggle
+	to := circuit.stateLocked()
+	handlers := circuit.stateChangeHandlers
+	circuit.mutex.Unlock()
+
+	notifyStateChange(handlers, from, to)
 	return nil
 }
 
+func (circuit *CircuitBreaker) setForced(open, closed bool) {
+	circuit.mutex.Lock()
+	from := circuit.stateLocked()
+	circuit.forceOpen = open
+	circuit.forceClosed = closed
+	to := circuit.stateLocked()
+	handlers := circuit.stateChangeHandlers
+	circuit.mutex.Unlock()
+
+	notifyStateChange(handlers, from, to)
+}
+
+// notifyStateChange calls each handler if the state actually changed. It must be called
+// without holding the circuit's mutex.
+func notifyStateChange(handlers []func(from, to CircuitState), from, to CircuitState) {
+	if from == to {
+		return
+	}
+
+	for _, handler := range handlers {
+		handler(from, to)
+	}
+}
+
 // IsOpen is called before any Command execution to check whether or
 // not it should be attempted. An "open" circuit means it is disabled.
 func (circuit *CircuitBreaker) IsOpen() bool {
+	settings := getSettings(circuit.Name)
+
 	circuit.mutex.RLock()
-	o := circuit.forceOpen || circuit.open
+	forceOpen := circuit.forceOpen
+	forceClosed := circuit.forceClosed
+	o := circuit.storedStateLocked().Open
 	circuit.mutex.RUnlock()
 
-	if o {
+	if forceOpen {
 		return true
 	}
 
-	if uint64(circuit.metrics.Requests().Sum(time.Now())) < getSettings(circuit.Name).RequestVolumeThreshold {
+	if forceClosed {
+		return false
+	}
+
+	if settings.MonitorOnly {
+		// the circuit is observed but never trips
 		return false
 	}
 
-	if !circuit.metrics.IsHealthy(time.Now()) {
-		// too many failures, open the circuit
-		circuit.setOpen()
+	if o {
+		return true
+	}
+
+	if cause := circuit.tripCause(settings); cause != "" {
+		circuit.setOpen(cause)
 		return true
 	}
 
 	return false
 }
 
+// The causes a circuit records when it opens, as reported by Health.
+const (
+	causeErrors              = "errors"
+	causeLatency             = "latency"
+	causeConsecutiveFailures = "consecutive failures"
+)
+
+// shouldOpen reports whether the recent executions of a closed circuit are bad enough to open it.
+func (circuit *CircuitBreaker) shouldOpen(settings *Settings) bool {
+	return circuit.tripCause(settings) != ""
+}
+
+// tripCause returns why the recent executions of a closed circuit are bad enough to open it, or "" if
+// they are not.
+func (circuit *CircuitBreaker) tripCause(settings *Settings) string {
+	// consecutive failures open the circuit regardless of the volume of requests
+	if circuit.metrics.tooManyConsecutiveFailures(settings) {
+		return causeConsecutiveFailures
+	}
+
+	now := time.Now()
+	if uint64(circuit.metrics.Requests().Sum(now)) < settings.volumeThreshold() {
+		return ""
+	}
+
+	if circuit.metrics.tooSlow(settings) {
+		return causeLatency
+	}
+	if circuit.metrics.ErrorPercent(now) >= settings.ErrorPercentThreshold {
+		return causeErrors
+	}
+	return ""
+}
+
+// State returns the current state of the circuit. Unlike IsOpen, it does not evaluate the
+// health of the circuit and never changes its state.
+func (circuit *CircuitBreaker) State() CircuitState {
+	circuit.mutex.RLock()
+	defer circuit.mutex.RUnlock()
+
+	return circuit.stateLocked()
+}
+
+func (circuit *CircuitBreaker) stateLocked() CircuitState {
+	if circuit.forceOpen {
+		return CircuitForcedOpen
+	}
+	if circuit.forceClosed {
+		return CircuitForcedClosed
+	}
+	state := circuit.storedStateLocked()
+	if !state.Open {
+		return CircuitClosed
+	}
+
+	now := getClock().Now().UnixNano()
+	if now > state.OpenedOrLastTested.UnixNano()+circuit.sleepWindowLocked(getSettings(circuit.Name)) {
+		return CircuitHalfOpen
+	}
+
+	return CircuitOpen
+}
+
+// A HealthReport explains the state of a circuit: the numbers its health is judged on, and why it is
+// open or closed.
+type HealthReport struct {
+	State CircuitState
+	// Reason is a human-readable explanation of State.
+	Reason string
+
+	ErrorPercent          int
+	ErrorPercentThreshold int
+	// Requests is the number of requests in the rolling window; the error percentage is only
+	// checked once it reaches VolumeThreshold.
+	Requests           uint64
+	VolumeThreshold    uint64
+	VolumeThresholdMet bool
+	// ConsecutiveFailures is the number of failures in a row; ConsecutiveFailureThreshold is 0 unless
+	// they may open the circuit.
+	ConsecutiveFailures         int
+	ConsecutiveFailureThreshold int
+	// Latency is the LatencyPercentile percentile of recent run durations; LatencyThreshold is 0 unless
+	// it may open the circuit.
+	Latency           time.Duration
+	LatencyPercentile float64
+	LatencyThreshold  time.Duration
+}
+
+// Health reports the state of the named circuit and the reason for it. Like State, it never changes
+// the state of the circuit. As with Metrics, every execution which has returned from Do is included.
+// ErrUnknownCircuit is returned if the command has not been executed yet.
+func Health(name string) (HealthReport, error) {
+	circuit, err := lookupCircuit(name)
+	if err != nil {
+		return HealthReport{}, err
+	}
+
+	circuit.metrics.flush()
+	return circuit.health(), nil
+}
+
+func (circuit *CircuitBreaker) health() HealthReport {
+	settings := getSettings(circuit.Name)
+	now := time.Now()
+
+	report := HealthReport{
+		State:                 circuit.State(),
+		ErrorPercent:          circuit.metrics.ErrorPercent(now),
+		ErrorPercentThreshold: settings.ErrorPercentThreshold,
+		Requests:              uint64(circuit.metrics.Requests().Sum(now)),
+		VolumeThreshold:       settings.volumeThreshold(),
+
+		ConsecutiveFailures:         circuit.metrics.ConsecutiveFailures(),
+		ConsecutiveFailureThreshold: settings.ConsecutiveFailureThreshold,
+
+		Latency:           circuit.metrics.latency(settings),
+		LatencyPercentile: settings.LatencyPercentile,
+		LatencyThreshold:  settings.LatencyThreshold,
+	}
+	report.VolumeThresholdMet = report.Requests >= report.VolumeThreshold
+	unhealthy := report.ErrorPercent >= report.ErrorPercentThreshold
+
+	switch report.State {
+	case CircuitForcedOpen:
+		report.Reason = "forced open"
+	case CircuitForcedClosed:
+		report.Reason = "forced closed"
+	case CircuitOpen:
+		report.Reason = fmt.Sprintf("%s, waiting %v before allowing a test request", circuit.openedBy(), circuit.sleepWindow(settings))
+	case CircuitHalfOpen:
+		if settings.HalfOpenMaxRequests == 1 && settings.HalfOpenSuccessThreshold == 1 {
+			report.Reason = fmt.Sprintf("%s, the next request will test whether it can close", circuit.openedBy())
+			break
+		}
+		circuit.mutex.RLock()
+		successes := circuit.halfOpenSuccesses
+		circuit.mutex.RUnlock()
+		report.Reason = fmt.Sprintf("%s, up to %d requests at a time will test whether it can close, which takes %d successes in a row (%d so far)",
+			circuit.openedBy(), settings.HalfOpenMaxRequests, settings.HalfOpenSuccessThreshold, successes)
+	case CircuitClosed:
+		if circuit.metrics.tooManyConsecutiveFailures(settings) {
+			report.Reason = fmt.Sprintf("closed, but %d failures in a row have reached the threshold of %d and the next request will open it",
+				report.ConsecutiveFailures, report.ConsecutiveFailureThreshold)
+		} else if !report.VolumeThresholdMet {
+			report.Reason = fmt.Sprintf("closed, %d of %d requests needed before the error percentage is checked",
+				report.Requests, report.VolumeThreshold)
+		} else if circuit.metrics.tooSlow(settings) {
+			report.Reason = fmt.Sprintf("closed, but the p%v latency of %v has reached the threshold of %v and the next request will open it",
+				report.LatencyPercentile, report.Latency, report.LatencyThreshold)
+		} else if unhealthy {
+			report.Reason = fmt.Sprintf("closed, but the error percentage of %d%% has reached the threshold of %d%% and the next request will open it",
+				report.ErrorPercent, report.ErrorPercentThreshold)
+		} else {
+			report.Reason = fmt.Sprintf("closed, the error percentage of %d%% is below the threshold of %d%%",
+				report.ErrorPercent, report.ErrorPercentThreshold)
+		}
+	}
+
+	return report
+}
+
 // AllowRequest is checked before a command executes, ensuring that circuit state and metric health allow it.
 // When the circuit is open, this call will occasionally return true to measure whether the external service
 // has recovered.
 func (circuit *CircuitBreaker) AllowRequest() bool {
-	return !circuit.IsOpen() || circuit.allowSingleTest()
+	allowed, _ := circuit.allowRequest()
+	return allowed
 }
 
-func (circuit *CircuitBreaker) allowSingleTest() bool {
+// allowRequest is AllowRequest, also reporting whether the request was admitted as a test request of
+// an open circuit, whose outcome is then expected by reportProbe.
+func (circuit *CircuitBreaker) allowRequest() (allowed, probe bool) {
+	if circuit.isBlocked() {
+		return false, false
+	}
+	if !circuit.IsOpen() {
+		return true, false
+	}
+	if circuit.allowSingleTest() {
+		return true, true
+	}
+	return false, false
+}
+
+// AllowRequest reports whether the named circuit would let an execution through right now. Unlike
+// executing the command, it takes no ticket, records no event and never changes the state of the
+// circuit, so a half-open circuit keeps its test requests. The answer is advisory: it may have changed
+// by the time the command is executed, and an allowed command may still be rejected by a full
+// executor pool. ErrUnknownCircuit is returned if the command has not been executed yet.
+func AllowRequest(name string) (bool, error) {
+	circuit, err := lookupCircuit(name)
+	if err != nil {
+		return false, err
+	}
+
+	return circuit.wouldAllowRequest(), nil
+}
+
+// wouldAllowRequest makes the decision of the AllowRequest method without acting on it.
+func (circuit *CircuitBreaker) wouldAllowRequest() bool {
+	settings := getSettings(circuit.Name)
+
 	circuit.mutex.RLock()
 	defer circuit.mutex.RUnlock()
 
-	now := time.Now().UnixNano()
-	openedOrLastTestedTime := atomic.LoadInt64(&circuit.openedOrLastTestedTime)
-	if circuit.open && now > openedOrLastTestedTime+getSettings(circuit.Name).SleepWindow.Nanoseconds() {
-		swapped := atomic.CompareAndSwapInt64(&circuit.openedOrLastTestedTime, openedOrLastTestedTime, now)
-		if swapped {
-			log.Printf("hystrix-go: allowing single test to possibly close circuit %v", circuit.Name)
-		}
-		return swapped
+	switch {
+	case circuit.forceOpen, circuit.isBlocked():
+		return false
+	case circuit.forceClosed, settings.MonitorOnly:
+		return true
+	case circuit.storedStateLocked().Open:
+		return circuit.stateLocked() == CircuitHalfOpen && circuit.halfOpenProbes < settings.HalfOpenMaxRequests
 	}
 
-	return false
+	// a circuit about to open turns the request away, as it would not be a test request yet
+	return !circuit.shouldOpen(settings)
 }
 
-func (circuit *CircuitBreaker) setOpen() {
+// TimeUntilHalfOpen returns how long the named circuit will keep short-circuiting before its sleep
+// window ends and it lets a test request through, so that callers can wait instead of being rejected.
+// It is 0 if the circuit is closed or already half-open. A circuit held open by ForceOpen has no sleep
+// window, so the length of a whole one is returned to keep callers backing off. The state of the
+// circuit is not changed. ErrUnknownCircuit is returned if the command has not been executed yet.
+func TimeUntilHalfOpen(name string) (time.Duration, error) {
+	circuit, err := lookupCircuit(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return circuit.timeUntilHalfOpen(), nil
+}
+
+func (circuit *CircuitBreaker) timeUntilHalfOpen() time.Duration {
+	settings := getSettings(circuit.Name)
+
+	circuit.mutex.RLock()
+	defer circuit.mutex.RUnlock()
+
+	state := circuit.storedStateLocked()
+	switch {
+	case circuit.forceOpen:
+		return settings.SleepWindow
+	case circuit.forceClosed, !state.Open:
+		return 0
+	}
+
+	now := getClock().Now().UnixNano()
+	remaining := state.OpenedOrLastTested.UnixNano() + circuit.sleepWindowLocked(settings) - now
+	if remaining <= 0 {
+		return 0
+	}
+	return time.Duration(remaining)
+}
+
+// allowSingleTest admits a test request once the sleep window has elapsed, for up to HalfOpenMaxRequests
+// test requests at a time.
+func (circuit *CircuitBreaker) allowSingleTest() bool {
+	settings := getSettings(circuit.Name)
+
 	circuit.mutex.Lock()
 	defer circuit.mutex.Unlock()
 
-	if circuit.open {
+	now := getClock().Now().UnixNano()
+	state := circuit.storedStateLocked()
+	if state.Open && now > state.OpenedOrLastTested.UnixNano()+circuit.sleepWindowLocked(settings) && circuit.halfOpenProbes < settings.HalfOpenMaxRequests {
+		circuit.halfOpenProbes++
+		log.Debug("allowing test request to possibly close circuit", "circuit", circuit.Name, "probes", circuit.halfOpenProbes)
+		return true
+	}
+
+	return false
+}
+
+// startSleepWindowLocked opens the circuit, or keeps it open, and restarts its sleep window from now.
+// The lock must be held.
+func (circuit *CircuitBreaker) startSleepWindowLocked() {
+	circuit.sleepJitter = 2*rand.Float64() - 1
+	circuit.saveStateLocked(StoredState{Open: true, OpenedOrLastTested: getClock().Now()})
+}
+
+// storedStateLocked returns the state of the circuit held by its store. The lock must be held.
+func (circuit *CircuitBreaker) storedStateLocked() StoredState {
+	return circuit.store.Load(circuit.Name)
+}
+
+// saveStateLocked replaces the state of the circuit held by its store. The lock must be held.
+func (circuit *CircuitBreaker) saveStateLocked(state StoredState) {
+	circuit.store.Save(circuit.Name, state)
+}
+
+// sleepWindowLocked returns the length, in nanoseconds, of the current sleep window with its growth and
+// jitter applied. The lock must be held.
+func (circuit *CircuitBreaker) sleepWindowLocked(settings *Settings) int64 {
+	window := settings.SleepWindow.Nanoseconds()
+	if circuit.sleepMultiplier > 1 {
+		window = int64(float64(window) * circuit.sleepMultiplier)
+		if max := settings.MaxSleepWindow.Nanoseconds(); window > max {
+			window = max
+		}
+	}
+	jitter := float64(window) * float64(settings.SleepWindowJitter) / 100 * circuit.sleepJitter
+	return window + int64(jitter)
+}
+
+// sleepWindow returns the length of the current sleep window.
+func (circuit *CircuitBreaker) sleepWindow(settings *Settings) time.Duration {
+	circuit.mutex.RLock()
+	defer circuit.mutex.RUnlock()
+	return time.Duration(circuit.sleepWindowLocked(settings))
+}
+
+// growSleepWindowLocked multiplies the sleep window by SleepWindowMultiplier, unless it has already
+// reached MaxSleepWindow. The lock must be held.
+func (circuit *CircuitBreaker) growSleepWindowLocked(settings *Settings) {
+	if settings.SleepWindowMultiplier <= 1 || settings.SleepWindow <= 0 {
+		return
+	}
+
+	limit := float64(settings.MaxSleepWindow) / float64(settings.SleepWindow)
+	circuit.sleepMultiplier = math.Min(math.Max(circuit.sleepMultiplier, 1)*settings.SleepWindowMultiplier, limit)
+}
+
+// reportProbe records the outcome of a test request admitted by allowSingleTest. The circuit closes
+// once HalfOpenSuccessThreshold of them have succeeded in a row. A failed test resets the count and
+// restarts the sleep window.
+func (circuit *CircuitBreaker) reportProbe(eventType string) {
+	settings := getSettings(circuit.Name)
+
+	circuit.mutex.Lock()
+	if !circuit.storedStateLocked().Open || circuit.halfOpenProbes == 0 {
+		// the circuit has been closed or reset since the test was admitted
+		circuit.mutex.Unlock()
+		return
+	}
+	circuit.halfOpenProbes--
+
+	closeCircuit := false
+	switch eventType {
+	case "success", "non-failure-error":
+		circuit.halfOpenSuccesses++
+		closeCircuit = circuit.halfOpenSuccesses >= settings.HalfOpenSuccessThreshold
+	case "failure", "timeout":
+		log.Debug("test request failed, circuit stays open", "circuit", circuit.Name)
+		circuit.halfOpenSuccesses = 0
+		circuit.growSleepWindowLocked(settings)
+		circuit.startSleepWindowLocked()
+	default:
+		// the test was rejected or cancelled before it could tell whether the backend has recovered
+	}
+	circuit.mutex.Unlock()
+
+	if closeCircuit {
+		circuit.setClose()
+	}
+}
+
+// openedBy describes what opened the circuit, for the Reason of a HealthReport.
+func (circuit *CircuitBreaker) openedBy() string {
+	circuit.mutex.RLock()
+	defer circuit.mutex.RUnlock()
+
+	if circuit.openCause == "" {
+		return "opened"
+	}
+	return "opened by " + circuit.openCause
+}
+
+// setOpen opens the circuit, recording cause as what opened it.
+func (circuit *CircuitBreaker) setOpen(cause string) {
+	circuit.mutex.Lock()
+
+	if circuit.storedStateLocked().Open {
+		circuit.mutex.Unlock()
 		return
 	}
 
-	log.Printf("hystrix-go: opening circuit %v", circuit.Name)
+	log.Warn("opening circuit", "circuit", circuit.Name)
 
-	circuit.openedOrLastTestedTime = time.Now().UnixNano()
-	circuit.open = true
+	from := circuit.stateLocked()
+	circuit.sleepMultiplier = 1
+	circuit.startSleepWindowLocked()
+	circuit.halfOpenProbes = 0
+	circuit.halfOpenSuccesses = 0
+	circuit.openCause = cause
+	to := circuit.stateLocked()
+	handlers := circuit.stateChangeHandlers
+	circuit.mutex.Unlock()
+
+	notifyStateChange(handlers, from, to)
 }
 
 func (circuit *CircuitBreaker) setClose() {
 	circuit.mutex.Lock()
-	defer circuit.mutex.Unlock()
 
-	if !circuit.open {
+	if !circuit.storedStateLocked().Open {
+		circuit.mutex.Unlock()
 		return
 	}
 
-	log.Printf("hystrix-go: closing circuit %v", circuit.Name)
+	log.Info("closing circuit", "circuit", circuit.Name)
 
-	circuit.open = false
+	from := circuit.stateLocked()
+	circuit.saveStateLocked(StoredState{})
+	circuit.sleepMultiplier = 1
+	circuit.halfOpenProbes = 0
+	circuit.halfOpenSuccesses = 0
+	circuit.openCause = ""
 	circuit.metrics.Reset()
+	to := circuit.stateLocked()
+	handlers := circuit.stateChangeHandlers
+	circuit.mutex.Unlock()
+
+	notifyStateChange(handlers, from, to)
+}
+
+// ResetCircuit closes the named circuit and clears its metrics, so that its history is forgotten, for
+// instance after the backend has been redeployed. Its settings, state change handlers and any forced
+// state are kept. ErrUnknownCircuit is returned if the command has not been executed yet.
+func ResetCircuit(name string) error {
+	circuit, err := lookupCircuit(name)
+	if err != nil {
+		return err
+	}
+
+	// record what has already been reported so that it doesn't land after the reset
+	circuit.metrics.flush()
+	circuit.reset()
+	return nil
+}
+
+func (circuit *CircuitBreaker) reset() {
+	circuit.mutex.Lock()
+
+	log.Info("resetting circuit", "circuit", circuit.Name)
+
+	from := circuit.stateLocked()
+	circuit.saveStateLocked(StoredState{})
+	circuit.sleepMultiplier = 1
+	circuit.halfOpenProbes = 0
+	circuit.halfOpenSuccesses = 0
+	circuit.metrics.Reset()
+	to := circuit.stateLocked()
+	handlers := circuit.stateChangeHandlers
+	circuit.mutex.Unlock()
+
+	notifyStateChange(handlers, from, to)
 }
 
 // ReportEvent records command metrics for tracking recent error rates and exposing data to the dashboard.
+// The first of eventTypes is the outcome of the execution, such as "success" or "timeout", and any others
+// describe it further, such as "fallback-success" or "queued". They are recorded as a single update, so
+// they count as one attempt with one latency sample.
+//
+// An execution reported this way can't tell whether AllowRequest admitted it as a test request of an
+// open circuit, so while a test request is outstanding, any execution which ran is taken to be it.
 func (circuit *CircuitBreaker) ReportEvent(eventTypes []string, start time.Time, runDuration time.Duration) error {
+	// short-circuited and blocked executions never ran, so they weren't test requests
+	probe := len(eventTypes) > 0 && eventTypes[0] != "short-circuit" && eventTypes[0] != "blocked"
+	return circuit.report(eventTypes, start, runDuration, 0, 0, nil, probe)
+}
+
+// report is ReportEvent with the time spent in the fallback, which is only recorded if one of
+// eventTypes is "fallback-success" or "fallback-failure", the time spent waiting for a ticket, which is
+// only recorded if it isn't 0, and the tags of the execution. probe is whether the execution was
+// admitted as a test request, which it then settles.
+func (circuit *CircuitBreaker) report(eventTypes []string, start time.Time, runDuration, fallbackDuration, queueWaitDuration time.Duration, tags map[string]string, probe bool) error {
 	if len(eventTypes) == 0 {
 		return fmt.Errorf("no event types sent for metrics")
 	}
 
-	circuit.mutex.RLock()
-	o := circuit.open
-	circuit.mutex.RUnlock()
-	if eventTypes[0] == "success" && o {
-		circuit.setClose()
+	if probe {
+		circuit.reportProbe(eventTypes[0])
 	}
+	publishEvents(circuit.Name, eventTypes, runDuration)
 
 	var concurrencyInUse float64
-	if circuit.executorPool.Max > 0 {
-		concurrencyInUse = float64(circuit.executorPool.ActiveCount()) / float64(circuit.executorPool.Max)
+	if max := circuit.executorPool.size(); max > 0 {
+		concurrencyInUse = float64(circuit.executorPool.ActiveCount()) / float64(max)
 	}
 
 	select {
 	case circuit.metrics.Updates <- &commandExecution{
-		Types:            eventTypes,
-		Start:            start,
-		RunDuration:      runDuration,
-		ConcurrencyInUse: concurrencyInUse,
+		Types:             eventTypes,
+		Start:             start,
+		RunDuration:       runDuration,
+		FallbackDuration:  fallbackDuration,
+		QueueWaitDuration: queueWaitDuration,
+		ConcurrencyInUse:  concurrencyInUse,
+		Tags:              tags,
 	}:
 	default:
 		return CircuitError{Message: fmt.Sprintf("metrics channel (%v) is at capacity", circuit.Name)}
@@ -1,6 +1,9 @@
 package hystrix
 
 import (
+	"errors"
+	"fmt"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -33,6 +36,30 @@ func TestGetCircuit(t *testing.T) {
 	})
 }
 
+func TestCircuitNames(t *testing.T) {
+	Convey("with two circuits", t, func() {
+		defer Flush()
+
+		GetCircuit("names-b")
+		GetCircuit("names-a")
+
+		Convey("CircuitNames() returns their names in order", func() {
+			So(CircuitNames(), ShouldResemble, []string{"names-a", "names-b"})
+		})
+
+		Convey("changing the returned slice does not change the circuits", func() {
+			names := CircuitNames()
+			names[0] = "changed"
+			So(CircuitNames(), ShouldResemble, []string{"names-a", "names-b"})
+		})
+	})
+
+	Convey("with no circuits CircuitNames() is empty", t, func() {
+		Flush()
+		So(CircuitNames(), ShouldHaveLength, 0)
+	})
+}
+
 func TestMultithreadedGetCircuit(t *testing.T) {
 	defer Flush()
 
@@ -71,6 +98,553 @@ func TestMultithreadedGetCircuit(t *testing.T) {
 	})
 }
 
+func TestForcedCircuit(t *testing.T) {
+	Convey("when a circuit is forced open by name", t, func() {
+		defer Flush()
+
+		So(ForceOpen("foo"), ShouldBeNil)
+		cb, _, err := GetCircuit("foo")
+		So(err, ShouldBeNil)
+
+		Convey("the circuit is open", func() {
+			So(cb.IsOpen(), ShouldBeTrue)
+			So(cb.AllowRequest(), ShouldBeFalse)
+		})
+
+		Convey("and then forced closed", func() {
+			So(ForceClose("foo"), ShouldBeNil)
+
+			Convey("the circuit is closed even when it was tripped", func() {
+				cb.setOpen(causeErrors)
+				So(cb.IsOpen(), ShouldBeFalse)
+				So(cb.AllowRequest(), ShouldBeTrue)
+			})
+		})
+
+		Convey("and then cleared", func() {
+			So(ClearForced("foo"), ShouldBeNil)
+
+			Convey("the circuit returns to automatic behavior", func() {
+				So(cb.IsOpen(), ShouldBeFalse)
+				cb.setOpen(causeErrors)
+				So(cb.IsOpen(), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestForceFallback(t *testing.T) {
+	Convey("with every execution of a healthy command forced to its fallback", t, func() {
+		defer Flush()
+
+		So(ForceFallback("force-fallback", 100), ShouldBeNil)
+
+		ran := false
+		var fallbackErr error
+		err := Do("force-fallback", func() error {
+			ran = true
+			return nil
+		}, func(err error) error {
+			fallbackErr = err
+			return nil
+		})
+
+		Convey("the fallback runs instead of run", func() {
+			So(err, ShouldBeNil)
+			So(ran, ShouldBeFalse)
+			So(errors.Is(fallbackErr, ErrForcedFallback), ShouldBeTrue)
+		})
+
+		Convey("it is recorded as a failure without a run duration", func() {
+			snapshot, _ := Metrics("force-fallback")
+			So(snapshot.Failures, ShouldEqual, 1)
+			So(snapshot.FallbackSuccesses, ShouldEqual, 1)
+
+			cb, _, _ := GetCircuit("force-fallback")
+			So(cb.metrics.runDuration().SortedDurations(), ShouldHaveLength, 0)
+		})
+
+		Convey("a percent of 0 stops forcing fallbacks", func() {
+			So(ForceFallback("force-fallback", 0), ShouldBeNil)
+			Do("force-fallback", func() error {
+				ran = true
+				return nil
+			}, nil)
+			So(ran, ShouldBeTrue)
+		})
+	})
+
+	Convey("a percent above 100 is rejected", t, func() {
+		So(ForceFallback("force-fallback", 101), ShouldNotBeNil)
+	})
+}
+
+func TestCircuitState(t *testing.T) {
+	Convey("when a circuit is created", t, func() {
+		defer Flush()
+
+		ConfigureCommand("foo", CommandConfig{SleepWindow: 50})
+		cb, _, err := GetCircuit("foo")
+		So(err, ShouldBeNil)
+
+		Convey("it is closed", func() {
+			state, err := GetCircuitState("foo")
+			So(err, ShouldBeNil)
+			So(state, ShouldEqual, CircuitClosed)
+
+			open, err := IsCircuitOpen("foo")
+			So(err, ShouldBeNil)
+			So(open, ShouldBeFalse)
+		})
+
+		Convey("and it opens", func() {
+			cb.setOpen(causeErrors)
+
+			Convey("it is open", func() {
+				state, _ := GetCircuitState("foo")
+				So(state, ShouldEqual, CircuitOpen)
+
+				open, _ := IsCircuitOpen("foo")
+				So(open, ShouldBeTrue)
+			})
+
+			Convey("it is half-open once the sleep window elapses", func() {
+				time.Sleep(60 * time.Millisecond)
+				state, _ := GetCircuitState("foo")
+				So(state, ShouldEqual, CircuitHalfOpen)
+
+				Convey("without consuming the single test", func() {
+					So(cb.AllowRequest(), ShouldBeTrue)
+				})
+			})
+		})
+
+		Convey("and it is forced", func() {
+			ForceOpen("foo")
+			state, _ := GetCircuitState("foo")
+			So(state, ShouldEqual, CircuitForcedOpen)
+
+			ForceClose("foo")
+			state, _ = GetCircuitState("foo")
+			So(state, ShouldEqual, CircuitForcedClosed)
+		})
+	})
+}
+
+func TestHealth(t *testing.T) {
+	Convey("with a circuit which has seen 4 failures out of 5 requests", t, func() {
+		defer Flush()
+
+		ConfigureCommand("health", CommandConfig{RequestVolumeThreshold: 10, ErrorPercentThreshold: 50})
+		for i := 0; i < 5; i++ {
+			Do("health", func() error {
+				if i == 0 {
+					return nil
+				}
+				return fmt.Errorf("boom")
+			}, nil)
+		}
+
+		Convey("it is closed because the volume threshold has not been met", func() {
+			report, err := Health("health")
+			So(err, ShouldBeNil)
+			So(report.State, ShouldEqual, CircuitClosed)
+			So(report.ErrorPercent, ShouldEqual, 80)
+			So(report.ErrorPercentThreshold, ShouldEqual, 50)
+			So(report.Requests, ShouldEqual, 5)
+			So(report.VolumeThreshold, ShouldEqual, 10)
+			So(report.VolumeThresholdMet, ShouldBeFalse)
+			So(report.Reason, ShouldContainSubstring, "5 of 10 requests")
+		})
+
+		Convey("once the volume threshold is met it says it will open", func() {
+			for i := 0; i < 5; i++ {
+				Do("health", func() error {
+					return fmt.Errorf("boom")
+				}, nil)
+			}
+
+			report, _ := Health("health")
+			So(report.State, ShouldEqual, CircuitClosed)
+			So(report.VolumeThresholdMet, ShouldBeTrue)
+			So(report.Reason, ShouldContainSubstring, "the next request will open it")
+
+			Do("health", func() error { return nil }, nil)
+			report, _ = Health("health")
+			So(report.State, ShouldEqual, CircuitOpen)
+			So(report.Reason, ShouldContainSubstring, "opened by errors")
+		})
+
+		Convey("a forced circuit says so", func() {
+			ForceOpen("health")
+			report, _ := Health("health")
+			So(report.Reason, ShouldEqual, "forced open")
+		})
+	})
+
+	Convey("with a circuit which has never run", t, func() {
+		_, err := Health("health-unknown")
+		So(err, ShouldResemble, ErrUnknownCircuit)
+	})
+}
+
+func TestHalfOpenProbes(t *testing.T) {
+	Convey("with an open circuit which admits 2 test requests at a time", t, func() {
+		defer Flush()
+
+		ConfigureCommand("probes", CommandConfig{SleepWindow: 10, HalfOpenMaxRequests: 2})
+		cb, _, _ := GetCircuit("probes")
+		cb.setOpen(causeErrors)
+		time.Sleep(20 * time.Millisecond)
+
+		Convey("only 2 test requests are admitted once the sleep window elapses", func() {
+			So(cb.AllowRequest(), ShouldBeTrue)
+			So(cb.AllowRequest(), ShouldBeTrue)
+			So(cb.AllowRequest(), ShouldBeFalse)
+
+			Convey("a finished test request makes room for another", func() {
+				cb.ReportEvent([]string{"success"}, time.Now(), 0)
+				So(cb.State(), ShouldEqual, CircuitHalfOpen)
+				So(cb.AllowRequest(), ShouldBeTrue)
+			})
+
+			Convey("the health report counts the test requests which have succeeded", func() {
+				cb.ReportEvent([]string{"success"}, time.Now(), 0)
+				report, _ := Health("probes")
+				So(report.Reason, ShouldEqual, "opened by errors, up to 2 requests at a time will test whether it can close, which takes 2 successes in a row (1 so far)")
+			})
+
+			Convey("the circuit closes once 2 have succeeded", func() {
+				cb.ReportEvent([]string{"success"}, time.Now(), 0)
+				So(cb.IsOpen(), ShouldBeTrue)
+				cb.ReportEvent([]string{"success"}, time.Now(), 0)
+				So(cb.IsOpen(), ShouldBeFalse)
+			})
+
+			Convey("a failed test request restarts the sleep window", func() {
+				cb.ReportEvent([]string{"success"}, time.Now(), 0)
+				cb.ReportEvent([]string{"failure"}, time.Now(), 0)
+				So(cb.State(), ShouldEqual, CircuitOpen)
+				So(cb.AllowRequest(), ShouldBeFalse)
+
+				time.Sleep(20 * time.Millisecond)
+				So(cb.AllowRequest(), ShouldBeTrue)
+			})
+		})
+
+		Convey("short-circuited requests are not counted as test requests", func() {
+			So(cb.AllowRequest(), ShouldBeTrue)
+			cb.ReportEvent([]string{"short-circuit"}, time.Now(), 0)
+			So(cb.AllowRequest(), ShouldBeTrue)
+			So(cb.AllowRequest(), ShouldBeFalse)
+		})
+	})
+}
+
+func TestProbeAttribution(t *testing.T) {
+	Convey("with a command in flight when its circuit opens", t, func() {
+		defer Flush()
+		fake := newFakeClock()
+		defer setClock(setClock(fake))
+
+		ConfigureCommand("probe-attribution", CommandConfig{SleepWindow: 10})
+		// block runs a command until release is closed, returning once it has started
+		block := func(release chan struct{}) (done chan error) {
+			started := make(chan struct{})
+			done = make(chan error, 1)
+			go func() {
+				done <- Do("probe-attribution", func() error {
+					close(started)
+					<-release
+					return nil
+				}, nil)
+			}()
+			<-started
+			return done
+		}
+		releaseEarly := make(chan struct{})
+		early := block(releaseEarly)
+
+		cb, _, _ := GetCircuit("probe-attribution")
+		cb.setOpen(causeErrors)
+		fake.Advance(20 * time.Millisecond)
+		releaseProbe := make(chan struct{})
+		probe := block(releaseProbe)
+
+		Convey("its outcome is not taken for that of the test request", func() {
+			close(releaseEarly)
+			So(<-early, ShouldBeNil)
+			So(cb.State(), ShouldEqual, CircuitHalfOpen)
+			So(cb.AllowRequest(), ShouldBeFalse)
+
+			// the test request itself still closes the circuit once it succeeds
+			close(releaseProbe)
+			So(<-probe, ShouldBeNil)
+			So(cb.State(), ShouldEqual, CircuitClosed)
+		})
+	})
+}
+
+func TestSleepWindowJitter(t *testing.T) {
+	Convey("with a circuit whose 100ms sleep window varies by 50 percent", t, func() {
+		defer Flush()
+
+		ConfigureCommand("jitter", CommandConfig{SleepWindow: 100, SleepWindowJitter: 50})
+		cb, _, _ := GetCircuit("jitter")
+		settings := getSettings("jitter")
+
+		Convey("each time it opens the sleep window is drawn within the jitter", func() {
+			windows := map[int64]bool{}
+			for i := 0; i < 20; i++ {
+				cb.setOpen(causeErrors)
+				cb.mutex.RLock()
+				window := cb.sleepWindowLocked(settings)
+				cb.mutex.RUnlock()
+				cb.setClose()
+
+				So(window, ShouldBeGreaterThanOrEqualTo, (50 * time.Millisecond).Nanoseconds())
+				So(window, ShouldBeLessThanOrEqualTo, (150 * time.Millisecond).Nanoseconds())
+				windows[window] = true
+			}
+			So(len(windows), ShouldBeGreaterThan, 1)
+		})
+	})
+
+	Convey("without jitter the sleep window is exact", t, func() {
+		defer Flush()
+
+		ConfigureCommand("no-jitter", CommandConfig{SleepWindow: 100})
+		cb, _, _ := GetCircuit("no-jitter")
+		cb.setOpen(causeErrors)
+
+		cb.mutex.RLock()
+		defer cb.mutex.RUnlock()
+		So(cb.sleepWindowLocked(getSettings("no-jitter")), ShouldEqual, (100 * time.Millisecond).Nanoseconds())
+	})
+}
+
+func TestSleepWindowMultiplier(t *testing.T) {
+	Convey("with an open circuit whose 100ms sleep window doubles up to 300ms", t, func() {
+		defer Flush()
+		fake := newFakeClock()
+		defer setClock(setClock(fake))
+
+		ConfigureCommand("sleep-backoff", CommandConfig{SleepWindow: 100, SleepWindowMultiplier: 2, MaxSleepWindow: 300})
+		cb, _, _ := GetCircuit("sleep-backoff")
+		settings := getSettings("sleep-backoff")
+		window := func() time.Duration {
+			cb.mutex.RLock()
+			defer cb.mutex.RUnlock()
+			return time.Duration(cb.sleepWindowLocked(settings))
+		}
+		probe := func(eventType string) {
+			fake.Advance(window() + time.Millisecond)
+			So(cb.AllowRequest(), ShouldBeTrue)
+			cb.reportProbe(eventType)
+		}
+		cb.setOpen(causeErrors)
+		So(window(), ShouldEqual, 100*time.Millisecond)
+
+		Convey("each failed test request grows it until the cap", func() {
+			probe("failure")
+			So(window(), ShouldEqual, 200*time.Millisecond)
+			probe("timeout")
+			So(window(), ShouldEqual, 300*time.Millisecond)
+			probe("failure")
+			So(window(), ShouldEqual, 300*time.Millisecond)
+
+			Convey("and it starts again from the base once the circuit closes", func() {
+				cb.setClose()
+				cb.setOpen(causeErrors)
+				So(window(), ShouldEqual, 100*time.Millisecond)
+			})
+		})
+	})
+
+	Convey("with commands in flight when a circuit with a growing sleep window opens", t, func() {
+		defer Flush()
+		fake := newFakeClock()
+		defer setClock(setClock(fake))
+
+		ConfigureCommand("sleep-in-flight", CommandConfig{SleepWindow: 100, SleepWindowMultiplier: 2, MaxSleepWindow: 800})
+		release := make(chan struct{})
+		var started, done sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			started.Add(1)
+			done.Add(1)
+			go func() {
+				defer done.Done()
+				Do("sleep-in-flight", func() error {
+					started.Done()
+					<-release
+					return errors.New("boom")
+				}, nil)
+			}()
+		}
+		started.Wait()
+
+		cb, _, _ := GetCircuit("sleep-in-flight")
+		cb.setOpen(causeErrors)
+		cb.mutex.RLock()
+		opened := cb.storedStateLocked().OpenedOrLastTested
+		cb.mutex.RUnlock()
+		fake.Advance(50 * time.Millisecond)
+
+		Convey("their failures neither grow nor restart the sleep window", func() {
+			close(release)
+			done.Wait()
+
+			cb.mutex.RLock()
+			defer cb.mutex.RUnlock()
+			So(cb.sleepWindowLocked(getSettings("sleep-in-flight")), ShouldEqual, (100 * time.Millisecond).Nanoseconds())
+			So(cb.storedStateLocked().OpenedOrLastTested, ShouldEqual, opened)
+		})
+	})
+
+	Convey("without a multiplier failed test requests keep the sleep window", t, func() {
+		defer Flush()
+		fake := newFakeClock()
+		defer setClock(setClock(fake))
+
+		ConfigureCommand("sleep-constant", CommandConfig{SleepWindow: 100})
+		cb, _, _ := GetCircuit("sleep-constant")
+		cb.setOpen(causeErrors)
+		fake.Advance(101 * time.Millisecond)
+		So(cb.AllowRequest(), ShouldBeTrue)
+		cb.reportProbe("failure")
+
+		cb.mutex.RLock()
+		defer cb.mutex.RUnlock()
+		So(cb.sleepWindowLocked(getSettings("sleep-constant")), ShouldEqual, (100 * time.Millisecond).Nanoseconds())
+	})
+}
+
+func TestHalfOpenSuccessThreshold(t *testing.T) {
+	Convey("with an open circuit which needs 3 successful test requests in a row to close", t, func() {
+		defer Flush()
+		fake := newFakeClock()
+		defer setClock(setClock(fake))
+
+		ConfigureCommand("success-threshold", CommandConfig{SleepWindow: 10, HalfOpenSuccessThreshold: 3})
+		cb, _, _ := GetCircuit("success-threshold")
+		cb.setOpen(causeErrors)
+
+		probe := func(eventType string) {
+			fake.Advance(20 * time.Millisecond)
+			So(cb.AllowRequest(), ShouldBeTrue)
+			cb.ReportEvent([]string{eventType}, fake.Now(), 0)
+		}
+
+		Convey("it closes only after the third success following a failure", func() {
+			probe("success")
+			probe("success")
+			probe("failure")
+			So(cb.State(), ShouldEqual, CircuitOpen)
+
+			probe("success")
+			probe("success")
+			So(cb.IsOpen(), ShouldBeTrue)
+
+			probe("success")
+			So(cb.IsOpen(), ShouldBeFalse)
+		})
+	})
+}
+
+func TestOnStateChange(t *testing.T) {
+	Convey("with a state change handler registered on a circuit", t, func() {
+		defer Flush()
+
+		ConfigureCommand("foo", CommandConfig{
+			RequestVolumeThreshold: 1,
+			ErrorPercentThreshold:  1,
+		})
+
+		var mu sync.Mutex
+		var transitions [][2]CircuitState
+		err := OnStateChange("foo", func(from, to CircuitState) {
+			mu.Lock()
+			transitions = append(transitions, [2]CircuitState{from, to})
+			mu.Unlock()
+		})
+		So(err, ShouldBeNil)
+		cb, _, _ := GetCircuit("foo")
+
+		Convey("a burst of failures opens the circuit exactly once", func() {
+			cb.metrics = metricFailingPercent(100)
+			wg := &sync.WaitGroup{}
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					cb.IsOpen()
+				}()
+			}
+			wg.Wait()
+
+			mu.Lock()
+			defer mu.Unlock()
+			So(transitions, ShouldResemble, [][2]CircuitState{{CircuitClosed, CircuitOpen}})
+		})
+
+		Convey("closing and forcing the circuit are reported", func() {
+			cb.setOpen(causeErrors)
+			cb.setClose()
+			cb.setClose()
+			ForceOpen("foo")
+			ForceOpen("foo")
+			ClearForced("foo")
+
+			mu.Lock()
+			defer mu.Unlock()
+			So(transitions, ShouldResemble, [][2]CircuitState{
+				{CircuitClosed, CircuitOpen},
+				{CircuitOpen, CircuitClosed},
+				{CircuitClosed, CircuitForcedOpen},
+				{CircuitForcedOpen, CircuitClosed},
+			})
+		})
+
+		Convey("a handler may call back into hystrix", func() {
+			states := make(chan CircuitState, 1)
+			OnStateChange("foo", func(from, to CircuitState) {
+				state, _ := GetCircuitState("foo")
+				states <- state
+			})
+			cb.setOpen(causeErrors)
+			So(<-states, ShouldEqual, CircuitOpen)
+		})
+
+		Convey("a handler may run a new command when a dashboard read opens the circuit", func() {
+			var handled int32
+			OnStateChange("foo", func(from, to CircuitState) {
+				// each command is new, so its circuit has to be created
+				name := fmt.Sprintf("foo-handler-%d", atomic.AddInt32(&handled, 1))
+				Do(name, func() error { return nil }, nil)
+			})
+			cb.metrics = metricFailingPercent(100)
+			returns := func(read func()) bool {
+				done := make(chan struct{})
+				go func() {
+					read()
+					close(done)
+				}()
+				select {
+				case <-done:
+					return true
+				case <-time.After(time.Second):
+					return false
+				}
+			}
+
+			So(returns(func() { takeSnapshot() }), ShouldBeTrue)
+			cb.setClose()
+			cb.metrics = metricFailingPercent(100)
+			So(returns(func() { streamEvents(nil) }), ShouldBeTrue)
+		})
+	})
+}
+
 func TestReportEventOpenThenClose(t *testing.T) {
 	Convey("when a circuit is closed", t, func() {
 		defer Flush()
@@ -80,7 +654,7 @@ func TestReportEventOpenThenClose(t *testing.T) {
 		cb, _, err := GetCircuit("")
 		So(err, ShouldEqual, nil)
 		So(cb.IsOpen(), ShouldBeFalse)
-		openedTime := cb.openedOrLastTestedTime
+		openedTime := cb.store.Load("").OpenedOrLastTested
 
 		Convey("but the metrics are unhealthy", func() {
 			cb.metrics = metricFailingPercent(100)
@@ -91,13 +665,32 @@ func TestReportEventOpenThenClose(t *testing.T) {
 				So(err, ShouldEqual, nil)
 
 				Convey("the circuit does not open then close", func() {
-					So(cb.openedOrLastTestedTime, ShouldEqual, openedTime)
+					So(cb.store.Load("").OpenedOrLastTested, ShouldEqual, openedTime)
 				})
 			})
 		})
 	})
 }
 
+func TestReportEventMultipleTypes(t *testing.T) {
+	Convey("when a queued failure served by its fallback is reported in one call", t, func() {
+		defer Flush()
+
+		cb, _, _ := GetCircuit("multiple-events")
+		err := cb.ReportEvent([]string{"failure", "queued", "fallback-success"}, time.Now(), 20*time.Millisecond)
+		So(err, ShouldBeNil)
+
+		Convey("it counts as a single attempt with a single latency sample", func() {
+			snapshot, _ := Metrics("multiple-events")
+			So(snapshot.Attempts, ShouldEqual, 1)
+			So(snapshot.Failures, ShouldEqual, 1)
+			So(snapshot.FallbackSuccesses, ShouldEqual, 1)
+			So(cb.metrics.DefaultCollector().Queued().Sum(time.Now()), ShouldEqual, 1)
+			So(cb.metrics.runDuration().SortedDurations(), ShouldResemble, []time.Duration{20 * time.Millisecond})
+		})
+	})
+}
+
 func TestReportEventMultiThreaded(t *testing.T) {
 	rand.Seed(time.Now().UnixNano())
 	run := func() bool {
@@ -148,3 +741,436 @@ func TestReportEventMultiThreaded(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestFlushStopsMonitors(t *testing.T) {
+	Convey("when many circuits are created and flushed", t, func() {
+		Flush()
+		time.Sleep(10 * time.Millisecond)
+		baseline := runtime.NumGoroutine()
+
+		for i := 0; i < 100; i++ {
+			_, _, err := GetCircuit(fmt.Sprintf("flush-%d", i))
+			So(err, ShouldBeNil)
+		}
+		So(runtime.NumGoroutine(), ShouldBeGreaterThanOrEqualTo, baseline+200)
+
+		Flush()
+
+		Convey("their monitor goroutines exit", func() {
+			time.Sleep(50 * time.Millisecond)
+			So(runtime.NumGoroutine(), ShouldBeLessThanOrEqualTo, baseline)
+		})
+	})
+}
+
+func TestRequestVolumePerSecond(t *testing.T) {
+	Convey("given a circuit requiring 1 request per second over a 10 second window", t, func() {
+		defer Flush()
+
+		ConfigureCommand("rate", CommandConfig{RequestVolumePerSecond: 1, ErrorPercentThreshold: 50})
+		cb, _, _ := GetCircuit("rate")
+		fail := func() error {
+			return fmt.Errorf("fail")
+		}
+
+		Convey("5 failures are not enough to open it", func() {
+			for i := 0; i < 5; i++ {
+				Do("rate", fail, nil)
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			So(cb.IsOpen(), ShouldBeFalse)
+		})
+
+		Convey("10 failures open it", func() {
+			for i := 0; i < 10; i++ {
+				Do("rate", fail, nil)
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			So(cb.IsOpen(), ShouldBeTrue)
+		})
+	})
+}
+
+func TestConsecutiveFailureThreshold(t *testing.T) {
+	Convey("with a low-volume command which opens after 3 failures in a row", t, func() {
+		defer Flush()
+
+		ConfigureCommand("consecutive", CommandConfig{ConsecutiveFailureThreshold: 3, ErrorPercentThreshold: 100})
+		fail := func() {
+			Do("consecutive", func() error { return fmt.Errorf("boom") }, nil)
+		}
+		succeed := func() {
+			Do("consecutive", func() error { return nil }, nil)
+		}
+		cb, _, _ := GetCircuit("consecutive")
+
+		Convey("3 failures in a row open it well below the volume threshold", func() {
+			fail()
+			fail()
+			fail()
+			Metrics("consecutive")
+			So(cb.metrics.ConsecutiveFailures(), ShouldEqual, 3)
+			So(cb.IsOpen(), ShouldBeTrue)
+
+			report, _ := Health("consecutive")
+			So(report.Reason, ShouldStartWith, "opened by consecutive failures")
+		})
+
+		Convey("a success resets the count", func() {
+			fail()
+			fail()
+			succeed()
+			fail()
+			fail()
+			Metrics("consecutive")
+			So(cb.metrics.ConsecutiveFailures(), ShouldEqual, 2)
+			So(cb.IsOpen(), ShouldBeFalse)
+
+			report, _ := Health("consecutive")
+			So(report.ConsecutiveFailures, ShouldEqual, 2)
+			So(report.ConsecutiveFailureThreshold, ShouldEqual, 3)
+		})
+	})
+}
+
+func TestLatencyThreshold(t *testing.T) {
+	Convey("with a command which opens once its p99 latency reaches 5ms", t, func() {
+		defer Flush()
+
+		ConfigureCommand("latency", CommandConfig{RequestVolumeThreshold: 5, LatencyThreshold: 5})
+		run := func(d time.Duration) {
+			Do("latency", func() error {
+				time.Sleep(d)
+				return nil
+			}, nil)
+		}
+		cb, _, _ := GetCircuit("latency")
+
+		Convey("slow executions open it without any errors", func() {
+			for i := 0; i < 5; i++ {
+				run(20 * time.Millisecond)
+			}
+			report, _ := Health("latency")
+			So(report.ErrorPercent, ShouldEqual, 0)
+			So(report.Latency, ShouldBeGreaterThanOrEqualTo, 5*time.Millisecond)
+			So(report.Reason, ShouldContainSubstring, "p99 latency")
+			So(cb.IsOpen(), ShouldBeTrue)
+
+			report, _ = Health("latency")
+			So(report.Reason, ShouldStartWith, "opened by latency")
+		})
+
+		Convey("slow executions below the volume threshold don't", func() {
+			for i := 0; i < 4; i++ {
+				run(20 * time.Millisecond)
+			}
+			Metrics("latency")
+			So(cb.IsOpen(), ShouldBeFalse)
+		})
+
+		Convey("fast executions don't", func() {
+			for i := 0; i < 5; i++ {
+				run(0)
+			}
+			Metrics("latency")
+			So(cb.IsOpen(), ShouldBeFalse)
+		})
+	})
+
+	Convey("the latency threshold is disabled by default", t, func() {
+		defer Flush()
+
+		ConfigureCommand("latency-default", CommandConfig{RequestVolumeThreshold: 5})
+		for i := 0; i < 5; i++ {
+			Do("latency-default", func() error {
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			}, nil)
+		}
+		cb, _, _ := GetCircuit("latency-default")
+		Metrics("latency-default")
+		So(cb.IsOpen(), ShouldBeFalse)
+		So(getSettings("latency-default").LatencyPercentile, ShouldEqual, DefaultLatencyPercentile)
+	})
+}
+
+func TestBlockCommand(t *testing.T) {
+	Convey("with a blocked command", t, func() {
+		defer Flush()
+
+		ConfigureCommand("blocked", CommandConfig{RequestVolumeThreshold: 5})
+		So(BlockCommand("blocked"), ShouldBeNil)
+
+		var fallbackErr error
+		err := Do("blocked", func() error { return nil }, func(err error) error {
+			fallbackErr = err
+			return err
+		})
+
+		Convey("executions are sent to the fallback with ErrCommandBlocked", func() {
+			So(errors.Is(fallbackErr, ErrCommandBlocked), ShouldBeTrue)
+			So(errors.Is(err, ErrCommandBlocked), ShouldBeTrue)
+			allowed, _ := AllowRequest("blocked")
+			So(allowed, ShouldBeFalse)
+		})
+
+		Convey("they are recorded as blocked without touching the circuit", func() {
+			for i := 0; i < 10; i++ {
+				Do("blocked", func() error { return nil }, nil)
+			}
+			snapshot, _ := Metrics("blocked")
+			So(snapshot.Blocked, ShouldEqual, 11)
+			So(snapshot.Attempts, ShouldEqual, 0)
+			So(snapshot.ShortCircuits, ShouldEqual, 0)
+
+			cb, _, _ := GetCircuit("blocked")
+			So(cb.State(), ShouldEqual, CircuitClosed)
+		})
+
+		Convey("once unblocked, executions run again", func() {
+			So(UnblockCommand("blocked"), ShouldBeNil)
+			So(Do("blocked", func() error { return nil }, nil), ShouldBeNil)
+		})
+	})
+}
+
+func TestResetCircuit(t *testing.T) {
+	Convey("with a circuit opened by failures", t, func() {
+		defer Flush()
+
+		ConfigureCommand("reset", CommandConfig{RequestVolumeThreshold: 5, SleepWindow: 60000})
+		for i := 0; i < 6; i++ {
+			Do("reset", func() error { return fmt.Errorf("boom") }, nil)
+		}
+		cb, _, _ := GetCircuit("reset")
+		cb.metrics.flush()
+		So(cb.IsOpen(), ShouldBeTrue)
+
+		var changes []CircuitState
+		OnStateChange("reset", func(from, to CircuitState) {
+			changes = append(changes, to)
+		})
+
+		Convey("ResetCircuit() closes it and forgets its history", func() {
+			So(ResetCircuit("reset"), ShouldBeNil)
+			So(cb.State(), ShouldEqual, CircuitClosed)
+			So(changes, ShouldResemble, []CircuitState{CircuitClosed})
+
+			snapshot, _ := Metrics("reset")
+			So(snapshot.Attempts, ShouldEqual, 0)
+			So(snapshot.Failures, ShouldEqual, 0)
+
+			Convey("while keeping its settings", func() {
+				So(getSettings("reset").RequestVolumeThreshold, ShouldEqual, 5)
+				So(Do("reset", func() error { return nil }, nil), ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("resetting an unknown circuit returns an error", t, func() {
+		So(ResetCircuit("reset-unknown"), ShouldResemble, ErrUnknownCircuit)
+	})
+}
+
+func TestMonitorOnly(t *testing.T) {
+	Convey("with a monitor-only command which would open after 5 failures", t, func() {
+		defer Flush()
+
+		ConfigureCommand("monitor", CommandConfig{RequestVolumeThreshold: 5, MonitorOnly: true})
+		for i := 0; i < 10; i++ {
+			Do("monitor", func() error { return fmt.Errorf("boom") }, nil)
+		}
+
+		Convey("every request still runs and the circuit stays closed", func() {
+			ran := false
+			err := Do("monitor", func() error {
+				ran = true
+				return nil
+			}, nil)
+			So(err, ShouldBeNil)
+			So(ran, ShouldBeTrue)
+
+			snapshot, _ := Metrics("monitor")
+			So(snapshot.Failures, ShouldEqual, 10)
+			So(snapshot.ShortCircuits, ShouldEqual, 0)
+			So(snapshot.ErrorPercent, ShouldEqual, 91)
+			So(snapshot.Open, ShouldBeFalse)
+		})
+
+		Convey("the circuit opens once monitoring ends", func() {
+			ConfigureCommand("monitor", CommandConfig{RequestVolumeThreshold: 5})
+			cb, _, _ := GetCircuit("monitor")
+			So(cb.AllowRequest(), ShouldBeFalse)
+		})
+
+		Convey("ForceOpen still short-circuits it", func() {
+			ForceOpen("monitor")
+			err := Do("monitor", func() error { return nil }, nil)
+			So(errors.Is(err, ErrCircuitOpen), ShouldBeTrue)
+		})
+	})
+}
+
+func TestAllowRequestPrecheck(t *testing.T) {
+	Convey("with a command which opens after 5 failures", t, func() {
+		defer Flush()
+
+		ConfigureCommand("precheck", CommandConfig{RequestVolumeThreshold: 5, SleepWindow: 10})
+
+		Convey("an unknown command returns ErrUnknownCircuit without creating its circuit", func() {
+			_, err := AllowRequest("precheck")
+			So(err, ShouldResemble, ErrUnknownCircuit)
+			So(CircuitNames(), ShouldNotContain, "precheck")
+		})
+
+		Convey("a healthy circuit allows requests", func() {
+			GetCircuit("precheck")
+			allowed, err := AllowRequest("precheck")
+			So(err, ShouldBeNil)
+			So(allowed, ShouldBeTrue)
+		})
+
+		Convey("after enough failures", func() {
+			for i := 0; i < 5; i++ {
+				Do("precheck", func() error { return fmt.Errorf("boom") }, nil)
+			}
+			cb, _, _ := GetCircuit("precheck")
+			cb.metrics.flush()
+
+			Convey("requests are turned away without opening the circuit", func() {
+				allowed, _ := AllowRequest("precheck")
+				So(allowed, ShouldBeFalse)
+				So(cb.State(), ShouldEqual, CircuitClosed)
+			})
+
+			Convey("once half-open, checking doesn't use up the test request", func() {
+				So(cb.IsOpen(), ShouldBeTrue)
+				time.Sleep(20 * time.Millisecond)
+				openedOrLastTested := cb.store.Load("precheck").OpenedOrLastTested
+
+				allowed, _ := AllowRequest("precheck")
+				So(allowed, ShouldBeTrue)
+				allowed, _ = AllowRequest("precheck")
+				So(allowed, ShouldBeTrue)
+				So(cb.store.Load("precheck").OpenedOrLastTested, ShouldEqual, openedOrLastTested)
+
+				So(cb.AllowRequest(), ShouldBeTrue)
+				allowed, _ = AllowRequest("precheck")
+				So(allowed, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestTimeUntilHalfOpen(t *testing.T) {
+	Convey("with a command whose sleep window is 100ms", t, func() {
+		defer Flush()
+		fake := newFakeClock()
+		defer setClock(setClock(fake))
+
+		ConfigureCommand("until-half-open", CommandConfig{SleepWindow: 100})
+		cb, _, _ := GetCircuit("until-half-open")
+
+		Convey("a closed circuit allows a request straight away", func() {
+			wait, err := TimeUntilHalfOpen("until-half-open")
+			So(err, ShouldBeNil)
+			So(wait, ShouldEqual, 0)
+		})
+
+		Convey("an open circuit counts down to the end of its sleep window", func() {
+			cb.setOpen(causeErrors)
+			fake.Advance(30 * time.Millisecond)
+
+			wait, _ := TimeUntilHalfOpen("until-half-open")
+			So(wait, ShouldEqual, 70*time.Millisecond)
+			So(cb.State(), ShouldEqual, CircuitOpen)
+
+			fake.Advance(80 * time.Millisecond)
+			wait, _ = TimeUntilHalfOpen("until-half-open")
+			So(wait, ShouldEqual, 0)
+			So(cb.State(), ShouldEqual, CircuitHalfOpen)
+		})
+
+		Convey("a forced-open circuit reports a whole sleep window", func() {
+			ForceOpen("until-half-open")
+			defer ClearForced("until-half-open")
+
+			wait, _ := TimeUntilHalfOpen("until-half-open")
+			So(wait, ShouldEqual, 100*time.Millisecond)
+		})
+
+		Convey("an unknown command returns ErrUnknownCircuit without creating its circuit", func() {
+			_, err := TimeUntilHalfOpen("until-half-open-unknown")
+			So(err, ShouldResemble, ErrUnknownCircuit)
+			So(CircuitNames(), ShouldNotContain, "until-half-open-unknown")
+		})
+	})
+}
+
+func TestWarmup(t *testing.T) {
+	Convey("when commands are warmed up before they run", t, func() {
+		defer Flush()
+
+		ConfigureCommand("warm-a", CommandConfig{MaxConcurrentRequests: 3})
+		So(Warmup("warm-a", "warm-b"), ShouldBeNil)
+
+		Convey("their circuits and pools already exist", func() {
+			So(CircuitNames(), ShouldResemble, []string{"warm-a", "warm-b"})
+			cb, created, _ := GetCircuit("warm-a")
+			So(created, ShouldBeFalse)
+			So(cb.executorPool.Max, ShouldEqual, 3)
+		})
+
+		Convey("warming them up again keeps the same circuits", func() {
+			cb, _, _ := GetCircuit("warm-b")
+			So(Warmup("warm-b"), ShouldBeNil)
+			again, _, _ := GetCircuit("warm-b")
+			So(again, ShouldEqual, cb)
+		})
+	})
+}
+
+func TestGetCircuitStress(t *testing.T) {
+	Convey("when 1000 goroutines ask for a new circuit at once", t, func() {
+		Flush()
+		time.Sleep(10 * time.Millisecond)
+		baseline := runtime.NumGoroutine()
+
+		numThreads := 1000
+		circuits := make([]*CircuitBreaker, numThreads)
+		var numCreates int32
+		var startingLine, finishLine sync.WaitGroup
+		startingLine.Add(1)
+		finishLine.Add(numThreads)
+		for i := 0; i < numThreads; i++ {
+			go func(i int) {
+				defer finishLine.Done()
+				startingLine.Wait()
+
+				cb, created, err := GetCircuit("stress")
+				if err == nil && created {
+					atomic.AddInt32(&numCreates, 1)
+				}
+				circuits[i] = cb
+			}(i)
+		}
+		startingLine.Done()
+		finishLine.Wait()
+		defer Flush()
+
+		Convey("exactly one circuit is created and handed to all of them", func() {
+			So(numCreates, ShouldEqual, int32(1))
+			for _, cb := range circuits {
+				So(cb, ShouldEqual, circuits[0])
+			}
+			So(CircuitNames(), ShouldResemble, []string{"stress"})
+		})
+
+		Convey("only that circuit's metrics goroutines are left running", func() {
+			time.Sleep(50 * time.Millisecond)
+			So(runtime.NumGoroutine(), ShouldBeLessThanOrEqualTo, baseline+2)
+		})
+	})
+}
@@ -0,0 +1,71 @@
+package hystrix
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// clock provides the current time and timers to commands and circuits, so that tests can control
+// the passage of time instead of sleeping.
+type clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) clockTimer
+	After(d time.Duration) <-chan time.Time
+	// AfterFunc calls f in its own goroutine once d has elapsed, unless the returned timer is stopped
+	// first. The timer's channel is not used.
+	AfterFunc(d time.Duration, f func()) clockTimer
+}
+
+// clockTimer is the subset of time.Timer used by commands.
+type clockTimer interface {
+	Chan() <-chan time.Time
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) clockTimer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) clockTimer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) Chan() <-chan time.Time {
+	return t.C
+}
+
+// clockHolder gives every value stored in currentClock the same concrete type, as atomic.Value requires.
+type clockHolder struct {
+	clock
+}
+
+var currentClock atomic.Value
+
+func init() {
+	currentClock.Store(clockHolder{realClock{}})
+}
+
+func getClock() clock {
+	return currentClock.Load().(clockHolder).clock
+}
+
+// setClock replaces the clock used by the package, returning the previous one. It is intended for tests.
+func setClock(c clock) clock {
+	previous := getClock()
+	currentClock.Store(clockHolder{c})
+	return previous
+}
@@ -0,0 +1,149 @@
+package hystrix
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeClock only moves forward when Advance is called, firing any timers which have expired.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock    *fakeClock
+	deadline time.Time
+	c        chan time.Time
+	// f, if set, is called instead of sending on c.
+	f func()
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) clockTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{clock: c, deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).Chan()
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) clockTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{clock: c, deadline: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.deadline.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		if t.f != nil {
+			go t.f()
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = pending
+}
+
+// waitForTimers blocks until n timers are pending.
+func (c *fakeClock) waitForTimers(n int) {
+	for {
+		c.mu.Lock()
+		pending := len(c.timers)
+		c.mu.Unlock()
+		if pending >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (t *fakeTimer) Chan() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	for i, pending := range t.clock.timers {
+		if pending == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func TestFakeClock(t *testing.T) {
+	Convey("with a fake clock", t, func() {
+		defer Flush()
+
+		fake := newFakeClock()
+		defer setClock(setClock(fake))
+
+		Convey("an open circuit allows a single test exactly when the sleep window elapses", func() {
+			ConfigureCommand("clock", CommandConfig{SleepWindow: 5000})
+			cb, _, err := GetCircuit("clock")
+			So(err, ShouldBeNil)
+			cb.setOpen(causeErrors)
+
+			So(cb.AllowRequest(), ShouldBeFalse)
+			fake.Advance(5000 * time.Millisecond)
+			So(cb.AllowRequest(), ShouldBeFalse)
+			fake.Advance(time.Millisecond)
+			So(cb.AllowRequest(), ShouldBeTrue)
+			So(cb.AllowRequest(), ShouldBeFalse)
+		})
+
+		Convey("a command times out once its timeout elapses", func() {
+			ConfigureCommand("clock", CommandConfig{Timeout: 1000})
+			release := make(chan bool)
+			defer close(release)
+
+			errChan := Go("clock", func() error {
+				<-release
+				return nil
+			}, nil)
+
+			fake.waitForTimers(1)
+			fake.Advance(999 * time.Millisecond)
+			So(len(errChan), ShouldEqual, 0)
+
+			fake.Advance(time.Millisecond)
+			So(errors.Is(<-errChan, ErrTimeout), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,11 @@
+//go:build go1.21
+
+package hystrix
+
+import "context"
+
+// afterFunc calls f in its own goroutine once ctx is done, unless stop is called first. stop reports
+// whether it kept f from being called.
+func afterFunc(ctx context.Context, f func()) (stop func() bool) {
+	return context.AfterFunc(ctx, f)
+}
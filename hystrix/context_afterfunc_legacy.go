@@ -0,0 +1,32 @@
+//go:build !go1.21
+
+package hystrix
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// afterFunc calls f in its own goroutine once ctx is done, unless stop is called first. stop reports
+// whether it kept f from being called. Without context.AfterFunc, a goroutine watches ctx until
+// either happens.
+func afterFunc(ctx context.Context, f func()) (stop func() bool) {
+	var settled int32
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			if atomic.CompareAndSwapInt32(&settled, 0, 1) {
+				f()
+			}
+		case <-stopped:
+		}
+	}()
+	return func() bool {
+		if !atomic.CompareAndSwapInt32(&settled, 0, 1) {
+			return false
+		}
+		close(stopped)
+		return true
+	}
+}
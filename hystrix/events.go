@@ -0,0 +1,60 @@
+package hystrix
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// eventBufferSize is how many events the channel returned by Events holds before new ones are dropped.
+const eventBufferSize = 1000
+
+// An Event is one of the events recorded for an execution of a command, as sent on the channel
+// returned by Events.
+type Event struct {
+	// Name is the name of the command.
+	Name string
+	// Type is one of the event types counted by the metric collectors, such as "success", "failure",
+	// "timeout" or "fallback-success". An execution usually records several.
+	Type string
+	// Time is when the execution was reported.
+	Time time.Time
+	// RunDuration is how long the run function took, or 0 if it didn't run.
+	RunDuration time.Duration
+}
+
+var (
+	eventsOnce sync.Once
+	// eventTap holds the channel returned by Events, once it has been called.
+	eventTap atomic.Value
+)
+
+// Events returns a channel which receives every event recorded for every command from now on, for
+// ad-hoc debugging or custom aggregation without implementing a MetricCollector. No events are
+// produced until it is first called; later calls return the same channel, which is never closed.
+//
+// The channel is buffered, and events are dropped rather than sent when it is full, since reporting
+// an execution must never wait for a slow consumer.
+func Events() <-chan Event {
+	eventsOnce.Do(func() {
+		eventTap.Store(make(chan Event, eventBufferSize))
+	})
+	return eventTap.Load().(chan Event)
+}
+
+// publishEvents sends the events of an execution to the channel returned by Events, if it has been
+// called, dropping those which don't fit.
+func publishEvents(name string, eventTypes []string, runDuration time.Duration) {
+	tap, ok := eventTap.Load().(chan Event)
+	if !ok {
+		return
+	}
+
+	now := getClock().Now()
+	for _, eventType := range eventTypes {
+		select {
+		case tap <- Event{Name: name, Type: eventType, Time: now, RunDuration: runDuration}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package hystrix
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEvents(t *testing.T) {
+	Convey("with the event channel requested", t, func() {
+		defer Flush()
+		events := Events()
+
+		Do("events", func() error {
+			return fmt.Errorf("boom")
+		}, func(err error) error {
+			return nil
+		})
+
+		Convey("it receives each event of the execution", func() {
+			var types []string
+			timeout := time.After(time.Second)
+			for len(types) < 2 {
+				select {
+				case event := <-events:
+					if event.Name != "events" {
+						continue
+					}
+					So(event.Time.IsZero(), ShouldBeFalse)
+					types = append(types, event.Type)
+				case <-timeout:
+					t.Fatal("timed out waiting for events")
+				}
+			}
+			So(types, ShouldResemble, []string{"failure", "fallback-success"})
+		})
+
+		Convey("later calls return the same channel", func() {
+			So(Events(), ShouldEqual, events)
+		})
+	})
+}
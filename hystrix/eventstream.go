@@ -2,8 +2,11 @@ package hystrix
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,23 +17,43 @@ const (
 	streamEventBufferSize = 10
 )
 
+// DefaultStreamInterval is how often a StreamHandler publishes metrics unless its Interval is set.
+const DefaultStreamInterval = 1 * time.Second
+
 // NewStreamHandler returns a server capable of exposing dashboard metrics via HTTP.
 func NewStreamHandler() *StreamHandler {
 	return &StreamHandler{}
 }
 
-// StreamHandler publishes metrics for each command and each pool once a second to all connected HTTP client.
+// NewStreamHandlerWithInterval returns a server which publishes dashboard metrics every interval.
+func NewStreamHandlerWithInterval(interval time.Duration) *StreamHandler {
+	return &StreamHandler{Interval: interval}
+}
+
+// StreamHandler publishes metrics for each command and each pool once per interval to all connected HTTP client.
 type StreamHandler struct {
-	requests map[*http.Request]chan []byte
+	// Interval is how often metrics are published. It is read by Start, and defaults to DefaultStreamInterval.
+	Interval time.Duration
+
+	// Filter, if set, limits the stream to the commands for which it returns true. A pool is published
+	// when any of its commands is. It must be set before Start.
+	Filter func(name string) bool
+
+	requests map[*http.Request]*streamClient
 	mu       sync.RWMutex
 	done     chan struct{}
 }
 
 // Start begins watching the in-memory circuit breakers for metrics
 func (sh *StreamHandler) Start() {
-	sh.requests = make(map[*http.Request]chan []byte)
+	interval := sh.Interval
+	if interval <= 0 {
+		interval = DefaultStreamInterval
+	}
+
+	sh.requests = make(map[*http.Request]*streamClient)
 	sh.done = make(chan struct{})
-	go sh.loop()
+	go sh.loop(interval)
 }
 
 // Stop shuts down the metric collection routine
@@ -61,7 +84,7 @@ func (sh *StreamHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			// client is gone
 			return
 		case event := <-events:
-			_, err := rw.Write(event)
+			err := writeEvent(rw, event)
 			if err != nil {
 				return
 			}
@@ -70,33 +93,104 @@ func (sh *StreamHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func (sh *StreamHandler) loop() {
-	tick := time.Tick(1 * time.Second)
+func (sh *StreamHandler) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case <-tick:
-			circuitBreakersMutex.RLock()
-			for _, cb := range circuitBreakers {
-				sh.publishMetrics(cb)
-				sh.publishThreadPools(cb.executorPool)
-			}
-			circuitBreakersMutex.RUnlock()
+		case <-ticker.C:
+			sh.publish()
 		case <-sh.done:
 			return
 		}
 	}
 }
 
-func (sh *StreamHandler) publishMetrics(cb *CircuitBreaker) error {
+func (sh *StreamHandler) publish() {
+	for _, event := range streamEvents(sh.Filter) {
+		sh.writeToRequests(event.commands, event.data)
+	}
+}
+
+// StreamTo writes the dashboard metrics of every command and pool to w once per interval, framed as
+// server-sent events as by the StreamHandler, until ctx is done or a write fails. It returns the error
+// which stopped it. w is flushed after each round of events if it implements http.Flusher.
+//
+// interval defaults to DefaultStreamInterval if it is not positive. filter, if not nil, limits the
+// stream as the Filter of a StreamHandler does.
+func StreamTo(ctx context.Context, w io.Writer, interval time.Duration, filter func(name string) bool) error {
+	if interval <= 0 {
+		interval = DefaultStreamInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, event := range streamEvents(filter) {
+				if err := writeEvent(w, event.data); err != nil {
+					return err
+				}
+			}
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// A streamEvent is the JSON of a single dashboard event, along with the commands it describes.
+type streamEvent struct {
+	commands []string
+	data     []byte
+}
+
+// streamEvents returns the current events for the commands accepted by filter, or for every command if
+// it is nil, and for their pools. They are gathered before any is written, so that a slow client doesn't
+// hold up the creation of circuits.
+func streamEvents(filter func(name string) bool) []streamEvent {
+	var events []streamEvent
+	var pools []*executorPool
+	poolCommands := make(map[*executorPool][]string)
+	for _, cb := range circuitsWhere(filter) {
+		if data, err := commandEvent(cb); err == nil {
+			events = append(events, streamEvent{commands: []string{cb.Name}, data: data})
+		}
+
+		// a pool shared by several commands is published once
+		if _, ok := poolCommands[cb.executorPool]; !ok {
+			pools = append(pools, cb.executorPool)
+		}
+		poolCommands[cb.executorPool] = append(poolCommands[cb.executorPool], cb.Name)
+	}
+	for _, pool := range pools {
+		if data, err := poolEvent(pool); err == nil {
+			events = append(events, streamEvent{commands: poolCommands[pool], data: data})
+		}
+	}
+	return events
+}
+
+// commandEvent returns the JSON of the dashboard event for the command of cb.
+func commandEvent(cb *CircuitBreaker) ([]byte, error) {
 	now := time.Now()
 	reqCount := cb.metrics.Requests().Sum(now)
 	errCount := cb.metrics.DefaultCollector().Errors().Sum(now)
 	errPct := cb.metrics.ErrorPercent(now)
 
-	eventBytes, err := json.Marshal(&streamCmdMetric{
+	cb.mutex.RLock()
+	forceOpen := cb.forceOpen
+	forceClosed := cb.forceClosed
+	cb.mutex.RUnlock()
+
+	return json.Marshal(&streamCmdMetric{
 		Type:           "HystrixCommand",
 		Name:           cb.Name,
-		Group:          cb.Name,
+		Group:          getSettings(cb.Name).group(cb.Name),
 		Time:           currentTime(),
 		ReportingHosts: 1,
 
@@ -120,31 +214,24 @@ func (sh *StreamHandler) publishMetrics(cb *CircuitBreaker) error {
 
 		// TODO: all hard-coded values should become configurable settings, per circuit
 
-		RollingStatsWindow:         10000,
+		RollingStatsWindow:         uint32(getSettings(cb.Name).RollingWindow / time.Millisecond),
 		ExecutionIsolationStrategy: "THREAD",
 
 		CircuitBreakerEnabled:                true,
-		CircuitBreakerForceClosed:            false,
-		CircuitBreakerForceOpen:              cb.forceOpen,
+		CircuitBreakerForceClosed:            forceClosed,
+		CircuitBreakerForceOpen:              forceOpen,
 		CircuitBreakerErrorThresholdPercent:  uint32(getSettings(cb.Name).ErrorPercentThreshold),
 		CircuitBreakerSleepWindow:            uint32(getSettings(cb.Name).SleepWindow.Seconds() * 1000),
-		CircuitBreakerRequestVolumeThreshold: uint32(getSettings(cb.Name).RequestVolumeThreshold),
+		CircuitBreakerRequestVolumeThreshold: uint32(getSettings(cb.Name).volumeThreshold()),
 	})
-	if err != nil {
-		return err
-	}
-	err = sh.writeToRequests(eventBytes)
-	if err != nil {
-		return err
-	}
-
-	return nil
 }
 
-func (sh *StreamHandler) publishThreadPools(pool *executorPool) error {
+// poolEvent returns the JSON of the dashboard event for pool.
+func poolEvent(pool *executorPool) ([]byte, error) {
 	now := time.Now()
+	max := pool.size()
 
-	eventBytes, err := json.Marshal(&streamThreadPoolMetric{
+	return json.Marshal(&streamThreadPoolMetric{
 		Type:           "HystrixThreadPool",
 		Name:           pool.Name,
 		ReportingHosts: 1,
@@ -153,47 +240,31 @@ func (sh *StreamHandler) publishThreadPools(pool *executorPool) error {
 		CurrentTaskCount:          0,
 		CurrentCompletedTaskCount: 0,
 
-		RollingCountThreadsExecuted: uint32(pool.Metrics.Executed.Sum(now)),
-		RollingMaxActiveThreads:     uint32(pool.Metrics.MaxActiveRequests.Max(now)),
+		RollingCountThreadsExecuted: uint32(pool.Metrics.executed(now)),
+		RollingMaxActiveThreads:     uint32(pool.Metrics.maxActiveRequests(now)),
 
-		CurrentPoolSize:        uint32(pool.Max),
-		CurrentCorePoolSize:    uint32(pool.Max),
-		CurrentLargestPoolSize: uint32(pool.Max),
-		CurrentMaximumPoolSize: uint32(pool.Max),
+		CurrentPoolSize:        uint32(max),
+		CurrentCorePoolSize:    uint32(max),
+		CurrentLargestPoolSize: uint32(max),
+		CurrentMaximumPoolSize: uint32(max),
 
-		RollingStatsWindow:          10000,
-		QueueSizeRejectionThreshold: 0,
-		CurrentQueueSize:            0,
+		RollingStatsWindow:          uint32(getSettings(pool.Name).RollingWindow / time.Millisecond),
+		QueueSizeRejectionThreshold: uint32(getSettings(pool.Name).MaxQueueSize),
+		CurrentQueueSize:            uint32(pool.queueLength()),
 	})
-	if err != nil {
-		return err
-	}
-	err = sh.writeToRequests(eventBytes)
-
-	return nil
 }
 
-func (sh *StreamHandler) writeToRequests(eventBytes []byte) error {
-	var b bytes.Buffer
-	_, err := b.Write([]byte("data:"))
-	if err != nil {
-		return err
-	}
-
-	_, err = b.Write(eventBytes)
-	if err != nil {
-		return err
-	}
-	_, err = b.Write([]byte("\n\n"))
-	if err != nil {
-		return err
-	}
-	dataBytes := b.Bytes()
+// writeToRequests hands the JSON of an event about the named commands to every connected client
+// which wants them. Each transport frames it for the wire itself.
+func (sh *StreamHandler) writeToRequests(commands []string, eventBytes []byte) error {
 	sh.mu.RLock()
 
-	for _, requestEvents := range sh.requests {
+	for _, client := range sh.requests {
+		if !client.wants(commands) {
+			continue
+		}
 		select {
-		case requestEvents <- dataBytes:
+		case client.events <- eventBytes:
 		default:
 		}
 	}
@@ -202,19 +273,61 @@ func (sh *StreamHandler) writeToRequests(eventBytes []byte) error {
 	return nil
 }
 
+// sseFrame wraps the JSON of an event as a server-sent event.
+func sseFrame(eventBytes []byte) []byte {
+	var b bytes.Buffer
+	b.Grow(len(eventBytes) + 7)
+	b.WriteString("data:")
+	b.Write(eventBytes)
+	b.WriteString("\n\n")
+	return b.Bytes()
+}
+
+// writeEvent writes the JSON of an event to w as a server-sent event.
+func writeEvent(w io.Writer, eventBytes []byte) error {
+	_, err := w.Write(sseFrame(eventBytes))
+	return err
+}
+
+// streamClient is a connected client, which receives the events of the commands starting with
+// any of its prefixes, or of all commands if it has none.
+type streamClient struct {
+	events   chan []byte
+	prefixes []string
+}
+
+func (c *streamClient) wants(commands []string) bool {
+	if len(c.prefixes) == 0 {
+		return true
+	}
+	for _, name := range commands {
+		for _, prefix := range c.prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// register adds a client for req. Each "command" query parameter of the request limits the client
+// to the commands whose names start with it.
 func (sh *StreamHandler) register(req *http.Request) <-chan []byte {
 	sh.mu.RLock()
-	events, ok := sh.requests[req]
+	client, ok := sh.requests[req]
 	sh.mu.RUnlock()
 	if ok {
-		return events
+		return client.events
 	}
 
-	events = make(chan []byte, streamEventBufferSize)
+	client = &streamClient{
+		events:   make(chan []byte, streamEventBufferSize),
+		prefixes: req.URL.Query()["command"],
+	}
 	sh.mu.Lock()
-	sh.requests[req] = events
+	sh.requests[req] = client
 	sh.mu.Unlock()
-	return events
+	return client.events
 }
 
 func (sh *StreamHandler) unregister(req *http.Request) {
@@ -223,6 +336,15 @@ func (sh *StreamHandler) unregister(req *http.Request) {
 	sh.mu.Unlock()
 }
 
+// Subscribe adds a client for req to the stream, as ServeHTTP does, for transports other than
+// server-sent events. It returns the JSON of each event published to the client, without framing, and
+// a function which removes the client once it is gone. As on ServeHTTP, each "command" query
+// parameter of the request limits the client to the commands whose names start with it, and events
+// are dropped rather than queued for a client which falls behind. Start must have been called.
+func (sh *StreamHandler) Subscribe(req *http.Request) (events <-chan []byte, unsubscribe func()) {
+	return sh.register(req), func() { sh.unregister(req) }
+}
+
 func generateLatencyTimings(r *rolling.Timing) streamCmdLatency {
 	return streamCmdLatency{
 		Timing0:   r.Percentile(0),
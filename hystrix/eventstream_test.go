@@ -1,6 +1,8 @@
 package hystrix
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -268,3 +270,156 @@ func TestThreadPoolStream(t *testing.T) {
 		})
 	})
 }
+
+func TestStreamInterval(t *testing.T) {
+	Convey("given an event stream publishing every 20 milliseconds", t, func() {
+		defer Flush()
+
+		sh := NewStreamHandlerWithInterval(20 * time.Millisecond)
+		sh.Start()
+		sleepingCommand(t, "interval", 1*time.Millisecond)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		events := sh.register(req)
+
+		Convey("metrics are published more often than the default interval", func() {
+			defer sh.Stop()
+
+			start := time.Now()
+			for i := 0; i < 4; i++ {
+				<-events
+			}
+			So(time.Since(start), ShouldBeLessThan, DefaultStreamInterval)
+		})
+
+		Convey("metrics stop being published once the stream is stopped", func() {
+			<-events
+			sh.Stop()
+			time.Sleep(30 * time.Millisecond)
+			for len(events) > 0 {
+				<-events
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			So(len(events), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestStreamFilter(t *testing.T) {
+	Convey("given commands named users.get, users.list and orders.get", t, func() {
+		defer Flush()
+
+		for _, name := range []string{"users.get", "users.list", "orders.get"} {
+			sleepingCommand(t, name, 1*time.Millisecond)
+		}
+
+		// names collects the commands reported by the next few rounds of events.
+		names := func(events <-chan []byte) map[string]bool {
+			seen := make(map[string]bool)
+			for i := 0; i < 12; i++ {
+				var event streamCmdMetric
+				So(json.Unmarshal(<-events, &event), ShouldBeNil)
+				if event.Type == "HystrixCommand" {
+					seen[event.Name] = true
+				}
+			}
+			return seen
+		}
+
+		Convey("a Filter limits the stream to the commands it accepts", func() {
+			sh := NewStreamHandlerWithInterval(10 * time.Millisecond)
+			sh.Filter = func(name string) bool { return name != "orders.get" }
+			sh.Start()
+			defer sh.Stop()
+
+			events := sh.register(httptest.NewRequest("GET", "/", nil))
+			So(names(events), ShouldResemble, map[string]bool{"users.get": true, "users.list": true})
+		})
+
+		Convey("a command query parameter limits a client to the commands with that prefix", func() {
+			sh := NewStreamHandlerWithInterval(10 * time.Millisecond)
+			sh.Start()
+			defer sh.Stop()
+
+			events := sh.register(httptest.NewRequest("GET", "/?command=users.&command=orders.get", nil))
+			So(names(events), ShouldResemble, map[string]bool{"users.get": true, "users.list": true, "orders.get": true})
+
+			events = sh.register(httptest.NewRequest("GET", "/?command=orders.", nil))
+			So(names(events), ShouldResemble, map[string]bool{"orders.get": true})
+		})
+
+		Convey("Subscribe returns the unframed events of a client until it unsubscribes", func() {
+			sh := NewStreamHandlerWithInterval(10 * time.Millisecond)
+			sh.Start()
+			defer sh.Stop()
+
+			req := httptest.NewRequest("GET", "/?command=users.get", nil)
+			events, unsubscribe := sh.Subscribe(req)
+			So(names(events), ShouldResemble, map[string]bool{"users.get": true})
+
+			unsubscribe()
+			sh.mu.RLock()
+			defer sh.mu.RUnlock()
+			So(sh.requests, ShouldHaveLength, 0)
+		})
+	})
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("broken pipe")
+}
+
+func TestStreamTo(t *testing.T) {
+	Convey("given a command with metrics", t, func() {
+		defer Flush()
+
+		sleepingCommand(t, "streamto", 1*time.Millisecond)
+
+		Convey("StreamTo writes server-sent events to a writer until the context is done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			var buf bytes.Buffer
+			err := StreamTo(ctx, &buf, 10*time.Millisecond, nil)
+			So(err, ShouldEqual, context.DeadlineExceeded)
+
+			frames := strings.Split(strings.TrimSuffix(buf.String(), "\n\n"), "\n\n")
+			So(len(frames), ShouldBeGreaterThanOrEqualTo, 2)
+
+			var event streamCmdMetric
+			So(strings.HasPrefix(frames[0], "data:"), ShouldBeTrue)
+			So(json.Unmarshal([]byte(strings.TrimPrefix(frames[0], "data:")), &event), ShouldBeNil)
+			So(event.Type, ShouldEqual, "HystrixCommand")
+			So(event.Name, ShouldEqual, "streamto")
+		})
+
+		Convey("StreamTo returns the error of a failed write", func() {
+			err := StreamTo(context.Background(), failingWriter{}, 10*time.Millisecond, nil)
+			So(err.Error(), ShouldEqual, "broken pipe")
+		})
+
+		Convey("StreamTo only writes the commands accepted by its filter", func() {
+			sleepingCommand(t, "streamto-other", 1*time.Millisecond)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			var buf bytes.Buffer
+			StreamTo(ctx, &buf, 10*time.Millisecond, func(name string) bool { return name == "streamto" })
+			So(buf.String(), ShouldContainSubstring, `"name":"streamto"`)
+			So(strings.Contains(buf.String(), "streamto-other"), ShouldBeFalse)
+		})
+
+		Convey("StreamTo publishes every DefaultStreamInterval without an interval", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			var buf bytes.Buffer
+			err := StreamTo(ctx, &buf, 0, nil)
+			So(err, ShouldEqual, context.DeadlineExceeded)
+			So(buf.Len(), ShouldEqual, 0)
+		})
+	})
+}
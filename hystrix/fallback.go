@@ -0,0 +1,44 @@
+package hystrix
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// A DefaultFallback is the fallback of every command executed without one. name is the name of the
+// command, and err the error which triggered it, as for any fallback.
+type DefaultFallback func(name string, err error) error
+
+// defaultFallbacks gives every value stored in currentDefaultFallback the same concrete type, as
+// atomic.Value requires.
+type defaultFallbacks struct {
+	fallback DefaultFallback
+}
+
+var currentDefaultFallback atomic.Value
+
+func init() {
+	currentDefaultFallback.Store(defaultFallbacks{})
+}
+
+// SetDefaultFallback installs fallback for every command executed afterwards without a fallback of its
+// own, replacing any previous default. Passing nil removes it, so that such commands return their
+// errors again. A fallback passed to the command always takes precedence.
+//
+// The default fallback is recorded and wrapped like any other: it counts as a fallback success or
+// failure, and may return ErrFallbackDegraded. Typed commands such as DoTyped return the zero value of
+// T when it succeeds.
+func SetDefaultFallback(fallback DefaultFallback) {
+	currentDefaultFallback.Store(defaultFallbacks{fallback: fallback})
+}
+
+// defaultFallbackFor returns the default fallback bound to the named command, or nil if none is installed.
+func defaultFallbackFor(name string) fallbackFuncC {
+	fallback := currentDefaultFallback.Load().(defaultFallbacks).fallback
+	if fallback == nil {
+		return nil
+	}
+	return func(ctx context.Context, err error) error {
+		return fallback(name, err)
+	}
+}
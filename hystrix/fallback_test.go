@@ -0,0 +1,71 @@
+package hystrix
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDefaultFallback(t *testing.T) {
+	Convey("with a default fallback installed", t, func() {
+		defer Flush()
+		defer SetDefaultFallback(nil)
+
+		var names []string
+		SetDefaultFallback(func(name string, err error) error {
+			names = append(names, name)
+			return nil
+		})
+		failing := func() error {
+			return fmt.Errorf("boom")
+		}
+
+		Convey("a command without a fallback is covered by it", func() {
+			So(Do("default-fallback", failing, nil), ShouldBeNil)
+			So(names, ShouldResemble, []string{"default-fallback"})
+
+			snapshot, _ := Metrics("default-fallback")
+			So(snapshot.FallbackSuccesses, ShouldEqual, 1)
+			So(snapshot.NoFallback, ShouldEqual, 0)
+		})
+
+		Convey("a command with its own fallback uses that instead", func() {
+			errFallback := errors.New("own fallback")
+			err := Do("default-fallback", failing, func(err error) error {
+				return errFallback
+			})
+			var fe FallbackError
+			So(errors.As(err, &fe), ShouldBeTrue)
+			So(fe.Fallback(), ShouldEqual, errFallback)
+			So(names, ShouldHaveLength, 0)
+		})
+
+		Convey("typed commands return the zero value", func() {
+			result, err := DoTyped("default-fallback", func() (int, error) {
+				return 1, fmt.Errorf("boom")
+			}, nil)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, 0)
+		})
+
+		Convey("its failure is returned like that of any fallback", func() {
+			SetDefaultFallback(func(name string, err error) error {
+				return fmt.Errorf("no cached response")
+			})
+			err := Do("default-fallback", failing, nil)
+			var fe FallbackError
+			So(errors.As(err, &fe), ShouldBeTrue)
+			So(fe.Fallback().Error(), ShouldEqual, "no cached response")
+		})
+	})
+
+	Convey("once the default fallback is removed, errors are returned again", t, func() {
+		defer Flush()
+
+		SetDefaultFallback(func(name string, err error) error { return nil })
+		SetDefaultFallback(nil)
+		So(Do("default-fallback-removed", func() error { return fmt.Errorf("boom") }, nil).Error(), ShouldEqual, "boom")
+	})
+}
@@ -2,8 +2,10 @@ package hystrix
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,42 +18,155 @@ type fallbackFuncC func(context.Context, error) error
 // such as the circuit being open or a timeout.
 type CircuitError struct {
 	Message string
+	// Name is the command which failed. It is set on the errors passed to fallbacks and returned by
+	// commands, and empty on the sentinel errors below.
+	Name string
 }
 
 func (e CircuitError) Error() string {
+	if e.Name != "" {
+		return "hystrix: " + e.Message + " (command: " + e.Name + ")"
+	}
 	return "hystrix: " + e.Message
 }
 
+// Is reports whether target is a CircuitError for the same failure state, which allows
+// errors.Is to match the sentinel errors even after they have been wrapped, whatever the command.
+// A target with a Name only matches errors of that command.
+func (e CircuitError) Is(target error) bool {
+	t, ok := target.(CircuitError)
+	return ok && t.Message == e.Message && (t.Name == "" || t.Name == e.Name)
+}
+
+// IsCircuitError returns the CircuitError which err is or wraps, if any. It lets a fallback tell a
+// rejection by hystrix, such as ErrCircuitOpen or ErrTimeout, apart from an error returned by run.
+// A panic in run is also reported as a CircuitError, whose Message starts with "panic: ".
+func IsCircuitError(err error) (CircuitError, bool) {
+	var circuitErr CircuitError
+	if errors.As(err, &circuitErr) {
+		return circuitErr, true
+	}
+	return CircuitError{}, false
+}
+
 // command models the state used for a single execution on a circuit. "hystrix command" is commonly
 // used to describe the pairing of your run/fallback functions with a circuit.
 type command struct {
 	sync.Mutex
 
-	ticket      *struct{}
+	ticket      *poolTicket
+	queued      bool
+	forced      bool
 	start       time.Time
 	errChan     chan error
-	finished    chan bool
+	reported    chan struct{}
 	circuit     *CircuitBreaker
+	settings    *Settings
 	run         runFuncC
 	fallback    fallbackFuncC
 	runDuration time.Duration
-	events      []string
+	// fallbackDuration is how long the fallback took, if it ran.
+	fallbackDuration time.Duration
+	// queueWait is how long the command waited for its ticket, if it received one.
+	queueWait time.Duration
+	events    []string
+	// extraTickets are the tickets taken beyond the first by a command with a weight above 1.
+	extraTickets []*poolTicket
+	// retries counts the times run has been retried. It is updated atomically, since a command which
+	// timed out is reported while its run function may still be retrying.
+	retries int32
+	// probe is set when the circuit admitted the command as a test request while open.
+	probe bool
+
+	// The following are shared by the goroutine running the command and the callbacks watching its
+	// timeout and context, and live here rather than in closures to save allocating each of them.
+	// ticketChecked is set, under the lock, once the command has its ticket or knows it won't get one,
+	// and ticketCond is signalled then. returnOnce makes sure the outcome is settled only once.
+	ticketChecked bool
+	ticketCond    sync.Cond
+	returnOnce    sync.Once
+}
+
+// A FallbackError is returned when both the run function and the fallback of a command failed.
+// It unwraps to the run error, so errors.Is and errors.As match the original cause. They match the
+// error of the fallback too, so that a fallback can return its own typed error, such as a declined
+// payment, for callers to branch on with errors.As.
+type FallbackError struct {
+	RunErr      error
+	FallbackErr error
+}
+
+func (e FallbackError) Error() string {
+	return fmt.Sprintf("fallback failed with '%v'. run error was '%v'", e.FallbackErr, e.RunErr)
+}
+
+// Unwrap returns the error from the run function.
+func (e FallbackError) Unwrap() error {
+	return e.RunErr
+}
+
+// Fallback returns the error from the fallback.
+func (e FallbackError) Fallback() error {
+	return e.FallbackErr
 }
 
+// Is reports whether the error from the fallback matches target. errors.Is then goes on to the run error.
+func (e FallbackError) Is(target error) bool {
+	return e.FallbackErr != nil && errors.Is(e.FallbackErr, target)
+}
+
+// As finds the first error in the chain of the error from the fallback which matches target, as
+// errors.As does. errors.As then goes on to the run error.
+func (e FallbackError) As(target interface{}) bool {
+	return e.FallbackErr != nil && errors.As(e.FallbackErr, target)
+}
+
+// The following sentinel errors are safe to use with errors.Is. Each is the error passed to the
+// fallback, or returned when there is none, when a command doesn't run or doesn't finish for the
+// reason it describes, with the Name of the command set. Compare them with errors.Is rather than ==.
+// A command whose context is canceled gets context.Canceled instead, while an expired deadline is
+// reported as ErrTimeout.
 var (
 	// ErrMaxConcurrency occurs when too many of the same named command are executed at the same time.
 	ErrMaxConcurrency = CircuitError{Message: "max concurrency"}
-	// ErrCircuitOpen returns when an execution attempt "short circuits". This happens due to the circuit being measured as unhealthy.
+	// ErrCircuitOpen returns when an execution attempt "short circuits". This happens due to the
+	// circuit being measured as unhealthy.
 	ErrCircuitOpen = CircuitError{Message: "circuit open"}
 	// ErrTimeout occurs when the provided function takes too long to execute.
 	ErrTimeout = CircuitError{Message: "timeout"}
+	// ErrShuttingDown returns when a command is executed after Shutdown has been called.
+	ErrShuttingDown = CircuitError{Message: "shutting down"}
+	// ErrForcedFallback is passed to the fallback of an execution routed there by ForceFallback.
+	ErrForcedFallback = CircuitError{Message: "forced fallback"}
+	// ErrCommandBlocked returns when an execution is turned away because BlockCommand was called.
+	ErrCommandBlocked = CircuitError{Message: "command blocked"}
+	// ErrFallbackRejected returns, instead of the error which triggered the fallback, when
+	// MaxConcurrentFallbacks fallbacks of the command are already running. It is never passed to a
+	// fallback.
+	ErrFallbackRejected = CircuitError{Message: "fallback rejected"}
 )
 
+// ErrFallbackDegraded may be returned, or wrapped, by a fallback which answered with a degraded result,
+// such as stale data from a cache. The command then returns nil, as if the fallback had, but the
+// execution is recorded as a degraded fallback as well as a fallback success.
+var ErrFallbackDegraded = errors.New("hystrix: fallback degraded")
+
+// fallbackFailed reports whether err, returned by a fallback, means that the fallback failed.
+func fallbackFailed(err error) bool {
+	return err != nil && !errors.Is(err, ErrFallbackDegraded)
+}
+
+// getCircuit is how commands find their circuit. It is a variable so that tests can make it fail.
+var getCircuit = GetCircuit
+
 // Go runs your function while tracking the health of previous calls to it.
 // If your function begins slowing down or failing repeatedly, we will block
 // new calls to it for you to give the dependent service time to repair.
 //
 // Define a fallback function if you want to define some code to execute during outages.
+//
+// At most one error is ever sent on the returned channel, and nothing is sent if the command succeeds.
+// The channel has room for that error, so the command never blocks on it and it need not be read.
 func Go(name string, run runFunc, fallback fallbackFunc) chan error {
 	runC := func(ctx context.Context) error {
 		return run()
@@ -71,61 +186,293 @@ func Go(name string, run runFunc, fallback fallbackFunc) chan error {
 //
 // Define a fallback function if you want to define some code to execute during outages.
 func GoC(ctx context.Context, name string, run runFuncC, fallback fallbackFuncC) chan error {
+	return goC(ctx, name, getSettings(name), run, fallback)
+}
+
+// GoWithFallbacks runs your function like Go, but tries each fallback in order until one succeeds.
+// Each fallback is passed the error of the step before it, starting with the error from run.
+//
+// The chain is reported as a single fallback, which only fails if every fallback in it fails.
+func GoWithFallbacks(name string, run runFunc, fallbacks ...fallbackFunc) chan error {
+	var fallback fallbackFunc
+	if len(fallbacks) > 0 {
+		fallback = chainFallbacks(fallbacks)
+	}
+	return Go(name, run, fallback)
+}
+
+// chainFallbacks combines fallbacks into one which returns nil on the first success, or the last error.
+func chainFallbacks(fallbacks []fallbackFunc) fallbackFunc {
+	return func(err error) error {
+		for _, fallback := range fallbacks {
+			err = fallback(err)
+			if !fallbackFailed(err) {
+				return err
+			}
+		}
+		return err
+	}
+}
+
+// GoWithConfig runs your function like Go, but applies any non-zero fields of config to this
+// execution only, leaving the settings registered for name untouched. Metrics are still recorded
+// under name, so the health of the circuit is shared with every other execution of the command.
+//
+// Only the settings which affect this execution alone are honored: Timeout, MaxQueueSize,
+// QueueTimeout, IsErrorIgnorable, ErrorEvent and PropagatePanics. MaxConcurrentRequests, RequestVolumeThreshold,
+// RequestVolumePerSecond, SleepWindow, ErrorPercentThreshold and the rolling window are ignored,
+// as the executor pool and the state of the circuit are shared by every execution of the command.
+func GoWithConfig(name string, config CommandConfig, run runFunc, fallback fallbackFunc) chan error {
+	runC := func(ctx context.Context) error {
+		return run()
+	}
+	var fallbackC fallbackFuncC
+	if fallback != nil {
+		fallbackC = func(ctx context.Context, err error) error {
+			return fallback(err)
+		}
+	}
+	return goC(context.Background(), name, overrideSettings(name, config), runC, fallbackC)
+}
+
+// GoWeighted runs your function like Go, but the execution takes weight tickets from the executor pool
+// rather than one, so that heavier operations, such as a bulk query, count for more of the command's
+// MaxConcurrentRequests. If fewer than weight tickets are free the execution is rejected with
+// ErrMaxConcurrency, without queueing, and all of them are returned when it finishes. A weight below 1
+// counts as 1.
+func GoWeighted(name string, weight int, run runFunc, fallback fallbackFunc) chan error {
+	runC := func(ctx context.Context) error {
+		return run()
+	}
+	var fallbackC fallbackFuncC
+	if fallback != nil {
+		fallbackC = func(ctx context.Context, err error) error {
+			return fallback(err)
+		}
+	}
+	return startCommand(context.Background(), name, getSettings(name), runC, fallbackC, weight, nil).errChan
+}
+
+// GoWithTags runs your function like Go, and passes tags to the metric collectors of the command along
+// with the outcome of this execution, for instance to tell apart the downstream hosts served by one
+// command. The circuit, and the metrics it is judged on, are still those of the command as a whole.
+// Collectors which don't support tags ignore them.
+func GoWithTags(name string, tags map[string]string, run runFunc, fallback fallbackFunc) chan error {
+	runC := func(ctx context.Context) error {
+		return run()
+	}
+	var fallbackC fallbackFuncC
+	if fallback != nil {
+		fallbackC = func(ctx context.Context, err error) error {
+			return fallback(err)
+		}
+	}
+
+	// the collectors receive the tags after GoWithTags has returned, so they must not change meanwhile
+	copied := make(map[string]string, len(tags))
+	for key, value := range tags {
+		copied[key] = value
+	}
+	return startCommand(context.Background(), name, getSettings(name), runC, fallbackC, 1, copied).errChan
+}
+
+func goC(ctx context.Context, name string, settings *Settings, run runFuncC, fallback fallbackFuncC) chan error {
+	return startCommand(ctx, name, settings, run, fallback, 1, nil).errChan
+}
+
+// startCommand begins an execution of the command, which takes weight tickets from its pool and reports
+// tags to the metric collectors, and returns it. Its reported channel is closed once the outcome has
+// been handed to the circuit's metrics.
+func startCommand(ctx context.Context, name string, settings *Settings, run runFuncC, fallback fallbackFuncC, weight int, tags map[string]string) *command {
+	if fallback == nil {
+		fallback = defaultFallbackFor(name)
+	}
+	run, fallback = wrap(name, run, fallback)
 	cmd := &command{
+		settings: settings,
 		run:      run,
 		fallback: fallback,
-		start:    time.Now(),
+		start:    getClock().Now(),
+		// At most one error is sent: every path which sends one either returns before the run
+		// goroutine starts or runs inside returnOnce, so the buffer can never fill.
 		errChan:  make(chan error, 1),
-		finished: make(chan bool, 1),
+		reported: make(chan struct{}),
 	}
 
 	// dont have methods with explicit params and returns
 	// let data come in and out naturally, like with any closure
 	// explicit error return to give place for us to kill switch the operation (fallback)
 
-	circuit, _, err := GetCircuit(name)
+	circuit, _, err := getCircuit(name)
 	if err != nil {
-		cmd.errChan <- err
-		return cmd.errChan
+		// Without a circuit nothing can be recorded, but the fallback still covers the caller.
+		go func() {
+			defer close(cmd.reported)
+			if fallback == nil {
+				cmd.errChan <- err
+				return
+			}
+			if fallbackErr := fallback(ctx, err); fallbackFailed(fallbackErr) {
+				cmd.errChan <- FallbackError{RunErr: err, FallbackErr: fallbackErr}
+			}
+		}()
+		return cmd
 	}
 	cmd.circuit = circuit
-	ticketCond := sync.NewCond(cmd)
-	ticketChecked := false
+	cmd.ticketCond.L = cmd
 	// When the caller extracts error from returned errChan, it's assumed that
 	// the ticket's been returned to executorPool. Therefore, returnTicket() can
 	// not run after cmd.errorWithFallback().
 	returnTicket := func() {
 		cmd.Lock()
 		// Avoid releasing before a ticket is acquired.
-		for !ticketChecked {
-			ticketCond.Wait()
+		for !cmd.ticketChecked {
+			cmd.ticketCond.Wait()
 		}
+		// The tickets are forgotten once returned, so that they are returned exactly once
+		// even if this is reached again.
 		cmd.circuit.executorPool.Return(cmd.ticket)
+		for _, ticket := range cmd.extraTickets {
+			cmd.circuit.executorPool.Return(ticket)
+		}
+		cmd.ticket, cmd.extraTickets = nil, nil
 		cmd.Unlock()
 	}
-	// Shared by the following two goroutines. It ensures only the faster
-	// goroutine runs errWithFallback() and reportAllEvent().
-	returnOnce := &sync.Once{}
+	budget, hasBudget := BudgetFrom(ctx)
 	reportAllEvent := func() {
-		err := cmd.circuit.ReportEvent(cmd.events, cmd.start, cmd.runDuration)
+		defer endCommand()
+		defer close(cmd.reported)
+		if hasBudget {
+			budget.consume(getClock().Now().Sub(cmd.start))
+		}
+		events := cmd.events
+		if cmd.queued {
+			events = append(events, "queued")
+		}
+		if cmd.forced {
+			events = append(events, "forced-fallback")
+		}
+		for i := atomic.LoadInt32(&cmd.retries); i > 0; i-- {
+			events = append(events, "retry")
+		}
+		err := cmd.circuit.report(events, cmd.start, cmd.runDuration, cmd.fallbackDuration, cmd.queueWait, tags, cmd.probe)
 		if err != nil {
-			log.Printf(err.Error())
+			log.Warn("failed to report event", "circuit", name, "error", err)
+		}
+	}
+
+	beginCommand()
+	if isShuttingDown() {
+		cmd.errorWithFallback(ctx, ErrShuttingDown)
+		reportAllEvent()
+		return cmd
+	}
+
+	// The caller's deadline takes precedence over the configured timeout when it is shorter,
+	// so we don't keep working after the caller has stopped waiting. A zero timeout means the
+	// command has no timeout of its own, leaving only the caller's deadline.
+	timeout := settings.Timeout
+	if settings.AdaptiveTimeout {
+		timeout = circuit.metrics.adaptiveTimeout(settings)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		untilDeadline := time.Until(deadline)
+		if untilDeadline <= 0 {
+			// The deadline has already passed, so there is no point in acquiring a ticket.
+			cmd.errorWithFallback(ctx, ErrTimeout)
+			reportAllEvent()
+			return cmd
+		}
+		if timeout == 0 || untilDeadline < timeout {
+			timeout = untilDeadline
+		}
+	}
+
+	// A budget shared with the other commands of a request caps the timeout in the same way.
+	if hasBudget {
+		remaining := budget.Remaining()
+		if remaining <= 0 {
+			cmd.errorWithFallback(ctx, ErrTimeout)
+			reportAllEvent()
+			return cmd
+		}
+		if timeout == 0 || remaining < timeout {
+			timeout = remaining
 		}
 	}
 
+	// With CancelOnTimeout, run gets a context of its own which is canceled if the command times out.
+	runCtx, cancelRun := ctx, context.CancelFunc(func() {})
+	if settings.CancelOnTimeout {
+		runCtx, cancelRun = context.WithCancel(ctx)
+	}
+
+	// The timeout and the caller's context are watched with callbacks rather than a goroutine of
+	// their own, so that each command only needs the goroutine which runs it (before Go 1.21,
+	// watching the context still takes one). Whichever of the three finishes first runs returnOnce;
+	// the callbacks are stopped once the run goroutine is done, which leaves them nothing to do if
+	// they fire anyway. With no timeout there is no timer, and a context which can't be canceled
+	// needs no watching.
+	onTimeout := func() {
+		cmd.returnOnce.Do(func() {
+			returnTicket()
+			cmd.errorWithFallback(ctx, ErrTimeout)
+			reportAllEvent()
+		})
+		// Canceled only now, so that a run which stops for it can't be recorded before the timeout.
+		cancelRun()
+	}
+	onDone := func() {
+		err := contextError(ctx)
+		cmd.returnOnce.Do(func() {
+			returnTicket()
+			cmd.errorWithFallback(ctx, err)
+			reportAllEvent()
+		})
+	}
+	var timer clockTimer
+	if timeout > 0 {
+		timer = getClock().AfterFunc(timeout, onTimeout)
+	}
+	stopWatching := func() bool { return false }
+	if ctx.Done() != nil {
+		stopWatching = afterFunc(ctx, onDone)
+	}
+
 	go func() {
-		defer func() { cmd.finished <- true }()
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+			stopWatching()
+		}()
+		defer cancelRun()
+
+		// Blocked commands are turned away on purpose, not because the circuit measured them as unhealthy.
+		if cmd.circuit.isBlocked() {
+			cmd.Lock()
+			cmd.ticketChecked = true
+			cmd.ticketCond.Signal()
+			cmd.Unlock()
+			cmd.returnOnce.Do(func() {
+				returnTicket()
+				cmd.errorWithFallback(ctx, ErrCommandBlocked)
+				reportAllEvent()
+			})
+			return
+		}
 
 		// Circuits get opened when recent executions have shown to have a high error rate.
 		// Rejecting new executions allows backends to recover, and the circuit will allow
 		// new traffic when it feels a healthly state has returned.
-		if !cmd.circuit.AllowRequest() {
+		allowed, probe := cmd.circuit.allowRequest()
+		if !allowed {
 			cmd.Lock()
 			// It's safe for another goroutine to go ahead releasing a nil ticket.
-			ticketChecked = true
-			ticketCond.Signal()
+			cmd.ticketChecked = true
+			cmd.ticketCond.Signal()
 			cmd.Unlock()
-			returnOnce.Do(func() {
+			cmd.returnOnce.Do(func() {
 				returnTicket()
 				cmd.errorWithFallback(ctx, ErrCircuitOpen)
 				reportAllEvent()
@@ -133,34 +480,84 @@ func GoC(ctx context.Context, name string, run runFuncC, fallback fallbackFuncC)
 			return
 		}
 
+		// Fallbacks may be exercised on purpose while the circuit is healthy.
+		if cmd.circuit.forceFallback() {
+			if probe {
+				// the command won't run, so it can't test the circuit
+				cmd.circuit.reportProbe("forced-fallback")
+			}
+			cmd.Lock()
+			cmd.forced = true
+			cmd.ticketChecked = true
+			cmd.ticketCond.Signal()
+			cmd.Unlock()
+			cmd.returnOnce.Do(func() {
+				returnTicket()
+				cmd.errorWithFallback(ctx, ErrForcedFallback)
+				reportAllEvent()
+			})
+			return
+		}
+
 		// As backends falter, requests take longer but don't always fail.
 		//
 		// When requests slow down but the incoming rate of requests stays the same, you have to
 		// run more at a time to keep up. By controlling concurrency during these situations, you can
 		// shed load which accumulates due to the increasing ratio of active commands to incoming requests.
+		//
+		// A bounded number of commands may queue briefly for a ticket to absorb bursts. The wait
+		// never outlasts the command's own timeout.
+		queueTimeout := settings.QueueTimeout
+		if timeout > 0 && timeout < queueTimeout {
+			queueTimeout = timeout
+		}
+		//
+		// A weighted command takes all of its tickets at once, without queueing, or none of them.
+		var ticket *poolTicket
+		var extraTickets []*poolTicket
+		var queued bool
+		if weight > 1 {
+			if tickets := circuit.executorPool.tryAcquireN(weight); tickets != nil {
+				ticket, extraTickets = tickets[0], tickets[1:]
+			}
+		} else {
+			ticket, queued = circuit.executorPool.acquire(settings.MaxQueueSize, queueTimeout, ctx.Done())
+		}
 		cmd.Lock()
-		select {
-		case cmd.ticket = <-circuit.executorPool.Tickets:
-			ticketChecked = true
-			ticketCond.Signal()
-			cmd.Unlock()
-		default:
-			ticketChecked = true
-			ticketCond.Signal()
-			cmd.Unlock()
-			returnOnce.Do(func() {
+		cmd.ticket = ticket
+		cmd.extraTickets = extraTickets
+		cmd.queued = queued
+		cmd.probe = probe
+		if ticket != nil {
+			cmd.queueWait = getClock().Now().Sub(cmd.start)
+		}
+		cmd.ticketChecked = true
+		cmd.ticketCond.Signal()
+		cmd.Unlock()
+		if ticket == nil {
+			var err error = ErrMaxConcurrency
+			if ctx.Err() != nil {
+				// the caller gave up while the command was queued
+				err = contextError(ctx)
+			}
+			cmd.returnOnce.Do(func() {
 				returnTicket()
-				cmd.errorWithFallback(ctx, ErrMaxConcurrency)
+				cmd.errorWithFallback(ctx, err)
 				reportAllEvent()
 			})
 			return
 		}
 
-		runStart := time.Now()
-		runErr := run(ctx)
-		returnOnce.Do(func() {
+		// Retries stop in time to leave the last attempt before the command times out.
+		var deadline time.Time
+		if timeout > 0 {
+			deadline = cmd.start.Add(timeout)
+		}
+		runStart := getClock().Now()
+		recovered, runErr := cmd.runWithRetries(runCtx, run, deadline)
+		cmd.returnOnce.Do(func() {
 			defer reportAllEvent()
-			cmd.runDuration = time.Since(runStart)
+			cmd.runDuration = getClock().Now().Sub(runStart)
 			returnTicket()
 			if runErr != nil {
 				cmd.errorWithFallback(ctx, runErr)
@@ -168,33 +565,13 @@ func GoC(ctx context.Context, name string, run runFuncC, fallback fallbackFuncC)
 			}
 			cmd.reportEvent("success")
 		})
-	}()
 
-	go func() {
-		timer := time.NewTimer(getSettings(name).Timeout)
-		defer timer.Stop()
-
-		select {
-		case <-cmd.finished:
-			// returnOnce has been executed in another goroutine
-		case <-ctx.Done():
-			returnOnce.Do(func() {
-				returnTicket()
-				cmd.errorWithFallback(ctx, ctx.Err())
-				reportAllEvent()
-			})
-			return
-		case <-timer.C:
-			returnOnce.Do(func() {
-				returnTicket()
-				cmd.errorWithFallback(ctx, ErrTimeout)
-				reportAllEvent()
-			})
-			return
+		if recovered != nil && settings.PropagatePanics {
+			panic(recovered)
 		}
 	}()
 
-	return cmd.errChan
+	return cmd
 }
 
 // Do runs your function in a synchronous manner, blocking until either your function succeeds
@@ -215,6 +592,191 @@ func Do(name string, run runFunc, fallback fallbackFunc) error {
 // DoC runs your function in a synchronous manner, blocking until either your function succeeds
 // or an error is returned, including hystrix circuit errors
 func DoC(ctx context.Context, name string, run runFuncC, fallback fallbackFuncC) error {
+	return doC(ctx, name, getSettings(name), run, fallback)
+}
+
+// DoCancelable starts your function like Do, without blocking. wait blocks until the command finishes
+// and returns its error. cancel abandons the command: its ticket is returned and wait returns once the
+// fallback, if any, has handled context.Canceled, while run is left to finish in the background as it
+// is after a timeout. As with context.WithCancel, cancel should be called once the result is no longer
+// needed.
+func DoCancelable(name string, run runFunc, fallback fallbackFunc) (wait func() error, cancel context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runC := func(ctx context.Context) error {
+		return run()
+	}
+	var fallbackC fallbackFuncC
+	if fallback != nil {
+		fallbackC = func(ctx context.Context, err error) error {
+			return fallback(err)
+		}
+	}
+
+	done := make(chan struct{})
+	var err error
+	go func() {
+		defer close(done)
+		err = DoC(ctx, name, runC, fallbackC)
+	}()
+
+	wait = func() error {
+		<-done
+		return err
+	}
+	return wait, cancel
+}
+
+// DoWithConfig runs your function synchronously like Do, but applies any non-zero fields of
+// config to this execution only. See GoWithConfig for which settings are honored.
+func DoWithConfig(name string, config CommandConfig, run runFunc, fallback fallbackFunc) error {
+	runC := func(ctx context.Context) error {
+		return run()
+	}
+	var fallbackC fallbackFuncC
+	if fallback != nil {
+		fallbackC = func(ctx context.Context, err error) error {
+			return fallback(err)
+		}
+	}
+	return doC(context.Background(), name, overrideSettings(name, config), runC, fallbackC)
+}
+
+// DoBatch runs each of runs as an execution of the named command, like Do, and returns their errors
+// in the same order. At most MaxConcurrentRequests of them run at a time, so a batch larger than the
+// executor pool waits for tickets instead of being rejected, although executions elsewhere may still
+// take the tickets first. fallback, if not nil, is used by each of them.
+func DoBatch(name string, runs []func() error, fallback fallbackFunc) []error {
+	errs := make([]error, len(runs))
+
+	limit := getSettings(name).MaxConcurrentRequests
+	if limit < 1 {
+		limit = 1
+	}
+	slots := make(chan struct{}, limit)
+
+	var wg sync.WaitGroup
+	for i, run := range runs {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int, run func() error) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			errs[i] = Do(name, run, fallback)
+		}(i, run)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// DoWithCause runs your function synchronously like Do, and also returns the error which caused the
+// command to fail: the run error, or a CircuitError such as ErrCircuitOpen, ErrMaxConcurrency or
+// ErrTimeout. The cause is returned even when the fallback succeeded and err is nil. It is nil when
+// run succeeded.
+func DoWithCause(name string, run runFunc, fallback fallbackFunc) (err error, cause error) {
+	runC := func(ctx context.Context) error {
+		return run()
+	}
+	var fallbackC fallbackFuncC
+	if fallback != nil {
+		fallbackC = func(ctx context.Context, err error) error {
+			return fallback(err)
+		}
+	}
+	outcome, err := DoWithOutcome(context.Background(), name, runC, fallbackC)
+	return err, outcome.Cause
+}
+
+// An ExecOutcome describes how a command produced its result.
+type ExecOutcome struct {
+	// FromFallback is true when the result was served by a successful fallback.
+	FromFallback bool
+	// Cause is the error which made the command fail over to its fallback, or which was returned
+	// when it had none. It is nil when run succeeded.
+	Cause error
+	// Latency is how long the command took, from the call until its result was returned.
+	Latency time.Duration
+}
+
+// DoWithOutcome runs your function synchronously like DoC, and also reports whether the result came
+// from run or from the fallback, and why.
+func DoWithOutcome(ctx context.Context, name string, run runFuncC, fallback fallbackFuncC) (ExecOutcome, error) {
+	start := getClock().Now()
+	if fallback == nil {
+		fallback = defaultFallbackFor(name)
+	}
+	if fallback == nil {
+		// without a fallback, the cause is the error itself
+		err := doC(ctx, name, getSettings(name), run, nil)
+		return ExecOutcome{Cause: err, Latency: getClock().Now().Sub(start)}, err
+	}
+
+	// The fallback runs at most once, and doC returns only after it has.
+	var outcome ExecOutcome
+	fallbackC := func(ctx context.Context, cause error) error {
+		outcome.Cause = cause
+		err := fallback(ctx, cause)
+		outcome.FromFallback = !fallbackFailed(err)
+		return err
+	}
+	err := doC(ctx, name, getSettings(name), run, fallbackC)
+	outcome.Latency = getClock().Now().Sub(start)
+	return outcome, err
+}
+
+// Execute runs your function synchronously like DoWithOutcome, returning the value produced by
+// either your run function or your fallback along with how it was produced. The value came from run
+// when outcome.Cause is nil, and from the fallback when outcome.FromFallback is true; otherwise, as
+// when a circuit error is returned without a fallback to cover it, it is the zero value of T and err
+// is not nil.
+func Execute[T any](ctx context.Context, name string, run func(context.Context) (T, error), fallback func(context.Context, error) (T, error)) (T, ExecOutcome, error) {
+	// Each result is kept apart, so that a run which succeeds after timing out can't replace the
+	// value of the fallback which answered for it.
+	var mu sync.Mutex
+	var runResult, fallbackResult T
+
+	runC := func(ctx context.Context) error {
+		result, err := run(ctx)
+		if err == nil {
+			mu.Lock()
+			runResult = result
+			mu.Unlock()
+		}
+		return err
+	}
+
+	var fallbackC fallbackFuncC
+	if fallback != nil {
+		fallbackC = func(ctx context.Context, cause error) error {
+			result, err := fallback(ctx, cause)
+			if !fallbackFailed(err) {
+				mu.Lock()
+				fallbackResult = result
+				mu.Unlock()
+			}
+			return err
+		}
+	}
+
+	outcome, err := DoWithOutcome(ctx, name, runC, fallbackC)
+	if err != nil {
+		var zero T
+		return zero, outcome, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if outcome.FromFallback {
+		return fallbackResult, outcome, nil
+	}
+	return runResult, outcome, nil
+}
+
+func doC(ctx context.Context, name string, settings *Settings, run runFuncC, fallback fallbackFuncC) error {
+	// The default fallback has to be known here, so that its success is noticed below.
+	if fallback == nil {
+		fallback = defaultFallbackFor(name)
+	}
 	done := make(chan struct{}, 1)
 
 	r := func(ctx context.Context) error {
@@ -229,29 +791,207 @@ func DoC(ctx context.Context, name string, run runFuncC, fallback fallbackFuncC)
 
 	f := func(ctx context.Context, e error) error {
 		err := fallback(ctx, e)
-		if err != nil {
+		if fallbackFailed(err) {
 			return err
 		}
 
 		done <- struct{}{}
-		return nil
+		return err
 	}
 
-	var errChan chan error
+	var cmd *command
 	if fallback == nil {
-		errChan = GoC(ctx, name, r, nil)
+		cmd = startCommand(ctx, name, settings, r, nil, 1, nil)
 	} else {
-		errChan = GoC(ctx, name, r, f)
+		cmd = startCommand(ctx, name, settings, r, f, 1, nil)
 	}
 
+	// Wait for the outcome to be sent to the metrics as well. It may not have been recorded yet, so only
+	// readers which flush the metrics first, such as Metrics and Health, are sure to include it once Do
+	// returns.
 	select {
 	case <-done:
+		<-cmd.reported
 		return nil
-	case err := <-errChan:
+	case err := <-cmd.errChan:
+		<-cmd.reported
 		return err
 	}
 }
 
+// DoTyped runs your function in a synchronous manner like Do, returning the value produced by
+// either your run function or your fallback. The zero value of T is returned alongside any error,
+// including hystrix circuit errors when no fallback is defined.
+func DoTyped[T any](name string, run func() (T, error), fallback func(error) (T, error)) (T, error) {
+	runC := func(ctx context.Context) (T, error) {
+		return run()
+	}
+	var fallbackC func(context.Context, error) (T, error)
+	if fallback != nil {
+		fallbackC = func(ctx context.Context, err error) (T, error) {
+			return fallback(err)
+		}
+	}
+
+	result, _, err := Execute(context.Background(), name, runC, fallbackC)
+	return result, err
+}
+
+// A Partial holds the latest partial result published by the run function of GoResult or DoResult,
+// so that the fallback can still use the work done by a run which timed out or failed part way.
+// It is safe to use from several goroutines.
+type Partial[T any] struct {
+	mu    sync.Mutex
+	value T
+	set   bool
+}
+
+// Set replaces the partial result.
+func (p *Partial[T]) Set(value T) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.value = value
+	p.set = true
+}
+
+// Get returns the latest partial result, and whether one has been set.
+func (p *Partial[T]) Get() (T, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.value, p.set
+}
+
+// GoResult runs your function like Go, returning the value produced by either your run function or
+// your fallback on the first channel. run may publish what it has gathered so far with partial.Set,
+// and the fallback is passed the latest partial result, or the zero value of T if there is none,
+// along with the error which triggered it. This lets a fallback return partial data from a run which
+// timed out, while run carries on in the background. At most one value is sent on the results
+// channel; an error is sent on the other one instead when there is no result.
+func GoResult[T any](name string, run func(partial *Partial[T]) (T, error), fallback func(partial T, err error) (T, error)) (chan T, chan error) {
+	// Sends never block, so a run which completes after the fallback has already answered can
+	// always exit.
+	results := make(chan T, 1)
+	var sendOnce sync.Once
+	send := func(result T) {
+		sendOnce.Do(func() { results <- result })
+	}
+
+	partial := &Partial[T]{}
+	r := func(ctx context.Context) error {
+		result, err := run(partial)
+		if err != nil {
+			return err
+		}
+
+		send(result)
+		return nil
+	}
+
+	var f fallbackFuncC
+	if fallback != nil {
+		f = func(ctx context.Context, e error) error {
+			value, _ := partial.Get()
+			result, err := fallback(value, e)
+			if fallbackFailed(err) {
+				return err
+			}
+
+			send(result)
+			return err
+		}
+	} else if defaultFallback := defaultFallbackFor(name); defaultFallback != nil {
+		f = func(ctx context.Context, e error) error {
+			err := defaultFallback(ctx, e)
+			if fallbackFailed(err) {
+				return err
+			}
+
+			var zero T
+			send(zero)
+			return err
+		}
+	}
+
+	return results, GoC(context.Background(), name, r, f)
+}
+
+// DoResult runs your function synchronously like GoResult, returning the value produced by either
+// your run function or your fallback. The zero value of T is returned alongside any error.
+func DoResult[T any](name string, run func(partial *Partial[T]) (T, error), fallback func(partial T, err error) (T, error)) (T, error) {
+	results, errChan := GoResult(name, run, fallback)
+
+	select {
+	case result := <-results:
+		return result, nil
+	case err := <-errChan:
+		var zero T
+		return zero, err
+	}
+}
+
+// contextError returns the error a command fails with once ctx is done. The caller's deadline is
+// part of the effective timeout, so exceeding it is reported as a timeout.
+func contextError(ctx context.Context) error {
+	err := ctx.Err()
+	if err == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	return err
+}
+
+// runWithRecover converts a panic in run into an error, so that it is treated like any other failure.
+func runWithRecover(ctx context.Context, run runFuncC) (recovered interface{}, err error) {
+	defer func() {
+		if recovered = recover(); recovered != nil {
+			err = CircuitError{Message: fmt.Sprintf("panic: %v", recovered)}
+		}
+	}()
+
+	return nil, run(ctx)
+}
+
+// runWithRetries runs run with runWithRecover, and while it fails runs it again up to MaxRetries
+// times, doubling the backoff before each retry. It stops early if the backoff would end after
+// deadline, unless deadline is zero, or if ctx is done.
+func (c *command) runWithRetries(ctx context.Context, run runFuncC, deadline time.Time) (interface{}, error) {
+	backoff := c.settings.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		recovered, err := runWithRecover(ctx, run)
+		if err == nil || recovered != nil || attempt >= c.settings.MaxRetries || ctx.Err() != nil {
+			return recovered, err
+		}
+		if ignorable := c.settings.IsErrorIgnorable; ignorable != nil && ignorable(err) {
+			return recovered, err
+		}
+		if !deadline.IsZero() && getClock().Now().Add(backoff).After(deadline) {
+			return recovered, err
+		}
+
+		if backoff > 0 {
+			timer := getClock().NewTimer(backoff)
+			select {
+			case <-timer.Chan():
+			case <-ctx.Done():
+				timer.Stop()
+				return recovered, err
+			}
+		}
+		atomic.AddInt32(&c.retries, 1)
+		backoff *= 2
+	}
+}
+
+// withName sets the name of the command on err, if it is a CircuitError without one.
+func (c *command) withName(err error) error {
+	if circuitErr, ok := err.(CircuitError); ok && circuitErr.Name == "" {
+		circuitErr.Name = c.circuit.Name
+		return circuitErr
+	}
+	return err
+}
+
 func (c *command) reportEvent(eventType string) {
 	c.Lock()
 	defer c.Unlock()
@@ -261,39 +1001,93 @@ func (c *command) reportEvent(eventType string) {
 
 // errorWithFallback triggers the fallback while reporting the appropriate metric events.
 func (c *command) errorWithFallback(ctx context.Context, err error) {
+	// a CircuitError returned by a nested command is classified as the sentinel it was made from
+	sentinel := err
+	if circuitErr, ok := err.(CircuitError); ok {
+		sentinel = CircuitError{Message: circuitErr.Message}
+	}
+
 	eventType := "failure"
-	if err == ErrCircuitOpen {
+	if sentinel == ErrCircuitOpen {
 		eventType = "short-circuit"
-	} else if err == ErrMaxConcurrency {
+	} else if sentinel == ErrMaxConcurrency || sentinel == ErrShuttingDown {
 		eventType = "rejected"
-	} else if err == ErrTimeout {
+	} else if sentinel == ErrCommandBlocked {
+		eventType = "blocked"
+	} else if sentinel == ErrTimeout {
 		eventType = "timeout"
 	} else if err == context.Canceled {
 		eventType = "context_canceled"
 	} else if err == context.DeadlineExceeded {
 		eventType = "context_deadline_exceeded"
+	} else if mapped := c.errorEvent(err); mapped != "" {
+		eventType = mapped
+	} else if ignorable := c.settings.IsErrorIgnorable; ignorable != nil && ignorable(err) {
+		eventType = "non-failure-error"
 	}
 
 	c.reportEvent(eventType)
+	err = c.withName(err)
 	fallbackErr := c.tryFallback(ctx, err)
 	if fallbackErr != nil {
 		c.errChan <- fallbackErr
 	}
 }
 
+// errorEvents are the events a run error may be recorded as by Settings.ErrorEvent.
+var errorEvents = map[string]bool{
+	"failure":           true,
+	"rejected":          true,
+	"timeout":           true,
+	"short-circuit":     true,
+	"non-failure-error": true,
+}
+
+// errorEvent returns the event the command's ErrorEvent maps a run error to, or "" to classify it as usual.
+func (c *command) errorEvent(err error) string {
+	mapEvent := c.settings.ErrorEvent
+	if mapEvent == nil {
+		return ""
+	}
+
+	eventType := mapEvent(err)
+	if eventType != "" && !errorEvents[eventType] {
+		log.Warn("unknown error event, recording a failure", "circuit", c.circuit.Name, "event", eventType)
+		return "failure"
+	}
+	return eventType
+}
+
 func (c *command) tryFallback(ctx context.Context, err error) error {
 	if c.fallback == nil {
-		// If we don't have a fallback return the original error.
+		// If we don't have a fallback return the original error, recording that the caller
+		// received it without any fallback to cover it.
+		c.reportEvent("no-fallback")
 		return err
 	}
 
+	if limit := c.settings.MaxConcurrentFallbacks; limit > 0 {
+		if atomic.AddInt32(&c.circuit.activeFallbacks, 1) > int32(limit) {
+			atomic.AddInt32(&c.circuit.activeFallbacks, -1)
+			c.reportEvent("fallback-rejection")
+			return c.withName(ErrFallbackRejected)
+		}
+		defer atomic.AddInt32(&c.circuit.activeFallbacks, -1)
+	}
+
+	fallbackStart := getClock().Now()
 	fallbackErr := c.fallback(ctx, err)
-	if fallbackErr != nil {
+	c.fallbackDuration = getClock().Now().Sub(fallbackStart)
+	if fallbackFailed(fallbackErr) {
 		c.reportEvent("fallback-failure")
-		return fmt.Errorf("fallback failed with '%v'. run error was '%v'", fallbackErr, err)
+		log.Warn("fallback failed", "circuit", c.circuit.Name, "error", fallbackErr)
+		return FallbackError{RunErr: err, FallbackErr: fallbackErr}
 	}
 
 	c.reportEvent("fallback-success")
+	if fallbackErr != nil {
+		c.reportEvent("fallback-degraded")
+	}
 
 	return nil
 }
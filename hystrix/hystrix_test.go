@@ -2,7 +2,11 @@ package hystrix
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -72,13 +76,14 @@ func TestTimeout(t *testing.T) {
 		defer Flush()
 		ConfigureCommand("", CommandConfig{Timeout: 100})
 
-		resultChan := make(chan int)
+		// buffered, so that the command finishes even when a test doesn't read the channel
+		resultChan := make(chan int, 2)
 		errChan := GoC(context.Background(), "", func(ctx context.Context) error {
 			time.Sleep(1 * time.Second)
 			resultChan <- 1
 			return nil
 		}, func(ctx context.Context, err error) error {
-			if err == ErrTimeout {
+			if errors.Is(err, ErrTimeout) {
 				resultChan <- 2
 			}
 			return nil
@@ -106,7 +111,7 @@ func TestTimeoutEmptyFallback(t *testing.T) {
 		}, nil)
 
 		Convey("a timeout error should be returned", func() {
-			So(<-errChan, ShouldResemble, ErrTimeout)
+			So(errors.Is(<-errChan, ErrTimeout), ShouldBeTrue)
 
 			Convey("metrics are recorded", func() {
 				time.Sleep(10 * time.Millisecond)
@@ -141,7 +146,7 @@ func TestMaxConcurrent(t *testing.T) {
 
 				select {
 				case err := <-errChan:
-					if err == ErrMaxConcurrency {
+					if errors.Is(err, ErrMaxConcurrency) {
 						bad++
 					}
 				default:
@@ -157,6 +162,51 @@ func TestMaxConcurrent(t *testing.T) {
 	})
 }
 
+func TestReconfigureMaxConcurrent(t *testing.T) {
+	Convey("if a command has max concurrency set to 10 and is saturated", t, func() {
+		defer Flush()
+		ConfigureCommand("", CommandConfig{MaxConcurrentRequests: 10, Timeout: 1000})
+
+		release := make(chan struct{})
+		defer close(release)
+		run := func(ctx context.Context) error {
+			<-release
+			return nil
+		}
+
+		execute := func(n int) (rejected int) {
+			errChans := make([]chan error, n)
+			for i := range errChans {
+				errChans[i] = GoC(context.Background(), "", run, nil)
+			}
+			time.Sleep(20 * time.Millisecond)
+			for _, errChan := range errChans {
+				select {
+				case err := <-errChan:
+					if errors.Is(err, ErrMaxConcurrency) {
+						rejected++
+					}
+				default:
+				}
+			}
+			return rejected
+		}
+
+		So(execute(11), ShouldEqual, 1)
+
+		Convey("and max concurrency is reconfigured to 20", func() {
+			ConfigureCommand("", CommandConfig{MaxConcurrentRequests: 20, Timeout: 1000})
+
+			Convey("20 concurrent executions become possible", func() {
+				So(execute(11), ShouldEqual, 1)
+
+				cb, _, _ := GetCircuit("")
+				So(cb.executorPool.ActiveCount(), ShouldEqual, 20)
+			})
+		})
+	})
+}
+
 func TestForceOpenCircuit(t *testing.T) {
 	Convey("when a command with a forced open circuit is run", t, func() {
 		defer Flush()
@@ -171,7 +221,7 @@ func TestForceOpenCircuit(t *testing.T) {
 		}, nil)
 
 		Convey("a 'circuit open' error is returned", func() {
-			So(<-errChan, ShouldResemble, ErrCircuitOpen)
+			So(errors.Is(<-errChan, ErrCircuitOpen), ShouldBeTrue)
 
 			Convey("metrics are recorded", func() {
 				time.Sleep(10 * time.Millisecond)
@@ -198,6 +248,179 @@ func TestNilFallbackRunError(t *testing.T) {
 	})
 }
 
+func TestGetCircuitError(t *testing.T) {
+	Convey("when the circuit of a command can't be found", t, func() {
+		defer Flush()
+
+		errLookup := fmt.Errorf("lookup failed")
+		previous := getCircuit
+		getCircuit = func(name string) (*CircuitBreaker, bool, error) {
+			return nil, false, errLookup
+		}
+		defer func() { getCircuit = previous }()
+
+		Convey("the fallback is consulted with the error", func() {
+			var fallbackErr error
+			err := Do("", func() error {
+				return nil
+			}, func(err error) error {
+				fallbackErr = err
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(fallbackErr, ShouldEqual, errLookup)
+		})
+
+		Convey("a failing fallback returns both errors", func() {
+			err := Do("", func() error {
+				return nil
+			}, func(err error) error {
+				return fmt.Errorf("fallback_error")
+			})
+			So(errors.Is(err, errLookup), ShouldBeTrue)
+		})
+
+		Convey("without a fallback the error is returned", func() {
+			So(Do("", func() error { return nil }, nil), ShouldEqual, errLookup)
+		})
+	})
+}
+
+func TestIgnorableRunError(t *testing.T) {
+	Convey("with a command configured to ignore a domain error", t, func() {
+		defer Flush()
+
+		errNotFound := fmt.Errorf("not found")
+		ConfigureCommand("", CommandConfig{
+			IsErrorIgnorable: func(err error) bool {
+				return err == errNotFound
+			},
+		})
+
+		Convey("when the run function returns that error", func() {
+			errChan := GoC(context.Background(), "", func(ctx context.Context) error {
+				return errNotFound
+			}, nil)
+
+			Convey("the error is still returned", func() {
+				So(<-errChan, ShouldEqual, errNotFound)
+
+				Convey("but it is not recorded as a failure", func() {
+					time.Sleep(10 * time.Millisecond)
+					cb, _, _ := GetCircuit("")
+					So(cb.metrics.DefaultCollector().NumRequests().Sum(time.Now()), ShouldEqual, 1)
+					So(cb.metrics.DefaultCollector().Failures().Sum(time.Now()), ShouldEqual, 0)
+					So(cb.metrics.DefaultCollector().Errors().Sum(time.Now()), ShouldEqual, 0)
+				})
+			})
+		})
+
+		Convey("when the run function returns any other error", func() {
+			errChan := GoC(context.Background(), "", func(ctx context.Context) error {
+				return fmt.Errorf("run_error")
+			}, nil)
+
+			Convey("it is recorded as a failure", func() {
+				So((<-errChan).Error(), ShouldEqual, "run_error")
+				time.Sleep(10 * time.Millisecond)
+				cb, _, _ := GetCircuit("")
+				So(cb.metrics.DefaultCollector().Failures().Sum(time.Now()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestErrorEvent(t *testing.T) {
+	Convey("with a command which maps a downstream 429 to a rejection", t, func() {
+		defer Flush()
+
+		errTooManyRequests := fmt.Errorf("429")
+		ConfigureCommand("error-event", CommandConfig{
+			ErrorEvent: func(err error) string {
+				if err == errTooManyRequests {
+					return "rejected"
+				}
+				if err.Error() == "nonsense" {
+					return "bogus"
+				}
+				return ""
+			},
+		})
+
+		Convey("the mapped error is recorded as a rejection", func() {
+			err := Do("error-event", func() error {
+				return errTooManyRequests
+			}, nil)
+			So(err, ShouldEqual, errTooManyRequests)
+
+			snapshot, _ := Metrics("error-event")
+			So(snapshot.Rejects, ShouldEqual, 1)
+			So(snapshot.Failures, ShouldEqual, 0)
+		})
+
+		Convey("errors left unmapped are recorded as failures", func() {
+			Do("error-event", func() error {
+				return fmt.Errorf("run_error")
+			}, nil)
+
+			snapshot, _ := Metrics("error-event")
+			So(snapshot.Failures, ShouldEqual, 1)
+			So(snapshot.Rejects, ShouldEqual, 0)
+		})
+
+		Convey("unknown event names are recorded as failures", func() {
+			Do("error-event", func() error {
+				return fmt.Errorf("nonsense")
+			}, nil)
+
+			snapshot, _ := Metrics("error-event")
+			So(snapshot.Failures, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestRunPanic(t *testing.T) {
+	Convey("when your run function panics", t, func() {
+		defer Flush()
+
+		errChan := GoC(context.Background(), "", func(ctx context.Context) error {
+			var m map[string]int
+			m["boom"] = 1
+			return nil
+		}, nil)
+
+		Convey("an error is returned instead of crashing", func() {
+			err := <-errChan
+			So(err, ShouldHaveSameTypeAs, CircuitError{})
+			So(err.Error(), ShouldStartWith, "hystrix: panic: ")
+
+			Convey("and a failure is recorded", func() {
+				time.Sleep(10 * time.Millisecond)
+				cb, _, _ := GetCircuit("")
+				So(cb.metrics.DefaultCollector().Failures().Sum(time.Now()), ShouldEqual, 1)
+				So(cb.executorPool.ActiveCount(), ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("when your run function panics and there is a fallback", t, func() {
+		defer Flush()
+
+		err := Do("", func() error {
+			panic("boom")
+		}, func(err error) error {
+			if err.Error() == "hystrix: panic: boom" {
+				return nil
+			}
+			return err
+		})
+
+		Convey("the fallback receives the panic as an error", func() {
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
 func TestFailedFallback(t *testing.T) {
 	Convey("when your run and fallback functions return an error", t, func() {
 		defer Flush()
@@ -213,6 +436,216 @@ func TestFailedFallback(t *testing.T) {
 			So(err.Error(), ShouldEqual, "fallback failed with 'fallback_error'. run error was 'run_error'")
 		})
 	})
+
+	Convey("when a command times out and its fallback returns an error", t, func() {
+		defer Flush()
+		ConfigureCommand("", CommandConfig{Timeout: 10})
+		fallbackErr := fmt.Errorf("fallback_error")
+
+		err := Do("", func() error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}, func(err error) error {
+			return fallbackErr
+		})
+
+		Convey("the returned error exposes both causes", func() {
+			var fe FallbackError
+			So(errors.As(err, &fe), ShouldBeTrue)
+			So(errors.Is(fe.RunErr, ErrTimeout), ShouldBeTrue)
+			So(fe.Fallback(), ShouldEqual, fallbackErr)
+			So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+			So(errors.Is(err, fallbackErr), ShouldBeTrue)
+		})
+	})
+
+	Convey("when a fallback returns its own typed error", t, func() {
+		defer Flush()
+		runErr := fmt.Errorf("run_error")
+
+		err := Do("typed_fallback_error", func() error {
+			return runErr
+		}, func(err error) error {
+			return fmt.Errorf("charging card: %w", declinedError{code: "insufficient_funds"})
+		})
+
+		Convey("the caller can branch on its type", func() {
+			var declined declinedError
+			So(errors.As(err, &declined), ShouldBeTrue)
+			So(declined.code, ShouldEqual, "insufficient_funds")
+		})
+
+		Convey("the run error is still its cause", func() {
+			So(errors.Unwrap(err), ShouldEqual, runErr)
+			So(errors.Is(err, runErr), ShouldBeTrue)
+		})
+
+		Convey("it is recorded as a failed fallback", func() {
+			snapshot, _ := Metrics("typed_fallback_error")
+			So(snapshot.FallbackFailures, ShouldEqual, 1)
+		})
+	})
+}
+
+type declinedError struct {
+	code string
+}
+
+func (e declinedError) Error() string {
+	return "declined: " + e.code
+}
+
+func TestFallbackDegraded(t *testing.T) {
+	Convey("when a fallback returns ErrFallbackDegraded", t, func() {
+		defer Flush()
+		degraded := func(err error) error {
+			return fmt.Errorf("serving stale data: %w", ErrFallbackDegraded)
+		}
+
+		err := Do("degraded", func() error {
+			return fmt.Errorf("run_error")
+		}, degraded)
+
+		Convey("the caller receives no error", func() {
+			So(err, ShouldBeNil)
+		})
+
+		Convey("the fallback is recorded as a degraded success", func() {
+			snapshot, err := Metrics("degraded")
+			So(err, ShouldBeNil)
+			So(snapshot.FallbackSuccesses, ShouldEqual, 1)
+			So(snapshot.FallbackFailures, ShouldEqual, 0)
+			So(snapshot.FallbackDegraded, ShouldEqual, 1)
+		})
+
+		Convey("typed commands return the degraded result", func() {
+			result, err := DoTyped("degraded", func() (string, error) {
+				return "", fmt.Errorf("run_error")
+			}, func(err error) (string, error) {
+				return "stale", ErrFallbackDegraded
+			})
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "stale")
+		})
+
+		Convey("the outcome says the fallback served the result", func() {
+			outcome, err := DoWithOutcome(context.Background(), "degraded", func(ctx context.Context) error {
+				return fmt.Errorf("run_error")
+			}, func(ctx context.Context, err error) error {
+				return ErrFallbackDegraded
+			})
+			So(err, ShouldBeNil)
+			So(outcome.FromFallback, ShouldBeTrue)
+		})
+	})
+}
+
+func TestMaxConcurrentFallbacks(t *testing.T) {
+	Convey("with MaxConcurrentFallbacks of 1", t, func() {
+		defer Flush()
+		ConfigureCommand("limited_fallbacks", CommandConfig{MaxConcurrentFallbacks: 1, MaxConcurrentRequests: 10})
+
+		Convey("a fallback started while another is running is rejected", func() {
+			running := make(chan struct{})
+			release := make(chan struct{})
+			first := make(chan error, 1)
+			go func() {
+				first <- Do("limited_fallbacks", func() error {
+					return fmt.Errorf("run_error")
+				}, func(err error) error {
+					close(running)
+					<-release
+					return nil
+				})
+			}()
+			<-running
+
+			fallbackRan := false
+			err := Do("limited_fallbacks", func() error {
+				return fmt.Errorf("run_error")
+			}, func(err error) error {
+				fallbackRan = true
+				return nil
+			})
+			close(release)
+
+			So(errors.Is(err, ErrFallbackRejected), ShouldBeTrue)
+			So(fallbackRan, ShouldBeFalse)
+			So(<-first, ShouldBeNil)
+
+			snapshot, err := Metrics("limited_fallbacks")
+			So(err, ShouldBeNil)
+			So(snapshot.FallbackRejects, ShouldEqual, 1)
+			So(snapshot.FallbackSuccesses, ShouldEqual, 1)
+
+			Convey("and once it returns, fallbacks run again", func() {
+				err := Do("limited_fallbacks", func() error {
+					return fmt.Errorf("run_error")
+				}, func(err error) error {
+					return nil
+				})
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestCircuitErrorIs(t *testing.T) {
+	Convey("when a circuit error is wrapped", t, func() {
+		err := fmt.Errorf("calling service: %w", ErrTimeout)
+
+		Convey("errors.Is matches the sentinel it wraps", func() {
+			So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+			So(errors.Is(err, ErrCircuitOpen), ShouldBeFalse)
+		})
+	})
+
+	Convey("a circuit error with the same message matches the sentinel", t, func() {
+		So(errors.Is(CircuitError{Message: "max concurrency"}, ErrMaxConcurrency), ShouldBeTrue)
+	})
+
+	Convey("when a command times out", t, func() {
+		defer Flush()
+		ConfigureCommand("payments", CommandConfig{Timeout: 10})
+
+		err := Do("payments", func() error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}, nil)
+
+		Convey("the error names the command", func() {
+			So(err.Error(), ShouldEqual, "hystrix: timeout (command: payments)")
+			circuitErr, _ := IsCircuitError(err)
+			So(circuitErr.Name, ShouldEqual, "payments")
+		})
+
+		Convey("it still matches the bare sentinel", func() {
+			So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+			So(errors.Is(err, CircuitError{Message: "timeout", Name: "payments"}), ShouldBeTrue)
+			So(errors.Is(err, CircuitError{Message: "timeout", Name: "orders"}), ShouldBeFalse)
+		})
+
+		Convey("an outer command running it records a timeout too", func() {
+			Do("checkout", func() error { return err }, nil)
+			snapshot, _ := Metrics("checkout")
+			So(snapshot.Timeouts, ShouldEqual, 1)
+		})
+	})
+
+	Convey("when a fallback fails", t, func() {
+		defer Flush()
+
+		runErr := fmt.Errorf("run_error")
+		errChan := GoC(context.Background(), "", func(ctx context.Context) error {
+			return runErr
+		}, func(ctx context.Context, err error) error {
+			return fmt.Errorf("fallback_error")
+		})
+
+		Convey("the run error can be unwrapped from the returned error", func() {
+			So(errors.Is(<-errChan, runErr), ShouldBeTrue)
+		})
+	})
 }
 
 func TestCloseCircuitAfterSuccess(t *testing.T) {
@@ -221,14 +654,14 @@ func TestCloseCircuitAfterSuccess(t *testing.T) {
 		cb, _, err := GetCircuit("")
 		So(err, ShouldEqual, nil)
 
-		cb.setOpen()
+		cb.setOpen(causeErrors)
 
 		Convey("commands immediately following should short-circuit", func() {
 			errChan := GoC(context.Background(), "", func(ctx context.Context) error {
 				return nil
 			}, nil)
 
-			So(<-errChan, ShouldResemble, ErrCircuitOpen)
+			So(errors.Is(<-errChan, ErrCircuitOpen), ShouldBeTrue)
 		})
 
 		Convey("and a successful command is run after the sleep window", func() {
@@ -284,7 +717,7 @@ func TestSlowFallbackOpenCircuit(t *testing.T) {
 
 		cb, _, err := GetCircuit("")
 		So(err, ShouldEqual, nil)
-		cb.setOpen()
+		cb.setOpen(causeErrors)
 
 		out := make(chan struct{}, 2)
 
@@ -352,7 +785,7 @@ func TestReturnTicket_QuickCheck(t *testing.T) {
 			return nil
 		}, nil)
 		err := <-errChan
-		So(err, ShouldResemble, ErrTimeout)
+		So(errors.Is(err, ErrTimeout), ShouldBeTrue)
 		cb, _, err := GetCircuit("")
 		So(err, ShouldBeNil)
 		return cb.executorPool.ActiveCount() == 0
@@ -380,7 +813,31 @@ func TestReturnTicket(t *testing.T) {
 
 		Convey("after GoC(context.Background(), ), the ticket returns to the pool after the timeout", func() {
 			err := <-errChan
-			So(err, ShouldResemble, ErrTimeout)
+			So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+
+			cb, _, err := GetCircuit("")
+			So(err, ShouldBeNil)
+			So(cb.executorPool.ActiveCount(), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestReturnTicketOnContextCancel(t *testing.T) {
+	Convey("with a run command that doesn't return", t, func() {
+		defer Flush()
+
+		testCtx, cancel := context.WithCancel(context.Background())
+		errChan := GoC(testCtx, "", func(ctx context.Context) error {
+			c := make(chan struct{})
+			<-c // should block
+			return nil
+		}, nil)
+
+		Convey("after the context is canceled mid-flight, the ticket returns to the pool", func() {
+			time.Sleep(5 * time.Millisecond)
+			cancel()
+			err := <-errChan
+			So(err, ShouldEqual, context.Canceled)
 
 			cb, _, err := GetCircuit("")
 			So(err, ShouldBeNil)
@@ -437,12 +894,12 @@ func TestContextHandling(t *testing.T) {
 			testCtx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
 			errChan := GoC(testCtx, "", run, nil)
 			time.Sleep(25 * time.Millisecond)
-			So((<-errChan).Error(), ShouldEqual, context.DeadlineExceeded.Error())
+			So((<-errChan).Error(), ShouldEqual, ErrTimeout.Error())
 			So(cb.metrics.DefaultCollector().NumRequests().Sum(time.Now()), ShouldEqual, 1)
 			So(cb.metrics.DefaultCollector().Failures().Sum(time.Now()), ShouldEqual, 0)
-			So(cb.metrics.DefaultCollector().Timeouts().Sum(time.Now()), ShouldEqual, 0)
+			So(cb.metrics.DefaultCollector().Timeouts().Sum(time.Now()), ShouldEqual, 1)
 			So(cb.metrics.DefaultCollector().ContextCanceled().Sum(time.Now()), ShouldEqual, 0)
-			So(cb.metrics.DefaultCollector().ContextDeadlineExceeded().Sum(time.Now()), ShouldEqual, 1)
+			So(cb.metrics.DefaultCollector().ContextDeadlineExceeded().Sum(time.Now()), ShouldEqual, 0)
 			cancel()
 		})
 
@@ -453,9 +910,9 @@ func TestContextHandling(t *testing.T) {
 			So(len(errChan), ShouldEqual, 0)
 			So(cb.metrics.DefaultCollector().NumRequests().Sum(time.Now()), ShouldEqual, 1)
 			So(cb.metrics.DefaultCollector().Failures().Sum(time.Now()), ShouldEqual, 0)
-			So(cb.metrics.DefaultCollector().Timeouts().Sum(time.Now()), ShouldEqual, 0)
+			So(cb.metrics.DefaultCollector().Timeouts().Sum(time.Now()), ShouldEqual, 1)
 			So(cb.metrics.DefaultCollector().ContextCanceled().Sum(time.Now()), ShouldEqual, 0)
-			So(cb.metrics.DefaultCollector().ContextDeadlineExceeded().Sum(time.Now()), ShouldEqual, 1)
+			So(cb.metrics.DefaultCollector().ContextDeadlineExceeded().Sum(time.Now()), ShouldEqual, 0)
 			So(cb.metrics.DefaultCollector().FallbackSuccesses().Sum(time.Now()), ShouldEqual, 1)
 			cancel()
 		})
@@ -492,31 +949,300 @@ func TestContextHandling(t *testing.T) {
 	})
 }
 
-func TestDoC(t *testing.T) {
-	Convey("with a command which succeeds", t, func() {
+func TestContextDeadline(t *testing.T) {
+	Convey("with a command configured for a 1 second timeout", t, func() {
 		defer Flush()
 
-		out := make(chan bool, 1)
-		run := func(ctx context.Context) error {
-			out <- true
-			return nil
-		}
+		ConfigureCommand("", CommandConfig{Timeout: 1000})
+		cb, _, err := GetCircuit("")
+		So(err, ShouldBeNil)
 
-		Convey("the run function is executed", func() {
-			err := DoC(context.Background(), "", run, nil)
-			So(err, ShouldBeNil)
-			So(<-out, ShouldEqual, true)
-		})
-	})
+		Convey("and a context with a shorter deadline", func() {
+			testCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
 
-	Convey("with a command which fails", t, func() {
-		defer Flush()
+			start := time.Now()
+			errChan := GoC(testCtx, "", func(ctx context.Context) error {
+				time.Sleep(500 * time.Millisecond)
+				return nil
+			}, nil)
 
-		run := func(ctx context.Context) error {
-			return fmt.Errorf("i failed")
-		}
+			Convey("the command times out at the context deadline", func() {
+				So(errors.Is(<-errChan, ErrTimeout), ShouldBeTrue)
+				So(time.Since(start), ShouldBeLessThan, 500*time.Millisecond)
+			})
+		})
 
-		Convey("with no fallback", func() {
+		Convey("and a context which is already past its deadline", func() {
+			testCtx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+			defer cancel()
+
+			ran := make(chan bool, 1)
+			fallbackErr := make(chan error, 1)
+			errChan := GoC(testCtx, "", func(ctx context.Context) error {
+				ran <- true
+				return nil
+			}, func(ctx context.Context, err error) error {
+				fallbackErr <- err
+				return nil
+			})
+
+			Convey("the fallback runs immediately without acquiring a ticket", func() {
+				So(errors.Is(<-fallbackErr, ErrTimeout), ShouldBeTrue)
+				So(len(errChan), ShouldEqual, 0)
+				So(len(ran), ShouldEqual, 0)
+				So(cb.executorPool.ActiveCount(), ShouldEqual, 0)
+
+				time.Sleep(10 * time.Millisecond)
+				So(cb.metrics.DefaultCollector().Timeouts().Sum(time.Now()), ShouldEqual, 1)
+				So(cb.metrics.DefaultCollector().FallbackSuccesses().Sum(time.Now()), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestCancelOnTimeout(t *testing.T) {
+	Convey("with a command which times out while its run waits on its context", t, func() {
+		defer Flush()
+
+		stopped := make(chan error, 1)
+		run := func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				stopped <- ctx.Err()
+			case <-time.After(time.Second):
+				stopped <- nil
+			}
+			return nil
+		}
+
+		Convey("with CancelOnTimeout the run is canceled", func() {
+			ConfigureCommand("cancel_on_timeout", CommandConfig{Timeout: 20, CancelOnTimeout: true})
+			err := DoC(context.Background(), "cancel_on_timeout", run, nil)
+			So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+			So(<-stopped, ShouldEqual, context.Canceled)
+
+			snapshot, _ := Metrics("cancel_on_timeout")
+			So(snapshot.Timeouts, ShouldEqual, 1)
+			So(snapshot.Failures, ShouldEqual, 0)
+		})
+
+		Convey("without it the run carries on", func() {
+			ConfigureCommand("no_cancel_on_timeout", CommandConfig{Timeout: 20})
+			err := DoC(context.Background(), "no_cancel_on_timeout", run, nil)
+			So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+			So(<-stopped, ShouldBeNil)
+		})
+	})
+}
+
+func TestNoTimeout(t *testing.T) {
+	Convey("with a command configured with no timeout", t, func() {
+		defer Flush()
+
+		defaultTimeout := DefaultTimeout
+		DefaultTimeout = 10
+		defer func() { DefaultTimeout = defaultTimeout }()
+
+		ConfigureCommand("", CommandConfig{Timeout: NoTimeout})
+		cb, _, err := GetCircuit("")
+		So(err, ShouldBeNil)
+
+		Convey("a command which runs longer than the default timeout succeeds", func() {
+			err := Do("", func() error {
+				time.Sleep(50 * time.Millisecond)
+				return nil
+			}, nil)
+			So(err, ShouldBeNil)
+
+			time.Sleep(10 * time.Millisecond)
+			So(cb.executorPool.ActiveCount(), ShouldEqual, 0)
+			So(cb.metrics.DefaultCollector().Successes().Sum(time.Now()), ShouldEqual, 1)
+			So(cb.metrics.DefaultCollector().Timeouts().Sum(time.Now()), ShouldEqual, 0)
+		})
+
+		Convey("a context deadline still times the command out", func() {
+			testCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			err := DoC(testCtx, "", func(ctx context.Context) error {
+				time.Sleep(200 * time.Millisecond)
+				return nil
+			}, nil)
+			So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+		})
+	})
+}
+
+func TestAdaptiveTimeout(t *testing.T) {
+	Convey("with a command whose timeout adapts to its latency", t, func() {
+		defer Flush()
+		ConfigureCommand("adaptive", CommandConfig{
+			Timeout:               1000,
+			AdaptiveTimeout:       true,
+			AdaptiveTimeoutMargin: 10,
+			MinTimeout:            20,
+		})
+		sleep := func(d time.Duration) func() error {
+			return func() error {
+				time.Sleep(d)
+				return nil
+			}
+		}
+
+		Convey("it uses Timeout until a run has been timed", func() {
+			So(Do("adaptive", sleep(50*time.Millisecond), nil), ShouldBeNil)
+		})
+
+		Convey("once fast runs have been timed", func() {
+			// percentiles are cached for a second, so the samples are added before the first execution
+			cb, _, _ := GetCircuit("adaptive")
+			for i := 0; i < 5; i++ {
+				cb.metrics.successDurations().Add(time.Millisecond)
+			}
+
+			Convey("slow runs time out well before Timeout", func() {
+				start := time.Now()
+				err := Do("adaptive", sleep(200*time.Millisecond), nil)
+				So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+				So(time.Since(start), ShouldBeLessThan, 200*time.Millisecond)
+			})
+
+			Convey("runs within the margin or MinTimeout still succeed", func() {
+				So(Do("adaptive", sleep(5*time.Millisecond), nil), ShouldBeNil)
+			})
+		})
+
+		Convey("slow failures don't lengthen it", func() {
+			cb, _, _ := GetCircuit("adaptive")
+			for i := 0; i < 5; i++ {
+				cb.metrics.record(&commandExecution{Types: []string{"success"}, Start: time.Now(), RunDuration: time.Millisecond})
+				cb.metrics.record(&commandExecution{Types: []string{"failure"}, Start: time.Now(), RunDuration: 500 * time.Millisecond})
+			}
+
+			So(cb.metrics.adaptiveTimeout(getSettings("adaptive")), ShouldEqual, 20*time.Millisecond)
+		})
+	})
+}
+
+func TestQueuedRequests(t *testing.T) {
+	Convey("with a command allowing 1 concurrent request and 1 queued request", t, func() {
+		defer Flush()
+
+		ConfigureCommand("", CommandConfig{MaxConcurrentRequests: 1, MaxQueueSize: 1, QueueTimeout: 500})
+		cb, _, err := GetCircuit("")
+		So(err, ShouldBeNil)
+
+		run := func() error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}
+
+		Convey("and 3 commands started at once", func() {
+			var errChans []chan error
+			for i := 0; i < 3; i++ {
+				errChan := make(chan error, 1)
+				go func() { errChan <- Do("", run, nil) }()
+				errChans = append(errChans, errChan)
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			Convey("the queued command runs once the first completes, and the last is rejected", func() {
+				So(<-errChans[0], ShouldBeNil)
+				So(<-errChans[1], ShouldBeNil)
+				So(errors.Is(<-errChans[2], ErrMaxConcurrency), ShouldBeTrue)
+
+				time.Sleep(10 * time.Millisecond)
+				So(cb.executorPool.ActiveCount(), ShouldEqual, 0)
+				So(cb.metrics.DefaultCollector().Successes().Sum(time.Now()), ShouldEqual, 2)
+				So(cb.metrics.DefaultCollector().Queued().Sum(time.Now()), ShouldEqual, 1)
+				So(cb.metrics.DefaultCollector().Rejects().Sum(time.Now()), ShouldEqual, 1)
+			})
+
+			Convey("the waits of the commands which received a ticket are timed", func() {
+				<-errChans[0]
+				<-errChans[1]
+				<-errChans[2]
+				Metrics("")
+
+				waits := cb.metrics.DefaultCollector().QueueWaitDuration().SortedDurations()
+				So(waits, ShouldHaveLength, 2)
+				So(waits[1], ShouldBeGreaterThanOrEqualTo, 30*time.Millisecond)
+			})
+		})
+	})
+}
+
+func TestFallbackChain(t *testing.T) {
+	Convey("with a failing command and a chain of fallbacks", t, func() {
+		defer Flush()
+
+		run := func() error {
+			return fmt.Errorf("primary failed")
+		}
+		replicaErr := make(chan error, 2)
+		replica := func(err error) error {
+			replicaErr <- err
+			return fmt.Errorf("replica failed")
+		}
+
+		Convey("the first fallback to succeed ends the chain", func() {
+			cached := make(chan error, 1)
+			errChan := GoWithFallbacks("", run, replica, func(err error) error {
+				cached <- err
+				return nil
+			}, func(err error) error {
+				panic("should not be reached")
+			})
+
+			So((<-replicaErr).Error(), ShouldEqual, "primary failed")
+			So((<-cached).Error(), ShouldEqual, "replica failed")
+
+			time.Sleep(10 * time.Millisecond)
+			So(len(errChan), ShouldEqual, 0)
+			cb, _, _ := GetCircuit("")
+			So(cb.metrics.DefaultCollector().FallbackSuccesses().Sum(time.Now()), ShouldEqual, 1)
+			So(cb.metrics.DefaultCollector().FallbackFailures().Sum(time.Now()), ShouldEqual, 0)
+		})
+
+		Convey("the last error is returned when every fallback fails", func() {
+			errChan := GoWithFallbacks("", run, replica, replica)
+
+			err := <-errChan
+			So(err.Error(), ShouldEqual, "fallback failed with 'replica failed'. run error was 'primary failed'")
+
+			time.Sleep(10 * time.Millisecond)
+			cb, _, _ := GetCircuit("")
+			So(cb.metrics.DefaultCollector().FallbackFailures().Sum(time.Now()), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestDoC(t *testing.T) {
+	Convey("with a command which succeeds", t, func() {
+		defer Flush()
+
+		out := make(chan bool, 1)
+		run := func(ctx context.Context) error {
+			out <- true
+			return nil
+		}
+
+		Convey("the run function is executed", func() {
+			err := DoC(context.Background(), "", run, nil)
+			So(err, ShouldBeNil)
+			So(<-out, ShouldEqual, true)
+		})
+	})
+
+	Convey("with a command which fails", t, func() {
+		defer Flush()
+
+		run := func(ctx context.Context) error {
+			return fmt.Errorf("i failed")
+		}
+
+		Convey("with no fallback", func() {
 			err := DoC(context.Background(), "", run, nil)
 			Convey("the error is returned", func() {
 				So(err.Error(), ShouldEqual, "i failed")
@@ -566,3 +1292,742 @@ func TestDoC(t *testing.T) {
 		})
 	})
 }
+
+func TestDoWithConfig(t *testing.T) {
+	Convey("with a command configured for a 1 second timeout", t, func() {
+		defer Flush()
+
+		ConfigureCommand("", CommandConfig{Timeout: 1000})
+		run := func() error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}
+
+		Convey("an execution with a shorter timeout override times out", func() {
+			err := DoWithConfig("", CommandConfig{Timeout: 10}, run, nil)
+			So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+
+			Convey("without changing the registered settings", func() {
+				So(getSettings("").Timeout, ShouldEqual, time.Second)
+				So(Do("", run, nil), ShouldBeNil)
+			})
+
+			Convey("and the metrics are recorded under the command name", func() {
+				time.Sleep(10 * time.Millisecond)
+				cb, _, _ := GetCircuit("")
+				So(cb.metrics.DefaultCollector().Timeouts().Sum(time.Now()), ShouldEqual, 1)
+			})
+		})
+
+		Convey("failing executions with a low error threshold override do not open the circuit", func() {
+			override := CommandConfig{RequestVolumeThreshold: 1, ErrorPercentThreshold: 1}
+			for i := 0; i < 5; i++ {
+				DoWithConfig("", override, func() error {
+					return fmt.Errorf("i failed")
+				}, nil)
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			cb, _, _ := GetCircuit("")
+			So(cb.IsOpen(), ShouldBeFalse)
+			So(Do("", run, nil), ShouldBeNil)
+		})
+
+		Convey("an execution with an empty override uses the registered settings", func() {
+			errChan := GoWithConfig("", CommandConfig{}, run, nil)
+			time.Sleep(100 * time.Millisecond)
+			So(len(errChan), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestDoCancelable(t *testing.T) {
+	Convey("with a command which runs until released", t, func() {
+		defer Flush()
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		wait, cancel := DoCancelable("cancelable", func() error {
+			close(started)
+			<-release
+			return nil
+		}, nil)
+		defer cancel()
+		<-started
+
+		Convey("canceling stops waiting before run returns and frees its ticket", func() {
+			cancel()
+			So(wait(), ShouldEqual, context.Canceled)
+
+			active, _ := ActiveCount("cancelable")
+			So(active, ShouldEqual, 0)
+			close(release)
+		})
+
+		Convey("without canceling, wait returns the result of run", func() {
+			close(release)
+			So(wait(), ShouldBeNil)
+			So(wait(), ShouldBeNil)
+		})
+	})
+}
+
+func TestIsCircuitError(t *testing.T) {
+	Convey("with a command which times out", t, func() {
+		defer Flush()
+
+		ConfigureCommand("is_circuit_error", CommandConfig{Timeout: 10})
+
+		Convey("its fallback receives ErrTimeout as a CircuitError", func() {
+			var received error
+			Do("is_circuit_error", func() error {
+				time.Sleep(50 * time.Millisecond)
+				return nil
+			}, func(err error) error {
+				received = err
+				return nil
+			})
+
+			circuitErr, ok := IsCircuitError(received)
+			So(ok, ShouldBeTrue)
+			So(errors.Is(circuitErr, ErrTimeout), ShouldBeTrue)
+		})
+	})
+
+	Convey("a wrapped CircuitError is found", t, func() {
+		circuitErr, ok := IsCircuitError(fmt.Errorf("calling users: %w", ErrCircuitOpen))
+		So(ok, ShouldBeTrue)
+		So(circuitErr, ShouldResemble, ErrCircuitOpen)
+	})
+
+	Convey("an error from run is not a CircuitError", t, func() {
+		_, ok := IsCircuitError(FallbackError{RunErr: errors.New("boom"), FallbackErr: errors.New("fallback")})
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestDoWithCause(t *testing.T) {
+	Convey("with a fallback which always succeeds", t, func() {
+		defer Flush()
+
+		fallback := func(err error) error {
+			return nil
+		}
+
+		Convey("an open circuit is reported as the cause", func() {
+			cb, _, _ := GetCircuit("")
+			cb.setOpen(causeErrors)
+
+			err, cause := DoWithCause("", func() error { return nil }, fallback)
+			So(err, ShouldBeNil)
+			So(errors.Is(cause, ErrCircuitOpen), ShouldBeTrue)
+		})
+
+		Convey("a full pool is reported as the cause", func() {
+			ConfigureCommand("", CommandConfig{MaxConcurrentRequests: 1})
+			running := make(chan struct{})
+			release := make(chan struct{})
+			go Do("", func() error {
+				close(running)
+				<-release
+				return nil
+			}, nil)
+			<-running
+			defer close(release)
+
+			err, cause := DoWithCause("", func() error { return nil }, fallback)
+			So(err, ShouldBeNil)
+			So(errors.Is(cause, ErrMaxConcurrency), ShouldBeTrue)
+		})
+
+		Convey("a run error is reported as the cause", func() {
+			runErr := fmt.Errorf("run_error")
+			err, cause := DoWithCause("", func() error { return runErr }, fallback)
+			So(err, ShouldBeNil)
+			So(cause, ShouldEqual, runErr)
+		})
+
+		Convey("a successful run has no cause", func() {
+			err, cause := DoWithCause("", func() error { return nil }, fallback)
+			So(err, ShouldBeNil)
+			So(cause, ShouldBeNil)
+		})
+	})
+
+	Convey("without a fallback the cause is the returned error", t, func() {
+		defer Flush()
+
+		ConfigureCommand("", CommandConfig{Timeout: 10})
+		err, cause := DoWithCause("", func() error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		}, nil)
+		So(errors.Is(err, ErrTimeout), ShouldBeTrue)
+		So(errors.Is(cause, ErrTimeout), ShouldBeTrue)
+	})
+}
+
+func TestDoWithOutcome(t *testing.T) {
+	Convey("with a command which has a fallback", t, func() {
+		defer Flush()
+
+		fallback := func(ctx context.Context, err error) error {
+			return nil
+		}
+
+		Convey("a successful run is not served by the fallback", func() {
+			outcome, err := DoWithOutcome(context.Background(), "", func(ctx context.Context) error {
+				return nil
+			}, fallback)
+			So(err, ShouldBeNil)
+			So(outcome.FromFallback, ShouldBeFalse)
+			So(outcome.Cause, ShouldBeNil)
+		})
+
+		Convey("a failed run is served by the fallback", func() {
+			runErr := fmt.Errorf("run_error")
+			outcome, err := DoWithOutcome(context.Background(), "", func(ctx context.Context) error {
+				return runErr
+			}, fallback)
+			So(err, ShouldBeNil)
+			So(outcome.FromFallback, ShouldBeTrue)
+			So(outcome.Cause, ShouldEqual, runErr)
+		})
+
+		Convey("a failed fallback serves nothing", func() {
+			outcome, err := DoWithOutcome(context.Background(), "", func(ctx context.Context) error {
+				return fmt.Errorf("run_error")
+			}, func(ctx context.Context, err error) error {
+				return fmt.Errorf("fallback_error")
+			})
+			So(err, ShouldNotBeNil)
+			So(outcome.FromFallback, ShouldBeFalse)
+			So(outcome.Cause.Error(), ShouldEqual, "run_error")
+		})
+	})
+}
+
+func TestExecute(t *testing.T) {
+	Convey("with a typed command which has a fallback", t, func() {
+		defer Flush()
+
+		fallback := func(ctx context.Context, err error) (string, error) {
+			return "fallback", nil
+		}
+
+		Convey("a successful run returns its value", func() {
+			result, outcome, err := Execute(context.Background(), "execute", func(ctx context.Context) (string, error) {
+				time.Sleep(10 * time.Millisecond)
+				return "run", nil
+			}, fallback)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "run")
+			So(outcome.FromFallback, ShouldBeFalse)
+			So(outcome.Cause, ShouldBeNil)
+			So(outcome.Latency, ShouldBeGreaterThanOrEqualTo, 10*time.Millisecond)
+		})
+
+		Convey("a failed run returns the value of the fallback", func() {
+			result, outcome, err := Execute(context.Background(), "execute", func(ctx context.Context) (string, error) {
+				return "ignored", fmt.Errorf("run_error")
+			}, fallback)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "fallback")
+			So(outcome.FromFallback, ShouldBeTrue)
+			So(outcome.Cause.Error(), ShouldEqual, "run_error")
+		})
+
+		Convey("a circuit error without a fallback returns the zero value", func() {
+			cb, _, err := GetCircuit("execute_open")
+			So(err, ShouldBeNil)
+			cb.toggleForceOpen(true)
+
+			result, outcome, err := Execute(context.Background(), "execute_open", func(ctx context.Context) (string, error) {
+				return "run", nil
+			}, nil)
+			So(errors.Is(err, ErrCircuitOpen), ShouldBeTrue)
+			So(result, ShouldEqual, "")
+			So(outcome.FromFallback, ShouldBeFalse)
+			So(errors.Is(outcome.Cause, ErrCircuitOpen), ShouldBeTrue)
+		})
+	})
+}
+
+func TestDoBatch(t *testing.T) {
+	Convey("with a command which runs 2 at a time", t, func() {
+		defer Flush()
+
+		ConfigureCommand("batch", CommandConfig{MaxConcurrentRequests: 2})
+
+		Convey("a batch of 10 runs every item and returns their errors in order", func() {
+			var mu sync.Mutex
+			running, peak := 0, 0
+			runs := make([]func() error, 10)
+			for i := range runs {
+				i := i
+				runs[i] = func() error {
+					mu.Lock()
+					running++
+					if running > peak {
+						peak = running
+					}
+					mu.Unlock()
+					time.Sleep(5 * time.Millisecond)
+					mu.Lock()
+					running--
+					mu.Unlock()
+
+					if i%3 == 0 {
+						return fmt.Errorf("item %d", i)
+					}
+					return nil
+				}
+			}
+
+			errs := DoBatch("batch", runs, nil)
+			So(errs, ShouldHaveLength, 10)
+			for i, err := range errs {
+				if i%3 == 0 {
+					So(err.Error(), ShouldEqual, fmt.Sprintf("item %d", i))
+				} else {
+					So(err, ShouldBeNil)
+				}
+			}
+			So(peak, ShouldBeLessThanOrEqualTo, 2)
+
+			snapshot, _ := Metrics("batch")
+			So(snapshot.Rejects, ShouldEqual, 0)
+		})
+
+		Convey("the fallback covers each failing item", func() {
+			errs := DoBatch("batch", []func() error{
+				func() error { return fmt.Errorf("boom") },
+				func() error { return nil },
+			}, func(err error) error {
+				return nil
+			})
+			So(errs, ShouldResemble, []error{nil, nil})
+		})
+	})
+}
+
+func TestDoTyped(t *testing.T) {
+	Convey("with a command which succeeds", t, func() {
+		defer Flush()
+
+		result, err := DoTyped("", func() (int, error) {
+			return 1, nil
+		}, nil)
+
+		Convey("the run result is returned", func() {
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, 1)
+		})
+	})
+
+	Convey("with a command which fails", t, func() {
+		defer Flush()
+
+		run := func() (string, error) {
+			return "", fmt.Errorf("i failed")
+		}
+
+		Convey("with a succeeding fallback", func() {
+			result, err := DoTyped("", run, func(err error) (string, error) {
+				return "fallback", nil
+			})
+
+			Convey("the fallback result is returned", func() {
+				So(err, ShouldBeNil)
+				So(result, ShouldEqual, "fallback")
+			})
+		})
+
+		Convey("with a failing fallback", func() {
+			result, err := DoTyped("", run, func(err error) (string, error) {
+				return "ignored", fmt.Errorf("fallback failed")
+			})
+
+			Convey("the zero value and both errors are returned", func() {
+				So(result, ShouldEqual, "")
+				So(err.Error(), ShouldEqual, "fallback failed with 'fallback failed'. run error was 'i failed'")
+			})
+		})
+	})
+
+	Convey("with a command which returns after timing out", t, func() {
+		defer Flush()
+
+		ConfigureCommand("", CommandConfig{Timeout: 10})
+		_, _, err := GetCircuit("")
+		So(err, ShouldBeNil)
+		goroutines := runtime.NumGoroutine()
+
+		returned := make(chan bool, 1)
+		result, err := DoTyped("", func() (int, error) {
+			time.Sleep(50 * time.Millisecond)
+			returned <- true
+			return 1, nil
+		}, func(err error) (int, error) {
+			return 2, nil
+		})
+
+		Convey("the fallback result is returned and the run goroutine exits", func() {
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, 2)
+
+			<-returned
+			time.Sleep(50 * time.Millisecond)
+			So(runtime.NumGoroutine(), ShouldBeLessThanOrEqualTo, goroutines)
+		})
+	})
+
+	Convey("with an open circuit and no fallback", t, func() {
+		defer Flush()
+
+		cb, _, err := GetCircuit("")
+		So(err, ShouldBeNil)
+		cb.setOpen(causeErrors)
+
+		result, err := DoTyped("", func() (*struct{}, error) {
+			return &struct{}{}, nil
+		}, nil)
+
+		Convey("the zero value and circuit error are returned", func() {
+			So(result, ShouldBeNil)
+			So(errors.Is(err, ErrCircuitOpen), ShouldBeTrue)
+		})
+	})
+}
+
+func TestGoWeighted(t *testing.T) {
+	Convey("with a command which has 3 tickets", t, func() {
+		defer Flush()
+
+		ConfigureCommand("weighted", CommandConfig{MaxConcurrentRequests: 3})
+
+		Convey("a heavy execution takes several tickets until it finishes", func() {
+			release := make(chan struct{})
+			started := make(chan struct{})
+			heavy := GoWeighted("weighted", 2, func() error {
+				close(started)
+				<-release
+				return nil
+			}, nil)
+			<-started
+
+			cb, _, _ := GetCircuit("weighted")
+			So(cb.executorPool.ActiveCount(), ShouldEqual, 2)
+
+			So(errors.Is(<-GoWeighted("weighted", 2, func() error { return nil }, nil), ErrMaxConcurrency), ShouldBeTrue)
+			So(Do("weighted", func() error { return nil }, nil), ShouldBeNil)
+
+			close(release)
+			select {
+			case err := <-heavy:
+				t.Fatal(err)
+			case <-time.After(50 * time.Millisecond):
+			}
+			So(cb.executorPool.ActiveCount(), ShouldEqual, 0)
+		})
+
+		Convey("an execution heavier than the pool is always rejected", func() {
+			So(errors.Is(<-GoWeighted("weighted", 4, func() error { return nil }, nil), ErrMaxConcurrency), ShouldBeTrue)
+		})
+	})
+}
+
+func TestRetries(t *testing.T) {
+	Convey("with a command which retries twice", t, func() {
+		defer Flush()
+
+		ConfigureCommand("retries", CommandConfig{MaxRetries: 2, RetryBackoff: 1})
+		calls := 0
+
+		Convey("a run function which fails twice then succeeds is recorded as one success", func() {
+			err := Do("retries", func() error {
+				calls++
+				if calls < 3 {
+					return fmt.Errorf("transient")
+				}
+				return nil
+			}, nil)
+			So(err, ShouldBeNil)
+			So(calls, ShouldEqual, 3)
+
+			snapshot, _ := Metrics("retries")
+			So(snapshot.Attempts, ShouldEqual, 1)
+			So(snapshot.Successes, ShouldEqual, 1)
+			So(snapshot.Failures, ShouldEqual, 0)
+			So(snapshot.Retries, ShouldEqual, 2)
+		})
+
+		Convey("a run function which keeps failing is recorded as one failure", func() {
+			err := Do("retries", func() error {
+				calls++
+				return fmt.Errorf("boom")
+			}, nil)
+			So(err.Error(), ShouldEqual, "boom")
+			So(calls, ShouldEqual, 3)
+
+			snapshot, _ := Metrics("retries")
+			So(snapshot.Attempts, ShouldEqual, 1)
+			So(snapshot.Failures, ShouldEqual, 1)
+			So(snapshot.Retries, ShouldEqual, 2)
+		})
+
+		Convey("an ignorable error is not retried", func() {
+			err := DoWithConfig("retries", CommandConfig{IsErrorIgnorable: func(error) bool { return true }}, func() error {
+				calls++
+				return fmt.Errorf("not found")
+			}, nil)
+			So(err.Error(), ShouldEqual, "not found")
+			So(calls, ShouldEqual, 1)
+		})
+	})
+
+	Convey("with a command whose retries would outlast its timeout", t, func() {
+		defer Flush()
+
+		ConfigureCommand("retries-timeout", CommandConfig{Timeout: 200, MaxRetries: 5, RetryBackoff: 50})
+
+		Convey("it stops retrying once the next backoff would end after the timeout", func() {
+			var calls int32
+			err := Do("retries-timeout", func() error {
+				atomic.AddInt32(&calls, 1)
+				return fmt.Errorf("boom")
+			}, nil)
+			So(err.Error(), ShouldEqual, "boom")
+			So(atomic.LoadInt32(&calls), ShouldEqual, 3)
+		})
+	})
+}
+
+func TestTimeoutRacesCompletion(t *testing.T) {
+	Convey("when thousands of commands finish just as they time out", t, func() {
+		Flush()
+		time.Sleep(10 * time.Millisecond)
+		baseline := runtime.NumGoroutine()
+		defer Flush()
+
+		ConfigureCommand("errchan-race", CommandConfig{Timeout: 1, MaxConcurrentRequests: 1000, MonitorOnly: true})
+
+		var sent int32
+		for round := 0; round < 20; round++ {
+			var runs sync.WaitGroup
+			errChans := make([]chan error, 100)
+			runs.Add(len(errChans))
+			for i := range errChans {
+				errChans[i] = Go("errchan-race", func() error {
+					defer runs.Done()
+					time.Sleep(time.Millisecond)
+					return fmt.Errorf("boom")
+				}, func(err error) error {
+					return err
+				})
+			}
+			runs.Wait()
+
+			// only every other channel is read, so the rest must never block a sender
+			for i := 0; i < len(errChans); i += 2 {
+				select {
+				case <-errChans[i]:
+					atomic.AddInt32(&sent, 1)
+				case <-time.After(time.Second):
+				}
+			}
+		}
+
+		Convey("every read channel held exactly one error", func() {
+			So(sent, ShouldEqual, 1000)
+		})
+
+		Convey("no goroutine is left blocked sending", func() {
+			time.Sleep(100 * time.Millisecond)
+			So(runtime.NumGoroutine(), ShouldBeLessThanOrEqualTo, baseline+2)
+		})
+	})
+}
+
+func TestTimeoutRacesFinish(t *testing.T) {
+	Convey("when many commands finish at about the moment they time out", t, func() {
+		defer Flush()
+		ConfigureCommand("finish-race", CommandConfig{Timeout: 1, MaxConcurrentRequests: 500, MonitorOnly: true})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 500; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				DoC(context.Background(), "finish-race", func(ctx context.Context) error {
+					time.Sleep(time.Duration(i%3) * 500 * time.Microsecond)
+					return nil
+				}, nil)
+			}(i)
+		}
+		wg.Wait()
+
+		Convey("each is recorded exactly once, as a success or a timeout", func() {
+			snapshot, err := Metrics("finish-race")
+			So(err, ShouldBeNil)
+			So(snapshot.Attempts, ShouldEqual, 500)
+			So(snapshot.Successes+snapshot.Timeouts, ShouldEqual, 500)
+		})
+
+		Convey("every ticket is returned", func() {
+			So(PoolIntegrityCheck("finish-race"), ShouldBeNil)
+		})
+	})
+}
+
+func TestCancelRacesFinish(t *testing.T) {
+	Convey("when many commands are canceled at about the moment they finish or time out", t, func() {
+		defer Flush()
+		ConfigureCommand("cancel-race", CommandConfig{Timeout: 2, MaxConcurrentRequests: 500, MonitorOnly: true})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 500; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(time.Millisecond, cancel)
+				DoC(ctx, "cancel-race", func(ctx context.Context) error {
+					time.Sleep(time.Duration(i%4) * 500 * time.Microsecond)
+					return nil
+				}, nil)
+				cancel()
+			}(i)
+		}
+		wg.Wait()
+
+		Convey("each is recorded exactly once", func() {
+			snapshot, err := Metrics("cancel-race")
+			So(err, ShouldBeNil)
+			cb, _, _ := GetCircuit("cancel-race")
+			canceled := int(cb.metrics.DefaultCollector().ContextCanceled().Sum(time.Now()))
+			So(snapshot.Attempts, ShouldEqual, 500)
+			So(snapshot.Successes+snapshot.Timeouts+canceled, ShouldEqual, 500)
+		})
+
+		Convey("every ticket is returned", func() {
+			So(PoolIntegrityCheck("cancel-race"), ShouldBeNil)
+		})
+	})
+}
+
+func TestDoResult(t *testing.T) {
+	Convey("with a command which times out after 20ms", t, func() {
+		defer Flush()
+
+		ConfigureCommand("result", CommandConfig{Timeout: 20})
+
+		Convey("the fallback receives the partial result of a run which timed out", func() {
+			release := make(chan struct{})
+			defer close(release)
+
+			var cause error
+			rows, err := DoResult("result", func(partial *Partial[[]string]) ([]string, error) {
+				partial.Set([]string{"a"})
+				partial.Set([]string{"a", "b"})
+				<-release
+				return []string{"a", "b", "c"}, nil
+			}, func(partial []string, err error) ([]string, error) {
+				cause = err
+				return partial, nil
+			})
+			So(err, ShouldBeNil)
+			So(errors.Is(cause, ErrTimeout), ShouldBeTrue)
+			So(rows, ShouldResemble, []string{"a", "b"})
+		})
+
+		Convey("a run which completes returns its own result", func() {
+			rows, err := DoResult("result", func(partial *Partial[[]string]) ([]string, error) {
+				partial.Set([]string{"a"})
+				return []string{"a", "b"}, nil
+			}, nil)
+			So(err, ShouldBeNil)
+			So(rows, ShouldResemble, []string{"a", "b"})
+		})
+
+		Convey("without a partial result the fallback receives the zero value", func() {
+			rows, err := DoResult("result", func(partial *Partial[[]string]) ([]string, error) {
+				return nil, fmt.Errorf("boom")
+			}, func(partial []string, err error) ([]string, error) {
+				So(partial, ShouldBeNil)
+				return nil, fmt.Errorf("fallback: %v", err)
+			})
+			So(rows, ShouldBeNil)
+			So(err.Error(), ShouldContainSubstring, "fallback: boom")
+		})
+	})
+}
+
+func TestTicketsAfterTimeoutRaces(t *testing.T) {
+	Convey("when commands keep finishing just as they time out", t, func() {
+		defer Flush()
+
+		ConfigureCommand("ticket-race", CommandConfig{Timeout: 1, MaxConcurrentRequests: 50, MonitorOnly: true})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 2000; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				Do("ticket-race", func() error {
+					time.Sleep(time.Duration(i%3) * time.Millisecond)
+					if i%2 == 0 {
+						return fmt.Errorf("boom")
+					}
+					return nil
+				}, nil)
+			}(i)
+		}
+		wg.Wait()
+		time.Sleep(20 * time.Millisecond)
+
+		Convey("every ticket is back in the pool exactly once", func() {
+			So(PoolIntegrityCheck("ticket-race"), ShouldBeNil)
+			active, _ := ActiveCount("ticket-race")
+			So(active, ShouldEqual, 0)
+
+			cb, _, _ := GetCircuit("ticket-race")
+			So(len(cb.executorPool.Tickets), ShouldEqual, 50)
+		})
+	})
+}
+
+func BenchmarkDo(b *testing.B) {
+	defer Flush()
+	ConfigureCommand("benchmark", CommandConfig{MaxConcurrentRequests: 100})
+	run := func() error { return nil }
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Do("benchmark", run, nil)
+	}
+}
+
+func BenchmarkGoroutinesPerCommand(b *testing.B) {
+	defer Flush()
+	ConfigureCommand("benchmark-goroutines", CommandConfig{MaxConcurrentRequests: 100})
+	settings := getSettings("benchmark-goroutines")
+
+	var goroutines int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		started, release := make(chan struct{}), make(chan struct{})
+		before := runtime.NumGoroutine()
+		cmd := startCommand(context.Background(), "benchmark-goroutines", settings, func(ctx context.Context) error {
+			close(started)
+			<-release
+			return nil
+		}, nil, 1, nil)
+		<-started
+		goroutines += runtime.NumGoroutine() - before
+		close(release)
+		<-cmd.reported
+	}
+	b.ReportMetric(float64(goroutines)/float64(b.N), "goroutines/op")
+}
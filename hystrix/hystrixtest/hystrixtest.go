@@ -0,0 +1,119 @@
+// Package hystrixtest provides helpers for asserting how hystrix circuits behave in unit tests,
+// without sleeping through sleep windows or reading metrics by hand.
+//
+// It is a package of its own so that production code importing hystrix does not depend on testing.
+package hystrixtest
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/afex/hystrix-go/hystrix"
+)
+
+// T is the part of testing.TB used by the helpers. *testing.T and *testing.B satisfy it.
+type T interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// errTrip is returned by the executions TripCircuit uses to open a circuit.
+var errTrip = errors.New("hystrixtest: tripping circuit")
+
+// maxTripAttempts bounds the failures TripCircuit sends before giving up on a circuit which never opens.
+const maxTripAttempts = 10000
+
+// AssertOpen fails the test unless the named circuit is open, whether half-open, forced open or not.
+func AssertOpen(t T, name string) {
+	t.Helper()
+
+	state, err := hystrix.GetCircuitState(name)
+	if err != nil {
+		t.Fatalf("hystrixtest: circuit %q: %v", name, err)
+		return
+	}
+	switch state {
+	case hystrix.CircuitOpen, hystrix.CircuitHalfOpen, hystrix.CircuitForcedOpen:
+	default:
+		t.Fatalf("hystrixtest: circuit %q is %v, want open", name, state)
+	}
+}
+
+// AssertClosed fails the test unless the named circuit is closed, including by ForceClose.
+func AssertClosed(t T, name string) {
+	t.Helper()
+
+	state, err := hystrix.GetCircuitState(name)
+	if err != nil {
+		t.Fatalf("hystrixtest: circuit %q: %v", name, err)
+		return
+	}
+	switch state {
+	case hystrix.CircuitClosed, hystrix.CircuitForcedClosed:
+	default:
+		t.Fatalf("hystrixtest: circuit %q is %v, want closed", name, state)
+	}
+}
+
+// TripCircuit opens the named circuit the way failures would in production: it executes the command
+// with a failing run function, and no fallback, until the circuit opens. The failures are recorded in
+// the command's metrics. The test fails if the circuit doesn't open, for instance because it is
+// MonitorOnly or forced closed.
+func TripCircuit(t T, name string) {
+	t.Helper()
+
+	for i := 0; i < maxTripAttempts; i++ {
+		err := hystrix.Do(name, func() error { return errTrip }, nil)
+		if errors.Is(err, hystrix.ErrCircuitOpen) {
+			return
+		}
+		if circuit, _, _ := hystrix.GetCircuit(name); circuit != nil && circuit.IsOpen() {
+			return
+		}
+	}
+	t.Fatalf("hystrixtest: circuit %q did not open after %d failures", name, maxTripAttempts)
+}
+
+// DrainPool takes every ticket of the named command's executor pool by starting MaxConcurrentRequests
+// executions which block, without a timeout, until release is called, so that further executions are
+// rejected with ErrMaxConcurrency. release waits for them to finish, and is also called when the test
+// ends. It may be called more than once.
+func DrainPool(t T, name string) (release func()) {
+	t.Helper()
+
+	max := hystrix.GetConfig(name).MaxConcurrentRequests
+	block := make(chan struct{})
+	var finished sync.WaitGroup
+	for i := 0; i < max; i++ {
+		started := make(chan struct{})
+		finished.Add(1)
+		errChan := hystrix.GoWithConfig(name, hystrix.CommandConfig{Timeout: hystrix.NoTimeout}, func() error {
+			defer finished.Done()
+			close(started)
+			<-block
+			return nil
+		}, nil)
+
+		select {
+		case <-started:
+		case err := <-errChan:
+			// the execution was turned away, so its run function will never be called
+			finished.Done()
+			close(block)
+			finished.Wait()
+			t.Fatalf("hystrixtest: could not drain the pool of %q: %v", name, err)
+			return func() {}
+		}
+	}
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			close(block)
+			finished.Wait()
+		})
+	}
+	t.Cleanup(release)
+	return release
+}
@@ -0,0 +1,83 @@
+package hystrixtest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/afex/hystrix-go/hystrix"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// recordingT records the failures of a helper instead of failing the test running it.
+type recordingT struct {
+	failures []string
+	cleanups []func()
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Fatalf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingT) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func TestCircuitAssertions(t *testing.T) {
+	Convey("with a command which opens after 5 requests", t, func() {
+		defer hystrix.Flush()
+
+		hystrix.ConfigureCommand("hystrixtest.trip", hystrix.CommandConfig{RequestVolumeThreshold: 5})
+		rt := &recordingT{}
+
+		Convey("a new circuit is closed", func() {
+			AssertClosed(rt, "hystrixtest.trip")
+			So(rt.failures, ShouldBeEmpty)
+
+			AssertOpen(rt, "hystrixtest.trip")
+			So(rt.failures, ShouldHaveLength, 1)
+		})
+
+		Convey("TripCircuit opens it", func() {
+			TripCircuit(rt, "hystrixtest.trip")
+			AssertOpen(rt, "hystrixtest.trip")
+			So(rt.failures, ShouldBeEmpty)
+
+			So(errors.Is(hystrix.Do("hystrixtest.trip", func() error { return nil }, nil), hystrix.ErrCircuitOpen), ShouldBeTrue)
+		})
+
+		Convey("TripCircuit fails the test if the circuit is forced closed", func() {
+			hystrix.ForceClose("hystrixtest.trip")
+			defer hystrix.ClearForced("hystrixtest.trip")
+
+			TripCircuit(rt, "hystrixtest.trip")
+			So(rt.failures, ShouldHaveLength, 1)
+		})
+	})
+}
+
+func TestDrainPool(t *testing.T) {
+	Convey("with a command which runs 3 at a time", t, func() {
+		defer hystrix.Flush()
+
+		hystrix.ConfigureCommand("hystrixtest.drain", hystrix.CommandConfig{MaxConcurrentRequests: 3})
+		rt := &recordingT{}
+
+		Convey("DrainPool rejects executions until released", func() {
+			release := DrainPool(rt, "hystrixtest.drain")
+			So(rt.failures, ShouldBeEmpty)
+			So(rt.cleanups, ShouldHaveLength, 1)
+
+			err := hystrix.Do("hystrixtest.drain", func() error { return nil }, nil)
+			So(errors.Is(err, hystrix.ErrMaxConcurrency), ShouldBeTrue)
+
+			release()
+			So(hystrix.Do("hystrixtest.drain", func() error { return nil }, nil), ShouldBeNil)
+
+			// the cleanup registered with the test is safe to run as well
+			rt.cleanups[0]()
+		})
+	})
+}
@@ -1,11 +1,56 @@
 package hystrix
 
+import (
+	"fmt"
+	"strings"
+)
+
 type logger interface {
 	Printf(format string, items ...interface{})
 }
 
+// Logger receives leveled messages from the hystrix package. keyvals are alternating keys and values
+// describing the message, such as "circuit" and the name of the circuit.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+}
+
 // NoopLogger does not log anything.
 type NoopLogger struct{}
 
 // Printf does nothing.
 func (l NoopLogger) Printf(format string, items ...interface{}) {}
+
+// Debug does nothing.
+func (l NoopLogger) Debug(msg string, keyvals ...interface{}) {}
+
+// Info does nothing.
+func (l NoopLogger) Info(msg string, keyvals ...interface{}) {}
+
+// Warn does nothing.
+func (l NoopLogger) Warn(msg string, keyvals ...interface{}) {}
+
+// printfLogger adapts a Printf-style logger to Logger, writing every level as a single line.
+type printfLogger struct {
+	l logger
+}
+
+func (p printfLogger) Debug(msg string, keyvals ...interface{}) { p.print(msg, keyvals) }
+func (p printfLogger) Info(msg string, keyvals ...interface{})  { p.print(msg, keyvals) }
+func (p printfLogger) Warn(msg string, keyvals ...interface{})  { p.print(msg, keyvals) }
+
+func (p printfLogger) print(msg string, keyvals []interface{}) {
+	var b strings.Builder
+	b.WriteString("hystrix-go: ")
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		if i+1 < len(keyvals) {
+			fmt.Fprintf(&b, " %v=%v", keyvals[i], keyvals[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", keyvals[i])
+		}
+	}
+	p.l.Printf("%s", b.String())
+}
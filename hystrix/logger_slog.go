@@ -0,0 +1,29 @@
+//go:build go1.21
+
+package hystrix
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NewSlogLogger returns a Logger which writes to l, for use with SetStructuredLogger.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) Debug(msg string, keyvals ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelDebug, msg, keyvals...)
+}
+
+func (s slogLogger) Info(msg string, keyvals ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelInfo, msg, keyvals...)
+}
+
+func (s slogLogger) Warn(msg string, keyvals ...interface{}) {
+	s.l.Log(context.Background(), slog.LevelWarn, msg, keyvals...)
+}
@@ -0,0 +1,28 @@
+//go:build go1.21
+
+package hystrix
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSlogLogger(t *testing.T) {
+	Convey("with a slog logger", t, func() {
+		defer Flush()
+		defer SetLogger(DefaultLogger)
+
+		var buf bytes.Buffer
+		SetStructuredLogger(NewSlogLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+
+		Convey("messages are written at their level with their fields", func() {
+			cb, _, _ := GetCircuit("slog")
+			cb.setOpen(causeErrors)
+
+			So(buf.String(), ShouldContainSubstring, `level=WARN msg="opening circuit" circuit=slog`)
+		})
+	})
+}
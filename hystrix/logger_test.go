@@ -0,0 +1,68 @@
+package hystrix
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type printfRecorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (r *printfRecorder) Printf(format string, items ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, fmt.Sprintf(format, items...))
+}
+
+type leveledRecorder struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (r *leveledRecorder) record(level, msg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, level+": "+msg)
+}
+
+func (r *leveledRecorder) Debug(msg string, keyvals ...interface{}) { r.record("debug", msg) }
+func (r *leveledRecorder) Info(msg string, keyvals ...interface{})  { r.record("info", msg) }
+func (r *leveledRecorder) Warn(msg string, keyvals ...interface{})  { r.record("warn", msg) }
+
+func TestLogger(t *testing.T) {
+	Convey("with a Printf-style logger", t, func() {
+		defer Flush()
+		defer SetLogger(DefaultLogger)
+
+		recorder := &printfRecorder{}
+		SetLogger(recorder)
+
+		Convey("messages are written with their fields", func() {
+			cb, _, _ := GetCircuit("logger")
+			cb.setOpen(causeErrors)
+
+			So(recorder.lines, ShouldContain, "hystrix-go: opening circuit circuit=logger")
+		})
+	})
+
+	Convey("with a structured logger", t, func() {
+		defer Flush()
+		defer SetLogger(DefaultLogger)
+
+		recorder := &leveledRecorder{}
+		SetStructuredLogger(recorder)
+
+		Convey("circuit state changes are logged at their level", func() {
+			cb, _, _ := GetCircuit("logger")
+			cb.setOpen(causeErrors)
+			cb.setClose()
+
+			So(recorder.messages, ShouldResemble, []string{"warn: opening circuit", "info: closing circuit"})
+		})
+	})
+}
@@ -2,6 +2,7 @@ package metricCollector
 
 import (
 	"sync"
+	"time"
 
 	"github.com/afex/hystrix-go/hystrix/rolling"
 )
@@ -25,20 +26,58 @@ type DefaultMetricCollector struct {
 	timeouts                *rolling.Number
 	contextCanceled         *rolling.Number
 	contextDeadlineExceeded *rolling.Number
+	queued                  *rolling.Number
+	noFallback              *rolling.Number
+	retries                 *rolling.Number
+	fallbackDegraded        *rolling.Number
+	blocked                 *rolling.Number
+	fallbackRejects         *rolling.Number
 
 	fallbackSuccesses *rolling.Number
 	fallbackFailures  *rolling.Number
 	totalDuration     *rolling.Timing
 	runDuration       *rolling.Timing
+	fallbackDuration  *rolling.Timing
+	queueWaitDuration *rolling.Timing
+
+	window  time.Duration
+	buckets int
 }
 
 func newDefaultMetricCollector(name string) MetricCollector {
 	m := &DefaultMetricCollector{}
 	m.mutex = &sync.RWMutex{}
+	m.window = rolling.DefaultWindow
+	m.buckets = rolling.DefaultBuckets
 	m.Reset()
 	return m
 }
 
+// Window returns the rolling window over which counts are kept
+func (d *DefaultMetricCollector) Window() time.Duration {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.window
+}
+
+// Buckets returns the number of buckets the rolling window is divided into
+func (d *DefaultMetricCollector) Buckets() int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.buckets
+}
+
+// ConfigureWindow changes the rolling window over which counts are kept and resets all metrics.
+// Durations are kept over the same window if it is longer than rolling.DefaultTimingWindow.
+func (d *DefaultMetricCollector) ConfigureWindow(window time.Duration, buckets int) {
+	d.mutex.Lock()
+	d.window = window
+	d.buckets = buckets
+	d.mutex.Unlock()
+
+	d.Reset()
+}
+
 // NumRequests returns the rolling number of requests
 func (d *DefaultMetricCollector) NumRequests() *rolling.Number {
 	d.mutex.RLock()
@@ -107,6 +146,48 @@ func (d *DefaultMetricCollector) ContextDeadlineExceeded() *rolling.Number {
 	return d.contextDeadlineExceeded
 }
 
+// Queued returns the rolling number of commands which waited for a ticket before running
+func (d *DefaultMetricCollector) Queued() *rolling.Number {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.queued
+}
+
+// NoFallback returns the rolling number of commands which failed without a fallback to cover them
+func (d *DefaultMetricCollector) NoFallback() *rolling.Number {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.noFallback
+}
+
+// Retries returns the rolling number of times run functions were retried
+func (d *DefaultMetricCollector) Retries() *rolling.Number {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.retries
+}
+
+// FallbackDegraded returns the rolling number of fallback successes which served a degraded result
+func (d *DefaultMetricCollector) FallbackDegraded() *rolling.Number {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.fallbackDegraded
+}
+
+// Blocked returns the rolling number of executions turned away by BlockCommand
+func (d *DefaultMetricCollector) Blocked() *rolling.Number {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.blocked
+}
+
+// FallbackRejects returns the rolling number of fallbacks rejected by MaxConcurrentFallbacks
+func (d *DefaultMetricCollector) FallbackRejects() *rolling.Number {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.fallbackRejects
+}
+
 // FallbackFailures returns the rolling number of fallback failures
 func (d *DefaultMetricCollector) FallbackFailures() *rolling.Number {
 	d.mutex.RLock()
@@ -128,6 +209,20 @@ func (d *DefaultMetricCollector) RunDuration() *rolling.Timing {
 	return d.runDuration
 }
 
+// QueueWaitDuration returns the rolling duration of the waits for a ticket
+func (d *DefaultMetricCollector) QueueWaitDuration() *rolling.Timing {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.queueWaitDuration
+}
+
+// FallbackDuration returns the rolling duration of fallbacks
+func (d *DefaultMetricCollector) FallbackDuration() *rolling.Timing {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.fallbackDuration
+}
+
 func (d *DefaultMetricCollector) Update(r MetricResult) {
 	d.mutex.RLock()
 	defer d.mutex.RUnlock()
@@ -143,9 +238,23 @@ func (d *DefaultMetricCollector) Update(r MetricResult) {
 	d.fallbackFailures.Increment(r.FallbackFailures)
 	d.contextCanceled.Increment(r.ContextCanceled)
 	d.contextDeadlineExceeded.Increment(r.ContextDeadlineExceeded)
+	d.queued.Increment(r.Queued)
+	d.noFallback.Increment(r.NoFallback)
+	d.retries.Increment(r.Retries)
+	d.fallbackDegraded.Increment(r.FallbackDegraded)
+	d.blocked.Increment(r.Blocked)
+	d.fallbackRejects.Increment(r.FallbackRejects)
 
 	d.totalDuration.Add(r.TotalDuration)
-	d.runDuration.Add(r.RunDuration)
+	if r.Executed {
+		d.runDuration.Add(r.RunDuration)
+	}
+	if r.QueueWaitDuration > 0 {
+		d.queueWaitDuration.Add(r.QueueWaitDuration)
+	}
+	if r.FallbackSuccesses > 0 || r.FallbackFailures > 0 {
+		d.fallbackDuration.Add(r.FallbackDuration)
+	}
 }
 
 // Reset resets all metrics in this collector to 0.
@@ -153,17 +262,35 @@ func (d *DefaultMetricCollector) Reset() {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
-	d.numRequests = rolling.NewNumber()
-	d.errors = rolling.NewNumber()
-	d.successes = rolling.NewNumber()
-	d.rejects = rolling.NewNumber()
-	d.shortCircuits = rolling.NewNumber()
-	d.failures = rolling.NewNumber()
-	d.timeouts = rolling.NewNumber()
-	d.fallbackSuccesses = rolling.NewNumber()
-	d.fallbackFailures = rolling.NewNumber()
-	d.contextCanceled = rolling.NewNumber()
-	d.contextDeadlineExceeded = rolling.NewNumber()
-	d.totalDuration = rolling.NewTiming()
-	d.runDuration = rolling.NewTiming()
+	newNumber := func() *rolling.Number {
+		return rolling.NewNumberWithWindow(d.window, d.buckets)
+	}
+	newTiming := func() *rolling.Timing {
+		if d.window <= rolling.DefaultTimingWindow {
+			return rolling.NewTiming()
+		}
+		return rolling.NewTimingWithWindow(d.window, d.buckets)
+	}
+
+	d.numRequests = newNumber()
+	d.errors = newNumber()
+	d.successes = newNumber()
+	d.rejects = newNumber()
+	d.shortCircuits = newNumber()
+	d.failures = newNumber()
+	d.timeouts = newNumber()
+	d.fallbackSuccesses = newNumber()
+	d.fallbackFailures = newNumber()
+	d.contextCanceled = newNumber()
+	d.contextDeadlineExceeded = newNumber()
+	d.queued = newNumber()
+	d.noFallback = newNumber()
+	d.retries = newNumber()
+	d.fallbackDegraded = newNumber()
+	d.blocked = newNumber()
+	d.fallbackRejects = newNumber()
+	d.totalDuration = newTiming()
+	d.runDuration = newTiming()
+	d.fallbackDuration = newTiming()
+	d.queueWaitDuration = newTiming()
 }
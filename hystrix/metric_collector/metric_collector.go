@@ -2,6 +2,7 @@ package metricCollector
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -9,34 +10,118 @@ import (
 // collect statistics about the health of the circuit.
 var Registry = metricCollectorRegistry{
 	lock: &sync.RWMutex{},
-	registry: []func(name string) MetricCollector{
-		newDefaultMetricCollector,
+	registry: []registeredCollector{
+		{initializer: newDefaultMetricCollector},
 	},
 }
 
+// A CollectorID identifies a MetricCollector Initializer placed in the Registry, so that it can be removed.
+type CollectorID uint64
+
+type registeredCollector struct {
+	id          CollectorID
+	initializer func(name string) MetricCollector
+}
+
 type metricCollectorRegistry struct {
-	lock     *sync.RWMutex
-	registry []func(name string) MetricCollector
+	// generation is changed by every Register, Deregister and Clear, so that circuits can tell
+	// cheaply whether their collectors are current. It is first to stay 64-bit aligned.
+	generation uint64
+	lock       *sync.RWMutex
+	registry   []registeredCollector
+	lastID     CollectorID
+}
+
+// CollectorSet holds the collectors the Registry created for one command, so that they can
+// be brought up to date with Refresh.
+type CollectorSet struct {
+	generation uint64
+	ids        []CollectorID
+	collectors []MetricCollector
+}
+
+// Collectors returns the collectors in the set. The slice must not be modified.
+func (s CollectorSet) Collectors() []MetricCollector {
+	return s.collectors
 }
 
 // InitializeMetricCollectors runs the registried MetricCollector Initializers to create an array of MetricCollectors.
 func (m *metricCollectorRegistry) InitializeMetricCollectors(name string) []MetricCollector {
+	return m.Refresh(name, CollectorSet{}).Collectors()
+}
+
+// Current reports whether set reflects the initializers registered now.
+func (m *metricCollectorRegistry) Current(set CollectorSet) bool {
+	return set.collectors != nil && atomic.LoadUint64(&m.generation) == set.generation
+}
+
+// Refresh brings set, which holds the collectors of the command name, up to date with the
+// initializers registered now. Collectors whose initializer is still registered are kept, so they
+// don't lose what they recorded; those of deregistered initializers are dropped, and initializers
+// registered since set was created run to add theirs.
+func (m *metricCollectorRegistry) Refresh(name string, set CollectorSet) CollectorSet {
 	m.lock.RLock()
 	defer m.lock.RUnlock()
 
-	metrics := make([]MetricCollector, len(m.registry))
-	for i, metricCollectorInitializer := range m.registry {
-		metrics[i] = metricCollectorInitializer(name)
+	existing := make(map[CollectorID]MetricCollector, len(set.ids))
+	for i, id := range set.ids {
+		existing[id] = set.collectors[i]
+	}
+
+	refreshed := CollectorSet{
+		generation: atomic.LoadUint64(&m.generation),
+		ids:        make([]CollectorID, len(m.registry)),
+		collectors: make([]MetricCollector, len(m.registry)),
 	}
-	return metrics
+	for i, r := range m.registry {
+		collector, ok := existing[r.id]
+		if !ok {
+			collector = r.initializer(name)
+		}
+		refreshed.ids[i] = r.id
+		refreshed.collectors[i] = collector
+	}
+	return refreshed
 }
 
 // Register places a MetricCollector Initializer in the registry maintained by this metricCollectorRegistry.
-func (m *metricCollectorRegistry) Register(initMetricCollector func(string) MetricCollector) {
+// Circuits which already exist create their collector with it before recording their next execution.
+// The returned ID removes it again with Deregister.
+func (m *metricCollectorRegistry) Register(initMetricCollector func(string) MetricCollector) CollectorID {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.lastID++
+	m.registry = append(m.registry, registeredCollector{id: m.lastID, initializer: initMetricCollector})
+	atomic.AddUint64(&m.generation, 1)
+	return m.lastID
+}
+
+// Deregister removes the MetricCollector Initializer which Register returned id for. Every circuit
+// stops sending results to the collector it created before recording its next execution; an
+// execution already being recorded may still reach it, so collectors must tolerate an Update after
+// they were deregistered. Deregistering an unknown id does nothing.
+func (m *metricCollectorRegistry) Deregister(id CollectorID) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i, r := range m.registry {
+		if r.id == id && id != 0 {
+			m.registry = append(m.registry[:i:i], m.registry[i+1:]...)
+			atomic.AddUint64(&m.generation, 1)
+			return
+		}
+	}
+}
+
+// Clear deregisters every MetricCollector Initializer placed with Register. The default collector,
+// which circuits rely on to decide their health, is kept.
+func (m *metricCollectorRegistry) Clear() {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	m.registry = append(m.registry, initMetricCollector)
+	m.registry = m.registry[:1:1]
+	atomic.AddUint64(&m.generation, 1)
 }
 
 type MetricResult struct {
@@ -51,9 +136,35 @@ type MetricResult struct {
 	FallbackFailures        float64
 	ContextCanceled         float64
 	ContextDeadlineExceeded float64
+	Queued                  float64
 	TotalDuration           time.Duration
 	RunDuration             time.Duration
-	ConcurrencyInUse        float64
+	// FallbackDuration is how long the fallback took. It is only set when FallbackSuccesses or
+	// FallbackFailures is.
+	FallbackDuration time.Duration
+	ConcurrencyInUse float64
+	// Executed is false when the run function never ran, such as for short-circuits and rejections.
+	// RunDuration is only a real sample when it is true.
+	Executed bool
+	// Namespace is the MetricsNamespace configured for the command, or empty if it has none.
+	Namespace string
+	// NoFallback is set when the execution failed and returned its error to the caller because the
+	// command has no fallback.
+	NoFallback float64
+	// Retries is how many times the run function was retried before the execution finished.
+	Retries float64
+	// FallbackDegraded is set, along with FallbackSuccesses, when the fallback returned a degraded result.
+	FallbackDegraded float64
+	// Blocked is set when BlockCommand turned the execution away. Attempts is 0 for such executions.
+	Blocked float64
+	// Tags are the tags passed to GoWithTags for this execution, or nil. Collectors may add them as
+	// dimensions of their metrics, and must not modify them.
+	Tags map[string]string
+	// QueueWaitDuration is how long the execution waited, from when it started, for a ticket from the
+	// executor pool. It is 0, and shouldn't be recorded, when the execution received no ticket.
+	QueueWaitDuration time.Duration
+	// FallbackRejects is set when the fallback didn't run because MaxConcurrentFallbacks were running.
+	FallbackRejects float64
 }
 
 // MetricCollector represents the contract that all collectors must fulfill to gather circuit statistics.
@@ -0,0 +1,118 @@
+package metricCollector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix/rolling"
+)
+
+// slidingWindowEvents are the events counted by a SlidingWindowCollector, with the field of
+// MetricResult each is read from.
+var slidingWindowEvents = map[string]func(MetricResult) float64{
+	"attempts":                  func(r MetricResult) float64 { return r.Attempts },
+	"errors":                    func(r MetricResult) float64 { return r.Errors },
+	"success":                   func(r MetricResult) float64 { return r.Successes },
+	"failure":                   func(r MetricResult) float64 { return r.Failures },
+	"rejected":                  func(r MetricResult) float64 { return r.Rejects },
+	"short-circuit":             func(r MetricResult) float64 { return r.ShortCircuits },
+	"timeout":                   func(r MetricResult) float64 { return r.Timeouts },
+	"fallback-success":          func(r MetricResult) float64 { return r.FallbackSuccesses },
+	"fallback-failure":          func(r MetricResult) float64 { return r.FallbackFailures },
+	"context_canceled":          func(r MetricResult) float64 { return r.ContextCanceled },
+	"context_deadline_exceeded": func(r MetricResult) float64 { return r.ContextDeadlineExceeded },
+	"queued":                    func(r MetricResult) float64 { return r.Queued },
+	"no-fallback":               func(r MetricResult) float64 { return r.NoFallback },
+	"retry":                     func(r MetricResult) float64 { return r.Retries },
+	"fallback-degraded":         func(r MetricResult) float64 { return r.FallbackDegraded },
+	"blocked":                   func(r MetricResult) float64 { return r.Blocked },
+	"fallback-rejection":        func(r MetricResult) float64 { return r.FallbackRejects },
+}
+
+// SlidingWindow keeps the counts of every command for longer than the default collector, so that
+// questions like "how many failures in the last 5 minutes" can be answered in process. Register
+// its NewCollector with Registry.Register before circuits are created.
+type SlidingWindow struct {
+	retention  time.Duration
+	resolution time.Duration
+
+	mutex      sync.RWMutex
+	collectors map[string]*SlidingWindowCollector
+}
+
+// NewSlidingWindow returns a SlidingWindow which keeps counts for retention, in buckets of resolution.
+// retention must be a positive multiple of resolution.
+func NewSlidingWindow(retention, resolution time.Duration) *SlidingWindow {
+	return &SlidingWindow{
+		retention:  retention,
+		resolution: resolution,
+		collectors: make(map[string]*SlidingWindowCollector),
+	}
+}
+
+// NewCollector creates the collector of the named command.
+func (s *SlidingWindow) NewCollector(name string) MetricCollector {
+	c := &SlidingWindowCollector{
+		buckets: int(s.retention / s.resolution),
+		window:  s.retention,
+	}
+	c.Reset()
+
+	s.mutex.Lock()
+	s.collectors[name] = c
+	s.mutex.Unlock()
+	return c
+}
+
+// Collector returns the collector of the named command, or nil if the command has not been created yet.
+func (s *SlidingWindow) Collector(name string) *SlidingWindowCollector {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.collectors[name]
+}
+
+// SlidingWindowCollector counts the events of a single command over the retention of its SlidingWindow.
+type SlidingWindowCollector struct {
+	window  time.Duration
+	buckets int
+
+	mutex  sync.RWMutex
+	counts map[string]*rolling.Number
+}
+
+// CountSince returns how many times event was recorded over the last d, to the resolution of the
+// SlidingWindow. event is one of "attempts", "errors", "success", "failure", "rejected", "short-circuit",
+// "timeout", "fallback-success", "fallback-failure", "context_canceled", "context_deadline_exceeded",
+// "queued", "no-fallback", "retry", "fallback-degraded", "blocked" or "fallback-rejection". Other events
+// are never counted.
+func (c *SlidingWindowCollector) CountSince(event string, d time.Duration) int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	count, ok := c.counts[event]
+	if !ok {
+		return 0
+	}
+	return int(count.SumSince(time.Now(), d))
+}
+
+// Update counts the events of a command execution.
+func (c *SlidingWindowCollector) Update(r MetricResult) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for event, value := range slidingWindowEvents {
+		c.counts[event].Increment(value(r))
+	}
+}
+
+// Reset clears all counts.
+func (c *SlidingWindowCollector) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.counts = make(map[string]*rolling.Number, len(slidingWindowEvents))
+	for event := range slidingWindowEvents {
+		c.counts[event] = rolling.NewNumberWithWindow(c.window, c.buckets)
+	}
+}
@@ -0,0 +1,41 @@
+package metricCollector
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	Convey("given a sliding window kept for 1 second in 10 millisecond buckets", t, func() {
+		window := NewSlidingWindow(time.Second, 10*time.Millisecond)
+		collector := window.NewCollector("sliding")
+
+		So(window.Collector("sliding"), ShouldEqual, collector)
+		So(window.Collector("unknown"), ShouldBeNil)
+
+		Convey("after a failure and, later, a success", func() {
+			collector.Update(MetricResult{Attempts: 1, Errors: 1, Failures: 1})
+			time.Sleep(60 * time.Millisecond)
+			collector.Update(MetricResult{Attempts: 1, Successes: 1})
+
+			c := window.Collector("sliding")
+			Convey("each event is counted over the duration asked for", func() {
+				So(c.CountSince("attempts", 500*time.Millisecond), ShouldEqual, 2)
+				So(c.CountSince("failure", 500*time.Millisecond), ShouldEqual, 1)
+				So(c.CountSince("failure", 30*time.Millisecond), ShouldEqual, 0)
+				So(c.CountSince("success", 30*time.Millisecond), ShouldEqual, 1)
+			})
+
+			Convey("unknown events are never counted", func() {
+				So(c.CountSince("panic", time.Second), ShouldEqual, 0)
+			})
+
+			Convey("a reset clears the counts", func() {
+				c.Reset()
+				So(c.CountSince("attempts", time.Second), ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -2,6 +2,7 @@ package hystrix
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/afex/hystrix-go/hystrix/metric_collector"
@@ -12,15 +13,77 @@ type commandExecution struct {
 	Types            []string      `json:"types"`
 	Start            time.Time     `json:"start_time"`
 	RunDuration      time.Duration `json:"run_duration"`
+	FallbackDuration time.Duration `json:"fallback_duration"`
 	ConcurrencyInUse float64       `json:"concurrency_inuse"`
+	// Tags are the tags the execution was started with, if any.
+	Tags map[string]string `json:"tags,omitempty"`
+	// QueueWaitDuration is how long the execution waited for a ticket, or 0 if it received none.
+	QueueWaitDuration time.Duration `json:"queue_wait_duration"`
 }
 
 type metricExchange struct {
 	Name    string
 	Updates chan *commandExecution
 	Mutex   *sync.RWMutex
+	flushes chan chan struct{}
+	done    chan struct{}
+	stop    sync.Once
 
+	// registered are the collectors created by metricCollector.Registry, and metricCollectors
+	// the list of them. They are guarded by Mutex, as registering or deregistering an initializer
+	// replaces them; defaultCollector, the first of them, never changes.
+	registered       metricCollector.CollectorSet
 	metricCollectors []metricCollector.MetricCollector
+	defaultCollector *metricCollector.DefaultMetricCollector
+	// commandCollectors were configured for this command with ConfigureCommandCollectors. They are
+	// guarded by Mutex, as they may be replaced while the circuit is in use.
+	commandCollectors []metricCollector.MetricCollector
+
+	// consecutiveFailures counts the failures and timeouts since the last success.
+	consecutiveFailures int64
+	// successDuration holds the run durations of successful executions only, for adaptiveTimeout. It
+	// is guarded by Mutex, as Reset replaces it.
+	successDuration *rolling.Timing
+}
+
+var (
+	commandCollectorsMutex sync.RWMutex
+	commandCollectors      = map[string][]metricCollector.MetricCollector{}
+)
+
+// ConfigureCommandCollectors sets collectors which receive the metrics of the named command only,
+// in addition to those created by metricCollector.Registry for every command. It replaces any
+// collectors previously configured for the command, and applies to its circuit straight away if
+// it already exists. Calling it with no collectors removes them.
+func ConfigureCommandCollectors(name string, collectors ...metricCollector.MetricCollector) {
+	name = resolveAlias(name)
+	commandCollectorsMutex.Lock()
+	commandCollectors[name] = collectors
+	commandCollectorsMutex.Unlock()
+
+	circuitBreakersMutex.RLock()
+	cb, ok := circuitBreakers[name]
+	circuitBreakersMutex.RUnlock()
+	if ok {
+		cb.metrics.setCommandCollectors(collectors)
+	}
+}
+
+func (m *metricExchange) setCommandCollectors(collectors []metricCollector.MetricCollector) {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+
+	m.commandCollectors = collectors
+}
+
+// collectors returns every collector of the command. Mutex must be held.
+func (m *metricExchange) collectors() []metricCollector.MetricCollector {
+	if len(m.commandCollectors) == 0 {
+		return m.metricCollectors
+	}
+	all := make([]metricCollector.MetricCollector, 0, len(m.metricCollectors)+len(m.commandCollectors))
+	all = append(all, m.metricCollectors...)
+	return append(all, m.commandCollectors...)
 }
 
 func newMetricExchange(name string) *metricExchange {
@@ -28,17 +91,30 @@ func newMetricExchange(name string) *metricExchange {
 	m.Name = name
 
 	m.Updates = make(chan *commandExecution, 2000)
+	m.flushes = make(chan chan struct{})
+	m.done = make(chan struct{})
 	m.Mutex = &sync.RWMutex{}
-	m.metricCollectors = metricCollector.Registry.InitializeMetricCollectors(name)
+	m.registered = metricCollector.Registry.Refresh(name, metricCollector.CollectorSet{})
+	m.metricCollectors = m.registered.Collectors()
+	m.defaultCollector = m.findDefaultCollector()
+	commandCollectorsMutex.RLock()
+	m.commandCollectors = commandCollectors[name]
+	commandCollectorsMutex.RUnlock()
 	m.Reset()
+	m.configureWindow(getSettings(name))
 
 	go m.Monitor()
 
 	return m
 }
 
-// The Default Collector function will panic if collectors are not setup to specification.
+// DefaultCollector returns the collector the health of the circuit is decided from.
 func (m *metricExchange) DefaultCollector() *metricCollector.DefaultMetricCollector {
+	return m.defaultCollector
+}
+
+// The findDefaultCollector function will panic if collectors are not setup to specification.
+func (m *metricExchange) findDefaultCollector() *metricCollector.DefaultMetricCollector {
 	if len(m.metricCollectors) < 1 {
 		panic("No Metric Collectors Registered.")
 	}
@@ -50,29 +126,100 @@ func (m *metricExchange) DefaultCollector() *metricCollector.DefaultMetricCollec
 }
 
 func (m *metricExchange) Monitor() {
-	for update := range m.Updates {
-		// we only grab a read lock to make sure Reset() isn't changing the numbers.
-		m.Mutex.RLock()
-
-		totalDuration := time.Since(update.Start)
-		wg := &sync.WaitGroup{}
-		for _, collector := range m.metricCollectors {
-			wg.Add(1)
-			go m.IncrementMetrics(wg, collector, update, totalDuration)
+	for {
+		select {
+		case update := <-m.Updates:
+			m.record(update)
+		case flushed := <-m.flushes:
+			m.drain()
+			close(flushed)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// refreshCollectors picks up initializers registered or deregistered since the collectors of the
+// circuit were created.
+func (m *metricExchange) refreshCollectors() {
+	m.Mutex.RLock()
+	current := metricCollector.Registry.Current(m.registered)
+	m.Mutex.RUnlock()
+	if current {
+		return
+	}
+
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	m.registered = metricCollector.Registry.Refresh(m.Name, m.registered)
+	m.metricCollectors = m.registered.Collectors()
+}
+
+func (m *metricExchange) record(update *commandExecution) {
+	m.refreshCollectors()
+
+	// we only grab a read lock to make sure Reset() isn't changing the numbers.
+	m.Mutex.RLock()
+	defer m.Mutex.RUnlock()
+
+	switch update.Types[0] {
+	case "success", "non-failure-error":
+		atomic.StoreInt64(&m.consecutiveFailures, 0)
+	case "failure", "timeout":
+		atomic.AddInt64(&m.consecutiveFailures, 1)
+	}
+	if update.Types[0] == "success" && update.RunDuration > 0 {
+		m.successDuration.Add(update.RunDuration)
+	}
+
+	totalDuration := getClock().Now().Sub(update.Start)
+	wg := &sync.WaitGroup{}
+	for _, collector := range m.collectors() {
+		wg.Add(1)
+		go m.IncrementMetrics(wg, collector, update, totalDuration)
+	}
+	wg.Wait()
+}
+
+// drain records every update which is already waiting in the channel.
+func (m *metricExchange) drain() {
+	for {
+		select {
+		case update := <-m.Updates:
+			m.record(update)
+		default:
+			return
 		}
-		wg.Wait()
+	}
+}
 
-		m.Mutex.RUnlock()
+// flush blocks until every update sent before the call has been recorded.
+func (m *metricExchange) flush() {
+	flushed := make(chan struct{})
+	select {
+	case m.flushes <- flushed:
+		<-flushed
+	case <-m.done:
 	}
 }
 
+// Stop ends the Monitor goroutine. Updates sent afterwards are no longer recorded.
+func (m *metricExchange) Stop() {
+	m.stop.Do(func() { close(m.done) })
+}
+
 func (m *metricExchange) IncrementMetrics(wg *sync.WaitGroup, collector metricCollector.MetricCollector, update *commandExecution, totalDuration time.Duration) {
 	// granular metrics
 	r := metricCollector.MetricResult{
-		Attempts:         1,
-		TotalDuration:    totalDuration,
-		RunDuration:      update.RunDuration,
-		ConcurrencyInUse: update.ConcurrencyInUse,
+		Attempts:          1,
+		TotalDuration:     totalDuration,
+		RunDuration:       update.RunDuration,
+		FallbackDuration:  update.FallbackDuration,
+		QueueWaitDuration: update.QueueWaitDuration,
+		ConcurrencyInUse:  update.ConcurrencyInUse,
+		Executed:          executed(update),
+		Namespace:         getSettings(m.Name).MetricsNamespace,
+		Tags:              update.Tags,
 	}
 
 	switch update.Types[0] {
@@ -90,19 +237,35 @@ func (m *metricExchange) IncrementMetrics(wg *sync.WaitGroup, collector metricCo
 	case "timeout":
 		r.Timeouts = 1
 		r.Errors = 1
+	case "non-failure-error":
+		// counted as an attempt, but not against the health of the circuit
 	case "context_canceled":
 		r.ContextCanceled = 1
 	case "context_deadline_exceeded":
 		r.ContextDeadlineExceeded = 1
+	case "blocked":
+		// turned away on purpose, so not an attempt which the health of the circuit could be judged on
+		r.Attempts = 0
+		r.Blocked = 1
 	}
 
-	if len(update.Types) > 1 {
-		// fallback metrics
-		if update.Types[1] == "fallback-success" {
+	// the events which follow the outcome may come in any order
+	for _, t := range update.Types[1:] {
+		switch t {
+		case "fallback-success":
 			r.FallbackSuccesses = 1
-		}
-		if update.Types[1] == "fallback-failure" {
+		case "fallback-failure":
 			r.FallbackFailures = 1
+		case "queued":
+			r.Queued = 1
+		case "no-fallback":
+			r.NoFallback = 1
+		case "fallback-degraded":
+			r.FallbackDegraded = 1
+		case "fallback-rejection":
+			r.FallbackRejects = 1
+		case "retry":
+			r.Retries++
 		}
 	}
 
@@ -111,13 +274,58 @@ func (m *metricExchange) IncrementMetrics(wg *sync.WaitGroup, collector metricCo
 	wg.Done()
 }
 
+// executed reports whether the run function of a command ran, so that commands which were turned away
+// or gave up before run returned don't add zero samples to the run duration. An error returned by run
+// may be recorded as any event, so a measured run duration always counts.
+func executed(update *commandExecution) bool {
+	for _, t := range update.Types[1:] {
+		if t == "forced-fallback" {
+			return false
+		}
+	}
+	if update.RunDuration > 0 {
+		return true
+	}
+
+	switch update.Types[0] {
+	case "short-circuit", "rejected", "timeout", "context_canceled", "context_deadline_exceeded", "blocked":
+		return false
+	}
+	return true
+}
+
+// configureWindow applies the rolling window in settings to the default collector, if it has changed.
+func (m *metricExchange) configureWindow(settings *Settings) {
+	collector := m.DefaultCollector()
+	if collector.Window() == settings.RollingWindow && collector.Buckets() == settings.RollingBuckets {
+		return
+	}
+
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	collector.ConfigureWindow(settings.RollingWindow, settings.RollingBuckets)
+	m.successDuration = m.newSuccessDuration()
+}
+
+// newSuccessDuration returns an empty timing over the same window as the run durations of the default
+// collector.
+func (m *metricExchange) newSuccessDuration() *rolling.Timing {
+	collector := m.DefaultCollector()
+	if collector.Window() <= rolling.DefaultTimingWindow {
+		return rolling.NewTiming()
+	}
+	return rolling.NewTimingWithWindow(collector.Window(), collector.Buckets())
+}
+
 func (m *metricExchange) Reset() {
 	m.Mutex.Lock()
 	defer m.Mutex.Unlock()
 
-	for _, collector := range m.metricCollectors {
+	for _, collector := range m.collectors() {
 		collector.Reset()
 	}
+	atomic.StoreInt64(&m.consecutiveFailures, 0)
+	m.successDuration = m.newSuccessDuration()
 }
 
 func (m *metricExchange) Requests() *rolling.Number {
@@ -145,6 +353,274 @@ func (m *metricExchange) ErrorPercent(now time.Time) int {
 	return int(errPct + 0.5)
 }
 
+// latencyPercentiles are the percentiles of run duration reported by LatencyPercentiles, keyed as on the dashboard.
+var latencyPercentiles = map[string]float64{
+	"0":   0,
+	"25":  25,
+	"50":  50,
+	"90":  90,
+	"99":  99,
+	"100": 100,
+}
+
+// Latency returns the p-th percentile of the run duration of the named command over its rolling window.
+// ErrUnknownCircuit is returned if the command has not been executed yet.
+func Latency(name string, p float64) (time.Duration, error) {
+	cb, err := lookupCircuit(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return cb.metrics.runDuration().PercentileDuration(p), nil
+}
+
+// LatencyPercentiles returns the 0th, 25th, 50th, 90th, 99th and 100th percentiles of the run duration
+// of the named command, keyed by percentile. It returns nil if the command has not been executed yet.
+func LatencyPercentiles(name string) map[string]time.Duration {
+	cb, err := lookupCircuit(name)
+	if err != nil {
+		return nil
+	}
+
+	timing := cb.metrics.runDuration()
+	percentiles := make(map[string]time.Duration, len(latencyPercentiles))
+	for key, p := range latencyPercentiles {
+		percentiles[key] = timing.PercentileDuration(p)
+	}
+	return percentiles
+}
+
+// A Snapshot holds the rolling counts of a command at the moment it was taken.
+type Snapshot struct {
+	Attempts          int
+	Errors            int
+	Successes         int
+	Failures          int
+	Rejects           int
+	ShortCircuits     int
+	Timeouts          int
+	FallbackSuccesses int
+	FallbackFailures  int
+	// NoFallback counts the executions which returned an error to the caller because the command
+	// has no fallback.
+	NoFallback int
+	// Retries counts the times run functions were retried, which are not executions of their own.
+	Retries int
+	// FallbackDegraded counts the fallback successes which returned ErrFallbackDegraded.
+	FallbackDegraded int
+	// Blocked counts the executions turned away by BlockCommand, which are not included in Attempts.
+	Blocked int
+	// FallbackRejects counts the fallbacks not run because MaxConcurrentFallbacks were already running.
+	FallbackRejects int
+
+	ErrorPercent int
+	Open         bool
+}
+
+// Sub returns the difference of each count between s and an earlier snapshot other, such as the
+// executions of a test or of a dashboard's polling interval. ErrorPercent and Open are not counts, so
+// they are those of s, and other still holds its own.
+//
+// The counts are over the rolling window, so the difference only covers every execution in between
+// while both snapshots were taken within one window. Executions which expired from the window in the
+// meantime make it smaller, possibly negative.
+func (s Snapshot) Sub(other Snapshot) Snapshot {
+	return Snapshot{
+		Attempts:          s.Attempts - other.Attempts,
+		Errors:            s.Errors - other.Errors,
+		Successes:         s.Successes - other.Successes,
+		Failures:          s.Failures - other.Failures,
+		Rejects:           s.Rejects - other.Rejects,
+		ShortCircuits:     s.ShortCircuits - other.ShortCircuits,
+		Timeouts:          s.Timeouts - other.Timeouts,
+		FallbackSuccesses: s.FallbackSuccesses - other.FallbackSuccesses,
+		FallbackFailures:  s.FallbackFailures - other.FallbackFailures,
+		NoFallback:        s.NoFallback - other.NoFallback,
+		Retries:           s.Retries - other.Retries,
+		FallbackDegraded:  s.FallbackDegraded - other.FallbackDegraded,
+		Blocked:           s.Blocked - other.Blocked,
+		FallbackRejects:   s.FallbackRejects - other.FallbackRejects,
+		ErrorPercent:      s.ErrorPercent,
+		Open:              s.Open,
+	}
+}
+
+// Metrics returns the rolling counts of the named command. Every execution which has returned from
+// Do, DoC or DoWithConfig before the call is included. ErrUnknownCircuit is returned if the command
+// has not been executed yet.
+func Metrics(name string) (Snapshot, error) {
+	cb, err := lookupCircuit(name)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	cb.metrics.flush()
+	snapshot := cb.metrics.snapshot(time.Now())
+	snapshot.Open = cb.IsOpen()
+	return snapshot, nil
+}
+
+// ErrorPercentage returns the percentage of the named command's requests over the rolling window which
+// were errors, as compared with ErrorPercentThreshold to decide the health of its circuit, or 0 if there
+// were none. Unlike Metrics, it reads the current numbers without waiting for pending executions to
+// be recorded, so it is cheap enough to poll. ErrUnknownCircuit is returned if the command has not
+// been executed yet.
+func ErrorPercentage(name string) (int, error) {
+	cb, err := lookupCircuit(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return cb.metrics.ErrorPercent(time.Now()), nil
+}
+
+// GroupMetrics returns the rolling counts of every command in group added up, as Metrics returns them
+// for a single command. ErrorPercent is that of all their requests together, and Open is true when
+// any of their circuits is open. Commands which have not been executed yet are left out.
+func GroupMetrics(group string) Snapshot {
+	return sumMetrics(func(name string) bool {
+		return getSettings(name).group(name) == group
+	})
+}
+
+// AggregateMetrics returns the rolling counts of every command in the process added up, in the same
+// way as GroupMetrics, for an overall view of the health of everything the process depends on.
+func AggregateMetrics() Snapshot {
+	return sumMetrics(nil)
+}
+
+// sumMetrics adds up the snapshots of the circuits whose name is included, or of every circuit if
+// include is nil.
+func sumMetrics(include func(name string) bool) Snapshot {
+	var total Snapshot
+	now := time.Now()
+	for _, cb := range circuitsWhere(include) {
+		cb.metrics.flush()
+		total = total.add(cb.metrics.snapshot(now))
+		total.Open = total.Open || cb.IsOpen()
+	}
+	if total.Attempts > 0 {
+		total.ErrorPercent = int(float64(total.Errors)/float64(total.Attempts)*100 + 0.5)
+	}
+	return total
+}
+
+// add returns the sum of each count of s and other. ErrorPercent and Open are those of s.
+func (s Snapshot) add(other Snapshot) Snapshot {
+	return Snapshot{
+		Attempts:          s.Attempts + other.Attempts,
+		Errors:            s.Errors + other.Errors,
+		Successes:         s.Successes + other.Successes,
+		Failures:          s.Failures + other.Failures,
+		Rejects:           s.Rejects + other.Rejects,
+		ShortCircuits:     s.ShortCircuits + other.ShortCircuits,
+		Timeouts:          s.Timeouts + other.Timeouts,
+		FallbackSuccesses: s.FallbackSuccesses + other.FallbackSuccesses,
+		FallbackFailures:  s.FallbackFailures + other.FallbackFailures,
+		NoFallback:        s.NoFallback + other.NoFallback,
+		Retries:           s.Retries + other.Retries,
+		FallbackDegraded:  s.FallbackDegraded + other.FallbackDegraded,
+		Blocked:           s.Blocked + other.Blocked,
+		FallbackRejects:   s.FallbackRejects + other.FallbackRejects,
+		ErrorPercent:      s.ErrorPercent,
+		Open:              s.Open,
+	}
+}
+
+func (m *metricExchange) snapshot(now time.Time) Snapshot {
+	m.Mutex.RLock()
+	defer m.Mutex.RUnlock()
+
+	collector := m.DefaultCollector()
+	count := func(n *rolling.Number) int {
+		return int(n.Sum(now))
+	}
+
+	var errPct int
+	if attempts := collector.NumRequests().Sum(now); attempts > 0 {
+		errPct = int(collector.Errors().Sum(now)/attempts*100 + 0.5)
+	}
+
+	return Snapshot{
+		Attempts:          count(collector.NumRequests()),
+		Errors:            count(collector.Errors()),
+		Successes:         count(collector.Successes()),
+		Failures:          count(collector.Failures()),
+		Rejects:           count(collector.Rejects()),
+		ShortCircuits:     count(collector.ShortCircuits()),
+		Timeouts:          count(collector.Timeouts()),
+		FallbackSuccesses: count(collector.FallbackSuccesses()),
+		FallbackFailures:  count(collector.FallbackFailures()),
+		NoFallback:        count(collector.NoFallback()),
+		Retries:           count(collector.Retries()),
+		FallbackDegraded:  count(collector.FallbackDegraded()),
+		Blocked:           count(collector.Blocked()),
+		FallbackRejects:   count(collector.FallbackRejects()),
+		ErrorPercent:      errPct,
+	}
+}
+
+func (m *metricExchange) runDuration() *rolling.Timing {
+	m.Mutex.RLock()
+	defer m.Mutex.RUnlock()
+	return m.DefaultCollector().RunDuration()
+}
+
+// successDurations returns the run durations of successful executions.
+func (m *metricExchange) successDurations() *rolling.Timing {
+	m.Mutex.RLock()
+	defer m.Mutex.RUnlock()
+	return m.successDuration
+}
+
 func (m *metricExchange) IsHealthy(now time.Time) bool {
-	return m.ErrorPercent(now) < getSettings(m.Name).ErrorPercentThreshold
+	return m.isHealthy(now, getSettings(m.Name))
+}
+
+func (m *metricExchange) isHealthy(now time.Time, settings *Settings) bool {
+	return m.ErrorPercent(now) < settings.ErrorPercentThreshold && !m.tooManyConsecutiveFailures(settings) && !m.tooSlow(settings)
+}
+
+// latency returns the LatencyPercentile percentile of recent run durations.
+func (m *metricExchange) latency(settings *Settings) time.Duration {
+	return m.runDuration().PercentileDuration(settings.LatencyPercentile)
+}
+
+// adaptiveTimeout returns the timeout of an execution under settings with AdaptiveTimeout: the
+// AdaptiveTimeoutPercentile percentile of the run durations of recent successes plus the margin,
+// between MinTimeout and Timeout. It is Timeout until a success has been timed.
+//
+// Only successes are timed, as a failure may return quickly or hang, and a run cut short by the
+// timeout has no duration to record. The samples are therefore censored at the timeout in force: they
+// show how long the runs which beat it took, not how long the slower ones would have, so the
+// percentile can lag behind a backend which slows down past the timeout.
+func (m *metricExchange) adaptiveTimeout(settings *Settings) time.Duration {
+	latency := m.successDurations().PercentileDuration(settings.AdaptiveTimeoutPercentile)
+	if latency == 0 {
+		return settings.Timeout
+	}
+
+	timeout := latency + settings.AdaptiveTimeoutMargin
+	if timeout < settings.MinTimeout {
+		timeout = settings.MinTimeout
+	}
+	if settings.Timeout > 0 && timeout > settings.Timeout {
+		timeout = settings.Timeout
+	}
+	return timeout
+}
+
+// tooSlow reports whether the LatencyThreshold of settings, if any, has been reached.
+func (m *metricExchange) tooSlow(settings *Settings) bool {
+	return settings.LatencyThreshold > 0 && m.latency(settings) >= settings.LatencyThreshold
+}
+
+// ConsecutiveFailures returns the number of failures and timeouts recorded since the last success.
+func (m *metricExchange) ConsecutiveFailures() int {
+	return int(atomic.LoadInt64(&m.consecutiveFailures))
+}
+
+// tooManyConsecutiveFailures reports whether the ConsecutiveFailureThreshold of settings, if any, has been reached.
+func (m *metricExchange) tooManyConsecutiveFailures(settings *Settings) bool {
+	return settings.ConsecutiveFailureThreshold > 0 && m.ConsecutiveFailures() >= settings.ConsecutiveFailureThreshold
 }
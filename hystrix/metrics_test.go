@@ -1,9 +1,13 @@
 package hystrix
 
 import (
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/afex/hystrix-go/hystrix/metric_collector"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -42,4 +46,375 @@ func TestErrorPercent(t *testing.T) {
 
 		})
 	})
+
+	Convey("with a command which failed once in 4 requests", t, func() {
+		defer Flush()
+
+		Do("error_percentage", func() error { return errors.New("boom") }, nil)
+		for i := 0; i < 3; i++ {
+			Do("error_percentage", func() error { return nil }, nil)
+		}
+		Metrics("error_percentage")
+
+		Convey("ErrorPercentage() should return 25", func() {
+			p, err := ErrorPercentage("error_percentage")
+			So(err, ShouldBeNil)
+			So(p, ShouldEqual, 25)
+		})
+
+		Convey("ErrorPercentage() should return 0 once its metrics are reset", func() {
+			So(ResetCircuit("error_percentage"), ShouldBeNil)
+			p, err := ErrorPercentage("error_percentage")
+			So(err, ShouldBeNil)
+			So(p, ShouldEqual, 0)
+		})
+
+		Convey("ErrorPercentage() should fail for a command which never ran", func() {
+			_, err := ErrorPercentage("error_percentage_unknown")
+			So(err, ShouldEqual, ErrUnknownCircuit)
+		})
+	})
+}
+
+func TestLatency(t *testing.T) {
+	Convey("with a command which has run for 10 to 100 milliseconds", t, func() {
+		defer Flush()
+
+		cb, _, _ := GetCircuit("latency")
+		for i := 1; i <= 10; i++ {
+			cb.metrics.Updates <- &commandExecution{
+				Types:       []string{"success"},
+				Start:       time.Now(),
+				RunDuration: time.Duration(i*10) * time.Millisecond,
+			}
+		}
+		cb.metrics.flush()
+
+		Convey("Latency() should return the requested percentile", func() {
+			p50, err := Latency("latency", 50)
+			So(err, ShouldBeNil)
+			So(p50, ShouldEqual, 50*time.Millisecond)
+
+			p100, _ := Latency("latency", 100)
+			So(p100, ShouldEqual, 100*time.Millisecond)
+		})
+
+		Convey("a burst of short-circuits should not move the percentiles", func() {
+			for i := 0; i < 50; i++ {
+				cb.metrics.Updates <- &commandExecution{
+					Types: []string{"short-circuit", "fallback-success"},
+					Start: time.Now(),
+				}
+			}
+			cb.metrics.flush()
+
+			p50, _ := Latency("latency", 50)
+			So(p50, ShouldEqual, 50*time.Millisecond)
+		})
+
+		Convey("LatencyPercentiles() should return the dashboard percentiles", func() {
+			percentiles := LatencyPercentiles("latency")
+			So(percentiles, ShouldHaveLength, 6)
+			So(percentiles["0"], ShouldEqual, 10*time.Millisecond)
+			So(percentiles["90"], ShouldEqual, 90*time.Millisecond)
+		})
+	})
+
+	Convey("with a command which has never run", t, func() {
+		defer Flush()
+
+		Convey("Latency() should return an error", func() {
+			_, err := Latency("latency-unknown", 50)
+			So(err, ShouldResemble, ErrUnknownCircuit)
+			So(LatencyPercentiles("latency-unknown"), ShouldBeNil)
+		})
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	Convey("with a command which has failed 3 times and succeeded once", t, func() {
+		defer Flush()
+
+		for i := 0; i < 3; i++ {
+			Do("metrics", func() error {
+				return errors.New("boom")
+			}, func(err error) error {
+				return nil
+			})
+		}
+		Do("metrics", func() error {
+			return nil
+		}, nil)
+
+		Convey("Metrics() should return the counts without waiting", func() {
+			snapshot, err := Metrics("metrics")
+			So(err, ShouldBeNil)
+			So(snapshot.Attempts, ShouldEqual, 4)
+			So(snapshot.Failures, ShouldEqual, 3)
+			So(snapshot.Errors, ShouldEqual, 3)
+			So(snapshot.Successes, ShouldEqual, 1)
+			So(snapshot.FallbackSuccesses, ShouldEqual, 3)
+			So(snapshot.NoFallback, ShouldEqual, 0)
+			So(snapshot.ErrorPercent, ShouldEqual, 75)
+			So(snapshot.Open, ShouldBeFalse)
+		})
+
+		Convey("Sub() should return the counts of the executions since an earlier snapshot", func() {
+			before, _ := Metrics("metrics")
+			Do("metrics", func() error {
+				return errors.New("boom")
+			}, nil)
+			after, _ := Metrics("metrics")
+
+			delta := after.Sub(before)
+			So(delta.Attempts, ShouldEqual, 1)
+			So(delta.Failures, ShouldEqual, 1)
+			So(delta.Successes, ShouldEqual, 0)
+			So(delta.NoFallback, ShouldEqual, 1)
+			So(delta.ErrorPercent, ShouldEqual, after.ErrorPercent)
+		})
+	})
+
+	Convey("with a command which has failed twice without a fallback", t, func() {
+		defer Flush()
+
+		for i := 0; i < 2; i++ {
+			Do("metrics-no-fallback", func() error {
+				return errors.New("boom")
+			}, nil)
+		}
+		ForceOpen("metrics-no-fallback")
+		Do("metrics-no-fallback", func() error {
+			return nil
+		}, nil)
+		ClearForced("metrics-no-fallback")
+
+		Convey("Metrics() should count every error which reached the caller uncovered", func() {
+			snapshot, err := Metrics("metrics-no-fallback")
+			So(err, ShouldBeNil)
+			So(snapshot.Failures, ShouldEqual, 2)
+			So(snapshot.ShortCircuits, ShouldEqual, 1)
+			So(snapshot.NoFallback, ShouldEqual, 3)
+		})
+	})
+
+	Convey("with a command which has never run", t, func() {
+		defer Flush()
+
+		Convey("Metrics() should return an error", func() {
+			_, err := Metrics("metrics-unknown")
+			So(err, ShouldResemble, ErrUnknownCircuit)
+		})
+	})
+}
+
+type countingCollector struct {
+	sync.Mutex
+	attempts float64
+	tags     []map[string]string
+}
+
+func (c *countingCollector) Update(r metricCollector.MetricResult) {
+	c.Lock()
+	defer c.Unlock()
+	c.attempts += r.Attempts
+	c.tags = append(c.tags, r.Tags)
+}
+
+func (c *countingCollector) Reset() {}
+
+func (c *countingCollector) Attempts() float64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.attempts
+}
+
+func TestCommandCollectors(t *testing.T) {
+	Convey("with a collector configured for one command", t, func() {
+		defer Flush()
+		defer ConfigureCommandCollectors("payments")
+
+		collector := &countingCollector{}
+		ConfigureCommandCollectors("payments", collector)
+
+		Do("payments", func() error { return nil }, nil)
+		Do("orders", func() error { return nil }, nil)
+		Metrics("payments")
+		Metrics("orders")
+
+		Convey("it receives the metrics of that command only", func() {
+			So(collector.Attempts(), ShouldEqual, 1)
+		})
+
+		Convey("the default collector still receives them", func() {
+			snapshot, _ := Metrics("payments")
+			So(snapshot.Attempts, ShouldEqual, 1)
+		})
+
+		Convey("replacing it on a running circuit takes effect straight away", func() {
+			replacement := &countingCollector{}
+			ConfigureCommandCollectors("payments", replacement)
+			Do("payments", func() error { return nil }, nil)
+			Metrics("payments")
+
+			So(collector.Attempts(), ShouldEqual, 1)
+			So(replacement.Attempts(), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestGroupMetrics(t *testing.T) {
+	Convey("with two commands of a group and one outside it", t, func() {
+		defer Flush()
+		ConfigureCommand("users_get", CommandConfig{Group: "users"})
+		ConfigureCommand("users_list", CommandConfig{Group: "users"})
+
+		Do("users_get", func() error { return nil }, nil)
+		Do("users_get", func() error { return errors.New("boom") }, nil)
+		Do("users_list", func() error { return nil }, nil)
+		Do("users_list", func() error { return nil }, nil)
+		Do("orders_get", func() error { return errors.New("boom") }, nil)
+
+		Convey("GroupMetrics() adds up the counts of the group", func() {
+			snapshot := GroupMetrics("users")
+			So(snapshot.Attempts, ShouldEqual, 4)
+			So(snapshot.Successes, ShouldEqual, 3)
+			So(snapshot.Failures, ShouldEqual, 1)
+			So(snapshot.ErrorPercent, ShouldEqual, 25)
+			So(snapshot.Open, ShouldBeFalse)
+		})
+
+		Convey("a command without a group is a group of its own", func() {
+			snapshot := GroupMetrics("orders_get")
+			So(snapshot.Attempts, ShouldEqual, 1)
+			So(snapshot.ErrorPercent, ShouldEqual, 100)
+		})
+
+		Convey("an unknown group has no counts", func() {
+			So(GroupMetrics("unknown"), ShouldResemble, Snapshot{})
+		})
+	})
+}
+
+func TestAggregateMetrics(t *testing.T) {
+	Convey("with commands in different groups", t, func() {
+		defer Flush()
+		ConfigureCommand("aggregate_users", CommandConfig{Group: "aggregate"})
+
+		Do("aggregate_users", func() error { return nil }, nil)
+		Do("aggregate_users", func() error { return nil }, nil)
+		Do("aggregate_orders", func() error { return errors.New("boom") }, nil)
+		Do("aggregate_orders", func() error { return nil }, nil)
+
+		Convey("AggregateMetrics() adds up the counts of every command", func() {
+			snapshot := AggregateMetrics()
+			So(snapshot.Attempts, ShouldEqual, 4)
+			So(snapshot.Successes, ShouldEqual, 3)
+			So(snapshot.Failures, ShouldEqual, 1)
+			So(snapshot.ErrorPercent, ShouldEqual, 25)
+			So(snapshot.Open, ShouldBeFalse)
+		})
+
+		Convey("an open circuit marks the aggregate open", func() {
+			cb, _, _ := GetCircuit("aggregate_orders")
+			cb.toggleForceOpen(true)
+			So(AggregateMetrics().Open, ShouldBeTrue)
+		})
+	})
+
+	Convey("without any commands the aggregate has no counts", t, func() {
+		Flush()
+		So(AggregateMetrics(), ShouldResemble, Snapshot{})
+	})
+}
+
+func TestRegistryChanges(t *testing.T) {
+	Convey("with a circuit which already exists", t, func() {
+		defer Flush()
+		Do("registry", func() error { return nil }, nil)
+		Metrics("registry")
+
+		collector := &countingCollector{}
+		id := metricCollector.Registry.Register(func(name string) metricCollector.MetricCollector {
+			return collector
+		})
+		defer metricCollector.Registry.Deregister(id)
+
+		Convey("a collector registered afterwards receives its next executions", func() {
+			Do("registry", func() error { return nil }, nil)
+			Metrics("registry")
+			So(collector.Attempts(), ShouldEqual, 1)
+
+			Convey("and none once it is deregistered", func() {
+				metricCollector.Registry.Deregister(id)
+				Do("registry", func() error { return nil }, nil)
+				Metrics("registry")
+				So(collector.Attempts(), ShouldEqual, 1)
+			})
+
+			Convey("or once the registry is cleared, without losing the default collector", func() {
+				metricCollector.Registry.Clear()
+				Do("registry", func() error { return nil }, nil)
+				snapshot, _ := Metrics("registry")
+				So(collector.Attempts(), ShouldEqual, 1)
+				So(snapshot.Attempts, ShouldEqual, 3)
+			})
+		})
+	})
+}
+
+func TestGoWithTags(t *testing.T) {
+	Convey("with a command proxying to several hosts", t, func() {
+		defer Flush()
+		defer ConfigureCommandCollectors("proxy")
+
+		collector := &countingCollector{}
+		ConfigureCommandCollectors("proxy", collector)
+
+		tags := map[string]string{"host": "db-1"}
+		err := <-GoWithTags("proxy", tags, func() error { return fmt.Errorf("boom") }, nil)
+		So(err.Error(), ShouldEqual, "boom")
+		tags["host"] = "changed"
+		Do("proxy", func() error { return nil }, nil)
+		time.Sleep(20 * time.Millisecond)
+		Metrics("proxy")
+
+		Convey("the collectors receive the tags of each execution", func() {
+			collector.Lock()
+			defer collector.Unlock()
+			So(collector.tags, ShouldHaveLength, 2)
+			So(collector.tags, ShouldContain, map[string]string{"host": "db-1"})
+			So(collector.tags, ShouldContain, map[string]string(nil))
+		})
+
+		Convey("the executions share one circuit", func() {
+			So(CircuitNames(), ShouldResemble, []string{"proxy"})
+			snapshot, _ := Metrics("proxy")
+			So(snapshot.Attempts, ShouldEqual, 2)
+		})
+	})
+}
+
+func TestFallbackLatency(t *testing.T) {
+	Convey("with a command whose fallback takes 20 milliseconds", t, func() {
+		defer Flush()
+
+		Do("fallback-latency", func() error { return fmt.Errorf("boom") }, func(err error) error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+		Do("fallback-latency", func() error { return nil }, func(err error) error { return nil })
+		Metrics("fallback-latency")
+		cb, _, _ := GetCircuit("fallback-latency")
+
+		Convey("only the fallback which ran is timed", func() {
+			durations := cb.metrics.DefaultCollector().FallbackDuration().SortedDurations()
+			So(durations, ShouldHaveLength, 1)
+			So(durations[0], ShouldBeGreaterThanOrEqualTo, 20*time.Millisecond)
+		})
+
+		Convey("it is not added to the run duration", func() {
+			So(cb.metrics.runDuration().PercentileDuration(100), ShouldBeLessThan, 20*time.Millisecond)
+		})
+	})
 }
@@ -1,37 +1,310 @@
 package hystrix
 
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
 type executorPool struct {
 	Name    string
 	Metrics *poolMetrics
 	Max     int
-	Tickets chan *struct{}
+	Tickets chan *poolTicket
+
+	mutex *sync.RWMutex
+	// excess counts tickets held by running commands beyond Max after the pool shrank.
+	// They are discarded as they are returned instead of going back into Tickets.
+	excess int
+	// waiting counts commands queued for a ticket. available is closed, and replaced, when a
+	// ticket may have become available while any are waiting.
+	waiting   int
+	available chan struct{}
+	// held counts the tickets taken from the pool and not yet returned. It is updated atomically,
+	// as tickets are taken under the read lock.
+	held int64
+	// shared is set on the pool of a PoolName, which keeps its size when one of its commands is
+	// reconfigured, since it isn't theirs alone.
+	shared bool
+}
+
+// A poolTicket lets one execution run. held is 1 while it is out of the pool, so that a ticket
+// returned twice can be detected instead of being handed out twice.
+type poolTicket struct {
+	held int32
+}
+
+// take marks a ticket just received from p.Tickets as held.
+func (p *executorPool) take(ticket *poolTicket) *poolTicket {
+	atomic.StoreInt32(&ticket.held, 1)
+	atomic.AddInt64(&p.held, 1)
+	return ticket
+}
+
+// ActiveCount returns the number of executions of the named command which currently hold a ticket.
+// It does not block on or change the executor pool.
+func ActiveCount(name string) (int, error) {
+	circuit, _, err := GetCircuit(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return circuit.executorPool.ActiveCount(), nil
+}
+
+// MaxConcurrency returns the number of executions of the named command which may run at the same time.
+func MaxConcurrency(name string) (int, error) {
+	circuit, _, err := GetCircuit(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return circuit.executorPool.size(), nil
+}
+
+// PoolUtilization returns the share of the named command's executor pool which is in use, from 0 to 1,
+// so callers can back off before being rejected. It may exceed 1 while a pool which shrank drains.
+// ErrUnknownCircuit is returned if the command has not been executed yet.
+func PoolUtilization(name string) (float64, error) {
+	circuit, err := lookupCircuit(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return circuit.executorPool.utilization(), nil
+}
+
+// MaxActiveRequests returns the most executions of the named command which held a ticket at the
+// same time over the rolling window. Compare it with MaxConcurrency to size the pool.
+// ErrUnknownCircuit is returned if the command has not been executed yet.
+func MaxActiveRequests(name string) (int, error) {
+	circuit, err := lookupCircuit(name)
+	if err != nil {
+		return 0, err
+	}
+
+	circuit.executorPool.Metrics.flush()
+	return circuit.executorPool.Metrics.maxActiveRequests(time.Now()), nil
+}
+
+// PoolIntegrityCheck returns an error if the named command's executor pool has lost track of any of its
+// tickets, which would silently lower the concurrency it allows. Tickets held by running executions are
+// accounted for, so an error means a bug rather than load. ErrUnknownCircuit is returned if the command
+// has not been executed yet.
+func PoolIntegrityCheck(name string) error {
+	circuit, err := lookupCircuit(name)
+	if err != nil {
+		return err
+	}
+
+	if err := circuit.executorPool.checkIntegrity(); err != nil {
+		log.Warn("executor pool lost track of tickets", "pool", circuit.executorPool.Name, "error", err)
+		return err
+	}
+	return nil
 }
 
 func newExecutorPool(name string) *executorPool {
+	return newExecutorPoolWithSize(name, getSettings(name).MaxConcurrentRequests)
+}
+
+func newExecutorPoolWithSize(name string, max int) *executorPool {
 	p := &executorPool{}
 	p.Name = name
 	p.Metrics = newPoolMetrics(name)
-	p.Max = getSettings(name).MaxConcurrentRequests
+	p.Max = max
+	p.mutex = &sync.RWMutex{}
+	p.available = make(chan struct{})
 
-	p.Tickets = make(chan *struct{}, p.Max)
+	p.Tickets = make(chan *poolTicket, p.Max)
 	for i := 0; i < p.Max; i++ {
-		p.Tickets <- &struct{}{}
+		p.Tickets <- &poolTicket{}
 	}
 
 	return p
 }
 
-func (p *executorPool) Return(ticket *struct{}) {
+// tryAcquire takes a ticket from the pool, returning nil if none are available.
+func (p *executorPool) tryAcquire() *poolTicket {
+	ticket, _ := p.poll()
+	return ticket
+}
+
+// tryAcquireN takes n tickets from the pool, returning nil unless all of them are available.
+func (p *executorPool) tryAcquireN(n int) []*poolTicket {
+	// Every other taker holds at least the read lock, so no ticket can be taken between
+	// checking how many are free and taking them.
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.Tickets) < n {
+		return nil
+	}
+	tickets := make([]*poolTicket, n)
+	for i := range tickets {
+		tickets[i] = p.take(<-p.Tickets)
+	}
+	return tickets
+}
+
+// poll is like tryAcquire, but when no ticket is available it also returns a channel which
+// will be closed once one may have been returned.
+func (p *executorPool) poll() (*poolTicket, chan struct{}) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	select {
+	case ticket := <-p.Tickets:
+		return p.take(ticket), nil
+	default:
+		return nil, p.available
+	}
+}
+
+// acquire takes a ticket from the pool. If none are available and fewer than maxQueue commands
+// are already waiting, it waits up to wait for one, or until done is closed. queued reports
+// whether the command had to wait.
+func (p *executorPool) acquire(maxQueue int, wait time.Duration, done <-chan struct{}) (ticket *poolTicket, queued bool) {
+	ticket = p.tryAcquire()
+	if ticket != nil || maxQueue <= 0 || wait <= 0 {
+		return ticket, false
+	}
+
+	p.mutex.Lock()
+	if p.waiting >= maxQueue {
+		p.mutex.Unlock()
+		return nil, false
+	}
+	p.waiting++
+	p.mutex.Unlock()
+
+	defer func() {
+		p.mutex.Lock()
+		p.waiting--
+		p.mutex.Unlock()
+	}()
+
+	timer := getClock().NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		// Polling once we are counted as waiting means any ticket returned after a failed poll
+		// closes the channel it hands back, so a wakeup can't be missed.
+		ticket, available := p.poll()
+		if ticket != nil {
+			return ticket, true
+		}
+
+		select {
+		case <-available:
+		case <-timer.Chan():
+			return nil, true
+		case <-done:
+			return nil, true
+		}
+	}
+}
+
+// Return puts a ticket back in the pool. A ticket which isn't held, because it has already been
+// returned, is logged and dropped, so that it can't let an extra execution run.
+func (p *executorPool) Return(ticket *poolTicket) {
 	if ticket == nil {
 		return
 	}
+	if !atomic.CompareAndSwapInt32(&ticket.held, 1, 0) {
+		log.Warn("ticket returned to the executor pool twice", "pool", p.Name)
+		return
+	}
 
-	p.Metrics.Updates <- poolMetricsUpdate{
+	p.Metrics.update(poolMetricsUpdate{
 		activeCount: p.ActiveCount(),
+	})
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	atomic.AddInt64(&p.held, -1)
+	if p.excess > 0 {
+		p.excess--
+		return
 	}
 	p.Tickets <- ticket
+	p.notifyWaiting()
+}
+
+// notifyWaiting wakes any queued commands so they can compete for a ticket. p.mutex must be held.
+func (p *executorPool) notifyWaiting() {
+	if p.waiting > 0 {
+		close(p.available)
+		p.available = make(chan struct{})
+	}
+}
+
+// resize changes the number of tickets in the pool without affecting running commands.
+func (p *executorPool) resize(max int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if max == p.Max {
+		return
+	}
+
+	active := p.Max - len(p.Tickets) + p.excess
+	p.Max = max
+	p.Tickets = make(chan *poolTicket, max)
+	for i := active; i < max; i++ {
+		p.Tickets <- &poolTicket{}
+	}
+
+	p.excess = 0
+	if active > max {
+		p.excess = active - max
+	}
+	p.notifyWaiting()
 }
 
 func (p *executorPool) ActiveCount() int {
-	return p.Max - len(p.Tickets)
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.Max - len(p.Tickets) + p.excess
+}
+
+// utilization returns the held tickets as a fraction of Max, reading both under a single lock.
+func (p *executorPool) utilization() float64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.Max <= 0 {
+		return 1
+	}
+	return float64(p.Max-len(p.Tickets)+p.excess) / float64(p.Max)
+}
+
+func (p *executorPool) size() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.Max
+}
+
+// queueLength returns the number of commands waiting for a ticket.
+func (p *executorPool) queueLength() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.waiting
+}
+
+// checkIntegrity returns an error unless every ticket of the pool is either in it or held.
+func (p *executorPool) checkIntegrity() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	free, held := len(p.Tickets), atomic.LoadInt64(&p.held)
+	if want := p.Max + p.excess; int64(free)+held != int64(want) {
+		return fmt.Errorf("hystrix: executor pool %q has %d free and %d held tickets, want %d in all", p.Name, free, held, want)
+	}
+	return nil
 }
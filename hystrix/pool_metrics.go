@@ -2,6 +2,7 @@ package hystrix
 
 import (
 	"sync"
+	"time"
 
 	"github.com/afex/hystrix-go/hystrix/rolling"
 )
@@ -9,6 +10,9 @@ import (
 type poolMetrics struct {
 	Mutex   *sync.RWMutex
 	Updates chan poolMetricsUpdate
+	flushes chan chan struct{}
+	done    chan struct{}
+	stop    sync.Once
 
 	Name              string
 	MaxActiveRequests *rolling.Number
@@ -23,6 +27,8 @@ func newPoolMetrics(name string) *poolMetrics {
 	m := &poolMetrics{}
 	m.Name = name
 	m.Updates = make(chan poolMetricsUpdate)
+	m.flushes = make(chan chan struct{})
+	m.done = make(chan struct{})
 	m.Mutex = &sync.RWMutex{}
 
 	m.Reset()
@@ -41,12 +47,59 @@ func (m *poolMetrics) Reset() {
 }
 
 func (m *poolMetrics) Monitor() {
-	for u := range m.Updates {
-		m.Mutex.RLock()
+	for {
+		select {
+		case u := <-m.Updates:
+			m.Mutex.RLock()
 
-		m.Executed.Increment(1)
-		m.MaxActiveRequests.UpdateMax(float64(u.activeCount))
+			m.Executed.Increment(1)
+			m.MaxActiveRequests.UpdateMax(float64(u.activeCount))
 
-		m.Mutex.RUnlock()
+			m.Mutex.RUnlock()
+		case flushed := <-m.flushes:
+			close(flushed)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// flush waits until every update already sent has been recorded. Updates is unbuffered, so the
+// Monitor has finished with them once it picks up the flush.
+func (m *poolMetrics) flush() {
+	flushed := make(chan struct{})
+	select {
+	case m.flushes <- flushed:
+		<-flushed
+	case <-m.done:
+	}
+}
+
+// maxActiveRequests returns the most tickets held at once over the rolling window.
+func (m *poolMetrics) maxActiveRequests(now time.Time) int {
+	m.Mutex.RLock()
+	defer m.Mutex.RUnlock()
+
+	return int(m.MaxActiveRequests.Max(now))
+}
+
+// executed returns how many tickets were returned over the rolling window.
+func (m *poolMetrics) executed(now time.Time) int {
+	m.Mutex.RLock()
+	defer m.Mutex.RUnlock()
+
+	return int(m.Executed.Sum(now))
+}
+
+// Stop ends the Monitor goroutine. Updates sent afterwards are discarded.
+func (m *poolMetrics) Stop() {
+	m.stop.Do(func() { close(m.done) })
+}
+
+// update records a ticket being returned, unless the metrics have been stopped.
+func (m *poolMetrics) update(u poolMetricsUpdate) {
+	select {
+	case m.Updates <- u:
+	case <-m.done:
 	}
 }
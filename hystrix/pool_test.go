@@ -1,6 +1,7 @@
 package hystrix
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -12,7 +13,7 @@ func TestReturn(t *testing.T) {
 
 	Convey("when returning a ticket to the pool", t, func() {
 		pool := newExecutorPool("pool")
-		ticket := <-pool.Tickets
+		ticket := pool.tryAcquire()
 		pool.Return(ticket)
 		time.Sleep(1 * time.Millisecond)
 		Convey("total executed requests should increment", func() {
@@ -26,9 +27,9 @@ func TestActiveCount(t *testing.T) {
 
 	Convey("when 3 tickets are pulled", t, func() {
 		pool := newExecutorPool("pool")
-		<-pool.Tickets
-		<-pool.Tickets
-		ticket := <-pool.Tickets
+		pool.tryAcquire()
+		pool.tryAcquire()
+		ticket := pool.tryAcquire()
 
 		Convey("ActiveCount() should be 3", func() {
 			So(pool.ActiveCount(), ShouldEqual, 3)
@@ -44,3 +45,253 @@ func TestActiveCount(t *testing.T) {
 		})
 	})
 }
+
+func TestResize(t *testing.T) {
+	defer Flush()
+
+	Convey("when 3 of 10 tickets are pulled", t, func() {
+		ConfigureCommand("pool", CommandConfig{MaxConcurrentRequests: 10})
+		pool := newExecutorPool("pool")
+		tickets := []*poolTicket{pool.tryAcquire(), pool.tryAcquire(), pool.tryAcquire()}
+
+		Convey("and the pool grows to 20", func() {
+			pool.resize(20)
+
+			Convey("17 tickets should be available", func() {
+				So(pool.ActiveCount(), ShouldEqual, 3)
+				So(len(pool.Tickets), ShouldEqual, 17)
+			})
+		})
+
+		Convey("and the pool shrinks to 2", func() {
+			pool.resize(2)
+
+			Convey("no tickets should be available until the excess is returned", func() {
+				So(pool.ActiveCount(), ShouldEqual, 3)
+				So(pool.tryAcquire(), ShouldBeNil)
+
+				pool.Return(tickets[0])
+				So(pool.ActiveCount(), ShouldEqual, 2)
+				So(pool.tryAcquire(), ShouldBeNil)
+
+				pool.Return(tickets[1])
+				So(pool.ActiveCount(), ShouldEqual, 1)
+				So(pool.tryAcquire(), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestAcquire(t *testing.T) {
+	defer Flush()
+
+	Convey("when every ticket is taken", t, func() {
+		ConfigureCommand("pool", CommandConfig{MaxConcurrentRequests: 1})
+		pool := newExecutorPool("pool")
+		ticket := pool.tryAcquire()
+		So(ticket, ShouldNotBeNil)
+
+		Convey("a command without a queue is rejected immediately", func() {
+			acquired, queued := pool.acquire(0, time.Second, nil)
+			So(acquired, ShouldBeNil)
+			So(queued, ShouldBeFalse)
+		})
+
+		Convey("a queued command receives the ticket once it is returned", func() {
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				pool.Return(ticket)
+			}()
+
+			acquired, queued := pool.acquire(1, time.Second, nil)
+			So(acquired, ShouldNotBeNil)
+			So(queued, ShouldBeTrue)
+			So(pool.queueLength(), ShouldEqual, 0)
+		})
+
+		Convey("a ticket returned while a command is joining the queue is not missed", func() {
+			for i := 0; i < 1000; i++ {
+				go pool.Return(ticket)
+
+				start := time.Now()
+				acquired, _ := pool.acquire(1, time.Second, nil)
+				So(acquired, ShouldNotBeNil)
+				So(time.Since(start), ShouldBeLessThan, 500*time.Millisecond)
+				ticket = acquired
+			}
+		})
+
+		Convey("a queued command gives up after the queue timeout", func() {
+			acquired, queued := pool.acquire(1, 20*time.Millisecond, nil)
+			So(acquired, ShouldBeNil)
+			So(queued, ShouldBeTrue)
+		})
+
+		Convey("a command is rejected when the queue is full", func() {
+			go pool.acquire(1, 100*time.Millisecond, nil)
+			time.Sleep(10 * time.Millisecond)
+
+			acquired, queued := pool.acquire(1, time.Second, nil)
+			So(acquired, ShouldBeNil)
+			So(queued, ShouldBeFalse)
+		})
+	})
+}
+
+func TestConcurrencyIntrospection(t *testing.T) {
+	defer Flush()
+
+	Convey("given a command allowing 5 concurrent requests", t, func() {
+		ConfigureCommand("active", CommandConfig{MaxConcurrentRequests: 5})
+
+		Convey("with 2 running executions", func() {
+			release := make(chan bool)
+			for i := 0; i < 2; i++ {
+				Go("active", func() error {
+					<-release
+					return nil
+				}, nil)
+			}
+			time.Sleep(10 * time.Millisecond)
+
+			Convey("ActiveCount and MaxConcurrency report the pool usage", func() {
+				active, err := ActiveCount("active")
+				So(err, ShouldBeNil)
+				So(active, ShouldEqual, 2)
+
+				max, err := MaxConcurrency("active")
+				So(err, ShouldBeNil)
+				So(max, ShouldEqual, 5)
+
+				utilization, err := PoolUtilization("active")
+				So(err, ShouldBeNil)
+				So(utilization, ShouldAlmostEqual, 0.4)
+
+				close(release)
+				time.Sleep(10 * time.Millisecond)
+				active, _ = ActiveCount("active")
+				So(active, ShouldEqual, 0)
+				utilization, _ = PoolUtilization("active")
+				So(utilization, ShouldEqual, 0)
+
+				peak, err := MaxActiveRequests("active")
+				So(err, ShouldBeNil)
+				So(peak, ShouldEqual, 2)
+			})
+		})
+
+		Convey("an unknown command returns ErrUnknownCircuit without creating its circuit", func() {
+			_, err := PoolUtilization("active-unknown")
+			So(err, ShouldResemble, ErrUnknownCircuit)
+			_, err = MaxActiveRequests("active-unknown")
+			So(err, ShouldResemble, ErrUnknownCircuit)
+			So(PoolIntegrityCheck("active-unknown"), ShouldResemble, ErrUnknownCircuit)
+
+			So(CircuitNames(), ShouldNotContain, "active-unknown")
+		})
+	})
+}
+
+func TestSharedPool(t *testing.T) {
+	Convey("with two commands sharing a pool of size 1", t, func() {
+		defer Flush()
+
+		ConfigureCommand("shared-a", CommandConfig{PoolName: "backend", MaxConcurrentRequests: 1})
+		ConfigureCommand("shared-b", CommandConfig{PoolName: "backend", MaxConcurrentRequests: 1})
+
+		Convey("they take tickets from the same pool", func() {
+			a, _, _ := GetCircuit("shared-a")
+			b, _, _ := GetCircuit("shared-b")
+			So(a.executorPool, ShouldEqual, b.executorPool)
+			So(a.executorPool.Name, ShouldEqual, "backend")
+		})
+
+		Convey("they can't both run at the same time", func() {
+			running := make(chan struct{})
+			release := make(chan struct{})
+			go Do("shared-a", func() error {
+				close(running)
+				<-release
+				return nil
+			}, nil)
+			<-running
+
+			err := Do("shared-b", func() error {
+				return nil
+			}, nil)
+			close(release)
+			So(errors.Is(err, ErrMaxConcurrency), ShouldBeTrue)
+
+			snapshot, _ := Metrics("shared-b")
+			So(snapshot.Rejects, ShouldEqual, 1)
+		})
+
+		Convey("reconfiguring one of them doesn't resize the pool", func() {
+			a, _, _ := GetCircuit("shared-a")
+			GetCircuit("shared-b")
+			So(ConfigureCommand("shared-b", CommandConfig{PoolName: "backend", MaxConcurrentRequests: 5}), ShouldBeNil)
+			So(a.executorPool.size(), ShouldEqual, 1)
+		})
+	})
+
+	Convey("with a shared pool given by the default config", t, func() {
+		defer Flush()
+		defer SetDefaultConfig(CommandConfig{})
+
+		SetDefaultConfig(CommandConfig{PoolName: "default-backend", MaxConcurrentRequests: 2})
+		cb, _, _ := GetCircuit("shared-default")
+
+		Convey("changing the default doesn't resize the pool", func() {
+			So(SetDefaultConfig(CommandConfig{PoolName: "default-backend", MaxConcurrentRequests: 5}), ShouldBeNil)
+			So(cb.executorPool.size(), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestPoolIntegrity(t *testing.T) {
+	defer Flush()
+
+	Convey("with a pool of 10 tickets", t, func() {
+		pool := newExecutorPoolWithSize("integrity", 10)
+
+		Convey("held tickets are accounted for", func() {
+			ticket := pool.tryAcquire()
+			So(pool.checkIntegrity(), ShouldBeNil)
+
+			pool.Return(ticket)
+			So(pool.checkIntegrity(), ShouldBeNil)
+			So(len(pool.Tickets), ShouldEqual, 10)
+		})
+
+		Convey("a ticket returned twice goes back only once", func() {
+			ticket := pool.tryAcquire()
+			other := pool.tryAcquire()
+			pool.Return(ticket)
+			pool.Return(ticket)
+
+			So(pool.ActiveCount(), ShouldEqual, 1)
+			So(pool.checkIntegrity(), ShouldBeNil)
+
+			pool.Return(other)
+			So(pool.ActiveCount(), ShouldEqual, 0)
+		})
+
+		Convey("a ticket which disappears is reported", func() {
+			ticket := pool.tryAcquire()
+			pool.Tickets <- ticket
+			So(pool.checkIntegrity(), ShouldNotBeNil)
+		})
+
+		Convey("tickets held across a resize are accounted for", func() {
+			tickets := []*poolTicket{pool.tryAcquire(), pool.tryAcquire(), pool.tryAcquire()}
+			pool.resize(2)
+			So(pool.checkIntegrity(), ShouldBeNil)
+
+			for _, ticket := range tickets {
+				pool.Return(ticket)
+			}
+			So(pool.checkIntegrity(), ShouldBeNil)
+			So(len(pool.Tickets), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,33 @@
+package rolling
+
+import "time"
+
+// clock provides the time to a window. Windows key their buckets by the time elapsed since they were
+// created, as measured by the clock, so that stepping the wall clock neither skips nor reuses buckets.
+type clock interface {
+	Now() time.Time
+	// Since returns how long after start the reading t was taken. It must not be affected by changes
+	// to the wall clock between the two readings.
+	Since(start, t time.Time) time.Duration
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Since relies on time.Time.Sub, which compares the monotonic readings of times returned by time.Now.
+func (realClock) Since(start, t time.Time) time.Duration {
+	return t.Sub(start)
+}
+
+// bucketIndex returns the index of the bucket of width nanoseconds which elapsed falls into, rounding
+// down so that times before the start of the window get negative indexes.
+func bucketIndex(elapsed time.Duration, width int64) int64 {
+	index := int64(elapsed) / width
+	if elapsed < 0 && int64(elapsed)%width != 0 {
+		index--
+	}
+	return index
+}
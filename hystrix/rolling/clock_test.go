@@ -0,0 +1,48 @@
+package rolling
+
+import (
+	"sync"
+	"time"
+)
+
+// fakeClock keeps a wall clock, which Jump can step in either direction, apart from the monotonic time
+// elapsed since it was created, which only Advance moves forward. As with the monotonic readings of
+// time.Now, Since only compares readings the clock has returned.
+type fakeClock struct {
+	mu       sync.Mutex
+	wall     time.Time
+	elapsed  time.Duration
+	readings map[time.Time]time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{wall: time.Unix(1500000000, 0), readings: make(map[time.Time]time.Duration)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readings[c.wall] = c.elapsed
+	return c.wall
+}
+
+func (c *fakeClock) Since(start, t time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readings[t] - c.readings[start]
+}
+
+// Advance lets d pass on both clocks.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.wall = c.wall.Add(d)
+	c.elapsed += d
+}
+
+// Jump steps the wall clock by d without any time passing, as an NTP correction would.
+func (c *fakeClock) Jump(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.wall = c.wall.Add(d)
+}
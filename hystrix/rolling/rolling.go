@@ -5,11 +5,23 @@ import (
 	"time"
 )
 
+// DefaultWindow and DefaultBuckets describe the window of a Number created with NewNumber:
+// 10 buckets, each one second long.
+const (
+	DefaultWindow  = 10 * time.Second
+	DefaultBuckets = 10
+)
+
 // Number tracks a numberBucket over a bounded number of
-// time buckets. Currently the buckets are one second long and only the last 10 seconds are kept.
+// time buckets. By default the buckets are one second long and only the last 10 seconds are kept.
 type Number struct {
 	Buckets map[int64]*numberBucket
 	Mutex   *sync.RWMutex
+
+	buckets     int64
+	bucketWidth int64
+	clock       clock
+	start       time.Time
 }
 
 type numberBucket struct {
@@ -18,15 +30,34 @@ type numberBucket struct {
 
 // NewNumber initializes a RollingNumber struct.
 func NewNumber() *Number {
+	return NewNumberWithWindow(DefaultWindow, DefaultBuckets)
+}
+
+// NewNumberWithWindow initializes a RollingNumber struct which keeps the given number of buckets
+// spanning window. window and buckets must be positive, and window must be at least buckets nanoseconds.
+func NewNumberWithWindow(window time.Duration, buckets int) *Number {
+	return newNumber(window, buckets, realClock{})
+}
+
+func newNumber(window time.Duration, buckets int, c clock) *Number {
 	r := &Number{
-		Buckets: make(map[int64]*numberBucket),
-		Mutex:   &sync.RWMutex{},
+		Buckets:     make(map[int64]*numberBucket),
+		Mutex:       &sync.RWMutex{},
+		buckets:     int64(buckets),
+		bucketWidth: window.Nanoseconds() / int64(buckets),
+		clock:       c,
+		start:       c.Now(),
 	}
 	return r
 }
 
+// bucketKey returns the key of the bucket which t falls into, counted from the creation of the Number.
+func (r *Number) bucketKey(t time.Time) int64 {
+	return bucketIndex(r.clock.Since(r.start, t), r.bucketWidth)
+}
+
 func (r *Number) getCurrentBucket() *numberBucket {
-	now := time.Now().Unix()
+	now := r.bucketKey(r.clock.Now())
 	var bucket *numberBucket
 	var ok bool
 
@@ -39,10 +70,9 @@ func (r *Number) getCurrentBucket() *numberBucket {
 }
 
 func (r *Number) removeOldBuckets() {
-	now := time.Now().Unix() - 10
+	now := r.bucketKey(r.clock.Now()) - r.buckets
 
 	for timestamp := range r.Buckets {
-		// TODO: configurable rolling window
 		if timestamp <= now {
 			delete(r.Buckets, timestamp)
 		}
@@ -75,16 +105,37 @@ func (r *Number) UpdateMax(n float64) {
 	r.removeOldBuckets()
 }
 
-// Sum sums the values over the buckets in the last 10 seconds.
+// Sum sums the values over the buckets in the rolling window.
 func (r *Number) Sum(now time.Time) float64 {
 	sum := float64(0)
 
 	r.Mutex.RLock()
 	defer r.Mutex.RUnlock()
 
+	oldest := r.bucketKey(now) - r.buckets
+	for timestamp, bucket := range r.Buckets {
+		if timestamp >= oldest {
+			sum += bucket.Value
+		}
+	}
+
+	return sum
+}
+
+// SumSince sums the values added over the last d, rounded out to whole buckets, or over the rolling
+// window if d is longer.
+func (r *Number) SumSince(now time.Time, d time.Duration) float64 {
+	sum := float64(0)
+
+	r.Mutex.RLock()
+	defer r.Mutex.RUnlock()
+
+	oldest := bucketIndex(r.clock.Since(r.start, now)-d, r.bucketWidth)
+	if windowStart := r.bucketKey(now) - r.buckets; oldest < windowStart {
+		oldest = windowStart
+	}
 	for timestamp, bucket := range r.Buckets {
-		// TODO: configurable rolling window
-		if timestamp >= now.Unix()-10 {
+		if timestamp >= oldest {
 			sum += bucket.Value
 		}
 	}
@@ -92,16 +143,16 @@ func (r *Number) Sum(now time.Time) float64 {
 	return sum
 }
 
-// Max returns the maximum value seen in the last 10 seconds.
+// Max returns the maximum value seen in the rolling window.
 func (r *Number) Max(now time.Time) float64 {
 	var max float64
 
 	r.Mutex.RLock()
 	defer r.Mutex.RUnlock()
 
+	oldest := r.bucketKey(now) - r.buckets
 	for timestamp, bucket := range r.Buckets {
-		// TODO: configurable rolling window
-		if timestamp >= now.Unix()-10 {
+		if timestamp >= oldest {
 			if bucket.Value > max {
 				max = bucket.Value
 			}
@@ -111,6 +162,7 @@ func (r *Number) Max(now time.Time) float64 {
 	return max
 }
 
+// Avg returns the average value per bucket in the rolling window.
 func (r *Number) Avg(now time.Time) float64 {
-	return r.Sum(now) / 10
+	return r.Sum(now) / float64(r.buckets)
 }
@@ -36,6 +36,74 @@ func TestAvg(t *testing.T) {
 	})
 }
 
+func TestNumberWithWindow(t *testing.T) {
+	Convey("when adding values to a rolling number with a 50 millisecond window of 5 buckets", t, func() {
+		n := NewNumberWithWindow(50*time.Millisecond, 5)
+		n.Increment(1)
+		n.Increment(2)
+
+		Convey("they should be summed within the window", func() {
+			So(n.Sum(time.Now()), ShouldEqual, 3)
+			So(n.Avg(time.Now()), ShouldEqual, 0.6)
+		})
+
+		Convey("they should expire once the window has passed", func() {
+			time.Sleep(80 * time.Millisecond)
+			So(n.Sum(time.Now()), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestSumSince(t *testing.T) {
+	Convey("when adding values to a rolling number with a 1 second window of 100 buckets", t, func() {
+		n := NewNumberWithWindow(time.Second, 100)
+		n.Increment(1)
+		time.Sleep(60 * time.Millisecond)
+		n.Increment(2)
+
+		Convey("only the values within the duration should be summed", func() {
+			So(n.SumSince(time.Now(), 30*time.Millisecond), ShouldEqual, 2)
+			So(n.SumSince(time.Now(), 200*time.Millisecond), ShouldEqual, 3)
+		})
+
+		Convey("a duration longer than the window should sum the whole window", func() {
+			So(n.SumSince(time.Now(), time.Hour), ShouldEqual, n.Sum(time.Now()))
+		})
+	})
+}
+
+func TestNumberWallClockJump(t *testing.T) {
+	Convey("when the wall clock is stepped back while adding values to a rolling number", t, func() {
+		c := newFakeClock()
+		n := newNumber(10*time.Second, 10, c)
+		n.Increment(1)
+		c.Advance(time.Second)
+		n.Increment(2)
+		c.Jump(-time.Hour)
+		c.Advance(time.Second)
+		n.Increment(3)
+
+		Convey("each value should land in a bucket of its own and be kept", func() {
+			So(n.Buckets, ShouldHaveLength, 3)
+			So(n.Sum(c.Now()), ShouldEqual, 6)
+			So(n.Max(c.Now()), ShouldEqual, 3)
+			So(n.SumSince(c.Now(), 500*time.Millisecond), ShouldEqual, 5)
+		})
+
+		Convey("stepping it forward again should not expire them", func() {
+			c.Jump(2 * time.Hour)
+			So(n.Sum(c.Now()), ShouldEqual, 6)
+		})
+
+		Convey("they should still expire once the window has passed", func() {
+			c.Advance(9 * time.Second)
+			So(n.Sum(c.Now()), ShouldEqual, 5)
+			c.Advance(2 * time.Second)
+			So(n.Sum(c.Now()), ShouldEqual, 0)
+		})
+	})
+}
+
 func BenchmarkRollingNumberIncrement(b *testing.B) {
 	n := NewNumber()
 
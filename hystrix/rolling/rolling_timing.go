@@ -16,21 +16,49 @@ type Timing struct {
 
 	CachedSortedDurations []time.Duration
 	LastCachedTime        int64
+
+	buckets     int64
+	bucketWidth int64
+	clock       clock
+	start       time.Time
+	lastCached  time.Time
 }
 
 type timingBucket struct {
 	Durations []time.Duration
 }
 
+// DefaultTimingWindow is the window of a Timing created with NewTiming, kept in one second buckets.
+const DefaultTimingWindow = 60 * time.Second
+
 // NewTiming creates a RollingTiming struct.
 func NewTiming() *Timing {
+	return NewTimingWithWindow(DefaultTimingWindow, int(DefaultTimingWindow/time.Second))
+}
+
+// NewTimingWithWindow creates a RollingTiming struct which keeps the given number of buckets
+// spanning window. window and buckets must be positive, and window must be at least buckets nanoseconds.
+func NewTimingWithWindow(window time.Duration, buckets int) *Timing {
+	return newTiming(window, buckets, realClock{})
+}
+
+func newTiming(window time.Duration, buckets int, c clock) *Timing {
 	r := &Timing{
-		Buckets: make(map[int64]*timingBucket),
-		Mutex:   &sync.RWMutex{},
+		Buckets:     make(map[int64]*timingBucket),
+		Mutex:       &sync.RWMutex{},
+		buckets:     int64(buckets),
+		bucketWidth: window.Nanoseconds() / int64(buckets),
+		clock:       c,
+		start:       c.Now(),
 	}
 	return r
 }
 
+// bucketKey returns the key of the bucket which t falls into, counted from the creation of the Timing.
+func (r *Timing) bucketKey(t time.Time) int64 {
+	return bucketIndex(r.clock.Since(r.start, t), r.bucketWidth)
+}
+
 type byDuration []time.Duration
 
 func (c byDuration) Len() int           { return len(c) }
@@ -38,26 +66,27 @@ func (c byDuration) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
 func (c byDuration) Less(i, j int) bool { return c[i] < c[j] }
 
 // SortedDurations returns an array of time.Duration sorted from shortest
-// to longest that have occurred in the last 60 seconds.
+// to longest that have occurred in the rolling window.
 func (r *Timing) SortedDurations() []time.Duration {
+	now := r.clock.Now()
+
 	r.Mutex.RLock()
-	t := r.LastCachedTime
+	t := r.lastCached
 	r.Mutex.RUnlock()
 
-	if t+time.Duration(1*time.Second).Nanoseconds() > time.Now().UnixNano() {
+	if !t.IsZero() && r.clock.Since(t, now) < time.Second {
 		// don't recalculate if current cache is still fresh
 		return r.CachedSortedDurations
 	}
 
 	var durations byDuration
-	now := time.Now()
 
 	r.Mutex.Lock()
 	defer r.Mutex.Unlock()
 
+	oldest := r.bucketKey(now) - r.buckets
 	for timestamp, b := range r.Buckets {
-		// TODO: configurable rolling window
-		if timestamp >= now.Unix()-60 {
+		if timestamp >= oldest {
 			for _, d := range b.Durations {
 				durations = append(durations, d)
 			}
@@ -67,34 +96,34 @@ func (r *Timing) SortedDurations() []time.Duration {
 	sort.Sort(durations)
 
 	r.CachedSortedDurations = durations
-	r.LastCachedTime = time.Now().UnixNano()
+	r.lastCached = now
+	r.LastCachedTime = now.UnixNano()
 
 	return r.CachedSortedDurations
 }
 
 func (r *Timing) getCurrentBucket() *timingBucket {
 	r.Mutex.RLock()
-	now := time.Now()
-	bucket, exists := r.Buckets[now.Unix()]
+	now := r.bucketKey(r.clock.Now())
+	bucket, exists := r.Buckets[now]
 	r.Mutex.RUnlock()
 
 	if !exists {
 		r.Mutex.Lock()
 		defer r.Mutex.Unlock()
 
-		r.Buckets[now.Unix()] = &timingBucket{}
-		bucket = r.Buckets[now.Unix()]
+		r.Buckets[now] = &timingBucket{}
+		bucket = r.Buckets[now]
 	}
 
 	return bucket
 }
 
 func (r *Timing) removeOldBuckets() {
-	now := time.Now()
+	oldest := r.bucketKey(r.clock.Now()) - r.buckets
 
 	for timestamp := range r.Buckets {
-		// TODO: configurable rolling window
-		if timestamp <= now.Unix()-60 {
+		if timestamp <= oldest {
 			delete(r.Buckets, timestamp)
 		}
 	}
@@ -111,8 +140,13 @@ func (r *Timing) Add(duration time.Duration) {
 	r.removeOldBuckets()
 }
 
-// Percentile computes the percentile given with a linear interpolation.
+// Percentile computes the percentile given with a linear interpolation, in milliseconds.
 func (r *Timing) Percentile(p float64) uint32 {
+	return uint32(r.PercentileDuration(p).Nanoseconds() / 1000000)
+}
+
+// PercentileDuration is like Percentile, but returns the duration itself.
+func (r *Timing) PercentileDuration(p float64) time.Duration {
 	sortedDurations := r.SortedDurations()
 	length := len(sortedDurations)
 	if length <= 0 {
@@ -120,7 +154,7 @@ func (r *Timing) Percentile(p float64) uint32 {
 	}
 
 	pos := r.ordinal(len(sortedDurations), p) - 1
-	return uint32(sortedDurations[pos].Nanoseconds() / 1000000)
+	return sortedDurations[pos]
 }
 
 func (r *Timing) ordinal(length int, percentile float64) int64 {
@@ -131,7 +165,7 @@ func (r *Timing) ordinal(length int, percentile float64) int64 {
 	return int64(math.Ceil((percentile / float64(100)) * float64(length)))
 }
 
-// Mean computes the average timing in the last 60 seconds.
+// Mean computes the average timing in the rolling window.
 func (r *Timing) Mean() uint32 {
 	sortedDurations := r.SortedDurations()
 	var sum time.Duration
@@ -68,3 +68,48 @@ func TestOrdinal(t *testing.T) {
 		})
 	})
 }
+
+func TestTimingWithWindow(t *testing.T) {
+	Convey("given a rolling timing with a 500 millisecond window of 5 buckets", t, func() {
+		r := NewTimingWithWindow(500*time.Millisecond, 5)
+		r.Add(10 * time.Millisecond)
+
+		Convey("durations within the window are measured", func() {
+			So(r.Mean(), ShouldEqual, 10)
+		})
+
+		Convey("durations expire once the window has passed", func() {
+			time.Sleep(1100 * time.Millisecond)
+			So(r.Mean(), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestTimingWallClockJump(t *testing.T) {
+	Convey("when the wall clock is stepped back while adding to a rolling timing", t, func() {
+		c := newFakeClock()
+		r := newTiming(10*time.Second, 10, c)
+		r.Add(10 * time.Millisecond)
+		c.Jump(-time.Hour)
+		c.Advance(time.Second)
+		r.Add(30 * time.Millisecond)
+
+		Convey("both durations should be measured", func() {
+			So(r.Buckets, ShouldHaveLength, 2)
+			So(r.Mean(), ShouldEqual, 20)
+		})
+
+		Convey("the cached durations should be refreshed after a second", func() {
+			So(r.Mean(), ShouldEqual, 20)
+			r.Add(50 * time.Millisecond)
+			So(r.Mean(), ShouldEqual, 20)
+			c.Advance(time.Second)
+			So(r.Mean(), ShouldEqual, 30)
+		})
+
+		Convey("they should expire once the window has passed", func() {
+			c.Advance(11 * time.Second)
+			So(r.Mean(), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,116 @@
+package hystrix
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// NewRoundTripper returns an http.RoundTripper which sends each request through next as an execution
+// of the named command, with the context of the request, so that an http.Client can be given a
+// circuit breaker by wrapping its Transport. next defaults to http.DefaultTransport.
+//
+// fallback, if not nil, is called with the request and the error instead of returning the error, as
+// with the fallback of DoC. When it returns no response, or there is no fallback to cover the error, the
+// error is returned as http.Client requires.
+func NewRoundTripper(name string, next http.RoundTripper, fallback func(*http.Request, error) (*http.Response, error)) *RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &RoundTripper{name: name, next: next, fallback: fallback}
+}
+
+// A RoundTripper runs each request as an execution of a command. See NewRoundTripper.
+type RoundTripper struct {
+	// IsFailure decides which responses count as failures of the command. Their bodies are closed, and
+	// the request fails over to the fallback with a StatusError. Unless it is set, every response whose
+	// status is not 2xx is a failure.
+	IsFailure func(*http.Response) bool
+
+	name     string
+	next     http.RoundTripper
+	fallback func(*http.Request, error) (*http.Response, error)
+}
+
+var _ http.RoundTripper = (*RoundTripper)(nil)
+
+// A StatusError is the error of a request sent by a RoundTripper whose response was a failure.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e StatusError) Error() string {
+	return "hystrix: response status " + e.Status
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A response which arrives once the command has answered without it, such as after a timeout, is
+	// never read by anyone, so its body is closed here instead. Likewise the body of a request which was
+	// never handed to next, such as when the circuit is open, is closed here as http.RoundTripper
+	// requires.
+	var mu sync.Mutex
+	var runResp *http.Response
+	answered, sent := false, false
+
+	run := func(ctx context.Context) (*http.Response, error) {
+		mu.Lock()
+		if answered {
+			mu.Unlock()
+			return nil, context.Canceled
+		}
+		sent = true
+		mu.Unlock()
+
+		resp, err := rt.next.RoundTrip(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if rt.failed(resp) {
+			resp.Body.Close()
+			return nil, StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if answered {
+			resp.Body.Close()
+		} else {
+			runResp = resp
+		}
+		return resp, nil
+	}
+
+	var fallback func(context.Context, error) (*http.Response, error)
+	if rt.fallback != nil {
+		fallback = func(ctx context.Context, err error) (*http.Response, error) {
+			return rt.fallback(req, err)
+		}
+	}
+
+	resp, outcome, err := Execute(req.Context(), rt.name, run, fallback)
+
+	mu.Lock()
+	answered = true
+	if !sent && req.Body != nil {
+		req.Body.Close()
+	}
+	if runResp != nil && runResp != resp {
+		runResp.Body.Close()
+	}
+	mu.Unlock()
+
+	if resp == nil && err == nil {
+		// the fallback covered the error without a response to return
+		return nil, outcome.Cause
+	}
+	return resp, err
+}
+
+func (rt *RoundTripper) failed(resp *http.Response) bool {
+	if rt.IsFailure != nil {
+		return rt.IsFailure(resp)
+	}
+	return resp.StatusCode < 200 || resp.StatusCode > 299
+}
@@ -0,0 +1,110 @@
+package hystrix
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRoundTripper(t *testing.T) {
+	Convey("with a client whose transport runs requests as a command", t, func() {
+		defer Flush()
+
+		status := http.StatusOK
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(status)
+			io.WriteString(rw, "from server")
+		}))
+		defer server.Close()
+
+		get := func(rt *RoundTripper) (string, error) {
+			resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+			if err != nil {
+				return "", err
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			return string(body), err
+		}
+		fallback := func(req *http.Request, err error) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader("from fallback")),
+				Request:    req,
+			}, nil
+		}
+
+		Convey("a successful response is returned", func() {
+			body, err := get(NewRoundTripper("http_ok", nil, fallback))
+			So(err, ShouldBeNil)
+			So(body, ShouldEqual, "from server")
+
+			snapshot, _ := Metrics("http_ok")
+			So(snapshot.Successes, ShouldEqual, 1)
+		})
+
+		Convey("a non-2xx response fails over to the fallback", func() {
+			status = http.StatusServiceUnavailable
+			body, err := get(NewRoundTripper("http_unavailable", nil, fallback))
+			So(err, ShouldBeNil)
+			So(body, ShouldEqual, "from fallback")
+
+			snapshot, _ := Metrics("http_unavailable")
+			So(snapshot.Failures, ShouldEqual, 1)
+		})
+
+		Convey("without a fallback the status error is returned", func() {
+			status = http.StatusServiceUnavailable
+			_, err := get(NewRoundTripper("http_no_fallback", nil, nil))
+			var statusErr StatusError
+			So(errors.As(err, &statusErr), ShouldBeTrue)
+			So(statusErr.StatusCode, ShouldEqual, http.StatusServiceUnavailable)
+		})
+
+		Convey("IsFailure decides which responses are failures", func() {
+			status = http.StatusNotFound
+			rt := NewRoundTripper("http_is_failure", nil, fallback)
+			rt.IsFailure = func(resp *http.Response) bool {
+				return resp.StatusCode >= 500
+			}
+			body, err := get(rt)
+			So(err, ShouldBeNil)
+			So(body, ShouldEqual, "from server")
+		})
+
+		Convey("an open circuit doesn't send the request", func() {
+			ForceOpen("http_open")
+			defer ClearForced("http_open")
+
+			_, err := get(NewRoundTripper("http_open", nil, nil))
+			So(errors.Is(err, ErrCircuitOpen), ShouldBeTrue)
+		})
+
+		Convey("the body of a request which isn't sent is closed", func() {
+			ForceOpen("http_open_body")
+			defer ClearForced("http_open_body")
+
+			body := &closeRecorder{Reader: strings.NewReader("payload")}
+			req, _ := http.NewRequest(http.MethodPost, server.URL, body)
+
+			_, err := NewRoundTripper("http_open_body", nil, nil).RoundTrip(req)
+			So(errors.Is(err, ErrCircuitOpen), ShouldBeTrue)
+			So(body.closed, ShouldBeTrue)
+		})
+	})
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
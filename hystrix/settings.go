@@ -1,10 +1,16 @@
 package hystrix
 
 import (
+	"fmt"
 	"sync"
 	"time"
 )
 
+// NoTimeout can be used as the Timeout of a CommandConfig to disable the timeout for a command.
+// Commands then run until they complete, or until the deadline of the context passed to GoC or
+// DoC, if it has one.
+const NoTimeout = -1
+
 var (
 	// DefaultTimeout is how long to wait for command to complete, in milliseconds
 	DefaultTimeout = 1000
@@ -14,18 +20,75 @@ var (
 	DefaultVolumeThreshold = 20
 	// DefaultSleepWindow is how long, in milliseconds, to wait after a circuit opens before testing for recovery
 	DefaultSleepWindow = 5000
+	// DefaultMaxSleepWindow is how long, in milliseconds, a sleep window grown by a SleepWindowMultiplier may become
+	DefaultMaxSleepWindow = 300000
 	// DefaultErrorPercentThreshold causes circuits to open once the rolling measure of errors exceeds this percent of requests
 	DefaultErrorPercentThreshold = 50
+	// DefaultRollingWindow is how long, in milliseconds, the counts used to measure circuit health are kept
+	DefaultRollingWindow = 10000
+	// DefaultRollingBuckets is how many buckets the rolling window is divided into
+	DefaultRollingBuckets = 10
+	// DefaultLatencyPercentile is the percentile of run durations compared against a LatencyThreshold
+	DefaultLatencyPercentile = 99.0
+	// DefaultAdaptiveTimeoutPercentile is the percentile of run durations an AdaptiveTimeout is based on
+	DefaultAdaptiveTimeoutPercentile = 99.9
+	// DefaultHalfOpenMaxRequests is how many test requests a half-open circuit admits at a time
+	DefaultHalfOpenMaxRequests = 1
 	// DefaultLogger is the default logger that will be used in the Hystrix package. By default prints nothing.
 	DefaultLogger = NoopLogger{}
 )
 
 type Settings struct {
-	Timeout                time.Duration
-	MaxConcurrentRequests  int
-	RequestVolumeThreshold uint64
-	SleepWindow            time.Duration
-	ErrorPercentThreshold  int
+	Timeout                     time.Duration
+	MaxConcurrentRequests       int
+	RequestVolumeThreshold      uint64
+	SleepWindow                 time.Duration
+	ErrorPercentThreshold       int
+	IsErrorIgnorable            func(error) bool
+	ErrorEvent                  func(error) string
+	PropagatePanics             bool
+	MaxQueueSize                int
+	QueueTimeout                time.Duration
+	RollingWindow               time.Duration
+	RollingBuckets              int
+	RequestVolumePerSecond      int
+	PoolName                    string
+	HalfOpenMaxRequests         int
+	HalfOpenSuccessThreshold    int
+	SleepWindowJitter           int
+	ConsecutiveFailureThreshold int
+	MonitorOnly                 bool
+	MetricsNamespace            string
+	MaxRetries                  int
+	RetryBackoff                time.Duration
+	LatencyThreshold            time.Duration
+	LatencyPercentile           float64
+	AdaptiveTimeout             bool
+	AdaptiveTimeoutPercentile   float64
+	AdaptiveTimeoutMargin       time.Duration
+	MinTimeout                  time.Duration
+	MaxConcurrentFallbacks      int
+	SleepWindowMultiplier       float64
+	MaxSleepWindow              time.Duration
+	CancelOnTimeout             bool
+	Group                       string
+}
+
+// group returns the group of the command called name.
+func (s *Settings) group(name string) string {
+	if s.Group != "" {
+		return s.Group
+	}
+	return name
+}
+
+// volumeThreshold returns the number of requests in the rolling window needed before the circuit
+// may be tripped.
+func (s *Settings) volumeThreshold() uint64 {
+	if s.RequestVolumePerSecond > 0 {
+		return uint64(float64(s.RequestVolumePerSecond) * s.RollingWindow.Seconds())
+	}
+	return s.RequestVolumeThreshold
 }
 
 // CommandConfig is used to tune circuit settings at runtime
@@ -35,30 +98,301 @@ type CommandConfig struct {
 	RequestVolumeThreshold int `json:"request_volume_threshold"`
 	SleepWindow            int `json:"sleep_window"`
 	ErrorPercentThreshold  int `json:"error_percent_threshold"`
+	// IsErrorIgnorable reports whether an error returned by run is an expected outcome
+	// which should not count against the health of the circuit.
+	IsErrorIgnorable func(error) bool `json:"-"`
+	// ErrorEvent maps an error returned by run to the event it is recorded as: "failure", "rejected",
+	// "timeout", "short-circuit" or "non-failure-error". Returning "" leaves the error to
+	// IsErrorIgnorable, and otherwise records it as a failure.
+	ErrorEvent func(error) string `json:"-"`
+	// PropagatePanics re-panics after a panic in run has been recorded as a failure,
+	// instead of returning it as an error.
+	PropagatePanics bool `json:"propagate_panics"`
+	// MaxQueueSize is how many commands may wait for a ticket when MaxConcurrentRequests are
+	// already running, instead of being rejected immediately. Commands wait at most QueueTimeout
+	// milliseconds. Leaving either at 0 rejects commands as soon as the pool is exhausted.
+	MaxQueueSize int `json:"max_queue_size"`
+	QueueTimeout int `json:"queue_timeout"`
+	// RollingWindow is how long, in milliseconds, metrics are kept to measure the health of the circuit,
+	// divided into RollingBuckets buckets. Latency percentiles are kept for at least 60 seconds.
+	RollingWindow  int `json:"rolling_window"`
+	RollingBuckets int `json:"rolling_buckets"`
+	// RequestVolumePerSecond expresses the volume threshold as a request rate, which is multiplied by the
+	// length of the rolling window. When set, it is used instead of RequestVolumeThreshold.
+	RequestVolumePerSecond int `json:"request_volume_per_second"`
+	// PoolName makes the command take its tickets from an executor pool shared with every other
+	// command of the same PoolName, so that they all count against one MaxConcurrentRequests.
+	// The pool is sized by the first of them to run, and keeps that size when any of them is
+	// reconfigured. It is read when the circuit is created.
+	PoolName string `json:"pool_name"`
+	// HalfOpenMaxRequests is how many test requests may run at a time once the sleep window of an open
+	// circuit has elapsed. The circuit closes after HalfOpenSuccessThreshold of them succeed in a row,
+	// which defaults to HalfOpenMaxRequests. Any failure resets the count and restarts the sleep window.
+	HalfOpenMaxRequests      int `json:"half_open_max_requests"`
+	HalfOpenSuccessThreshold int `json:"half_open_success_threshold"`
+	// SleepWindowJitter varies the sleep window by up to this percentage either way each time the circuit
+	// opens, so that instances which opened together don't all send their test requests at once.
+	SleepWindowJitter int `json:"sleep_window_jitter"`
+	// ConsecutiveFailureThreshold opens the circuit once this many executions in a row have failed or
+	// timed out, whatever the volume of requests or the error percentage. It is checked as well as
+	// ErrorPercentThreshold, so either can open the circuit. 0 disables it.
+	ConsecutiveFailureThreshold int `json:"consecutive_failure_threshold"`
+	// MonitorOnly records every event and latency as usual but never short-circuits, so the metrics of
+	// a new dependency can be observed before the circuit is allowed to open. ForceOpen still applies.
+	MonitorOnly bool `json:"monitor_only"`
+	// MetricsNamespace is passed to metric collectors with each update, so that commands sharing it can be
+	// grouped together. The Statsd collector prefixes their metric names with it.
+	MetricsNamespace string `json:"metrics_namespace"`
+	// MaxRetries is how many times a failed run function is run again before the command fails, waiting
+	// RetryBackoff milliseconds before the first retry and twice as long before each one after it. The
+	// attempts are recorded as a single execution, with a retry event for each retry, and never outlast
+	// the timeout. Ignorable errors and panics are not retried. 0 disables retries.
+	MaxRetries   int `json:"max_retries"`
+	RetryBackoff int `json:"retry_backoff"`
+	// LatencyThreshold opens the circuit, whatever its error percentage, once the LatencyPercentile
+	// percentile of run durations reaches this many milliseconds. Like the error percentage, it is only
+	// checked once the volume threshold is met. LatencyPercentile defaults to DefaultLatencyPercentile.
+	// 0 disables it.
+	LatencyThreshold  int     `json:"latency_threshold"`
+	LatencyPercentile float64 `json:"latency_percentile"`
+	// AdaptiveTimeout replaces the fixed timeout of each execution with the AdaptiveTimeoutPercentile
+	// percentile of the run durations of recent successes plus AdaptiveTimeoutMargin milliseconds, no
+	// shorter than MinTimeout milliseconds. Timeout is then the longest it may be, and is used until a
+	// success has been timed. AdaptiveTimeoutPercentile defaults to DefaultAdaptiveTimeoutPercentile. The
+	// percentile is recalculated at most once a second. Failures aren't timed, and neither are runs cut
+	// short by the timeout, so the percentile never sees runs slower than the timeout in force: set
+	// MinTimeout and the margin to leave room for the latency to rise.
+	AdaptiveTimeout           bool    `json:"adaptive_timeout"`
+	AdaptiveTimeoutPercentile float64 `json:"adaptive_timeout_percentile"`
+	AdaptiveTimeoutMargin     int     `json:"adaptive_timeout_margin"`
+	MinTimeout                int     `json:"min_timeout"`
+	// MaxConcurrentFallbacks is how many fallbacks of the command may run at a time, so that when the
+	// circuit opens an expensive fallback doesn't overwhelm what it depends on in turn. Executions whose
+	// fallback would exceed it fail with ErrFallbackRejected. 0 leaves fallbacks unlimited.
+	MaxConcurrentFallbacks int `json:"max_concurrent_fallbacks"`
+	// SleepWindowMultiplier grows the sleep window of an open circuit each time a test request fails, so
+	// that a backend which stays down is probed less and less often. The window is multiplied by it, up
+	// to MaxSleepWindow milliseconds, and returns to SleepWindow once the circuit closes. 0 or 1 keep the
+	// sleep window constant.
+	SleepWindowMultiplier float64 `json:"sleep_window_multiplier"`
+	MaxSleepWindow        int     `json:"max_sleep_window"`
+	// CancelOnTimeout cancels the context passed to run when the command times out, so that a run which
+	// watches its context stops and releases what it holds instead of carrying on unobserved. Runs which
+	// ignore their context, including those of Do and Go, can't be stopped and still run to completion.
+	CancelOnTimeout bool `json:"cancel_on_timeout"`
+	// Group tags the command as one of a group of commands, such as those calling the same service, which
+	// the dashboard shows together and GroupMetrics adds up. It defaults to the name of the command.
+	Group string `json:"group"`
 }
 
 var circuitSettings map[string]*Settings
 var settingsMutex *sync.RWMutex
-var log logger
+var log Logger
+
+// defaultConfig is applied to commands which have not been configured, which are tracked in
+// implicitSettings so that they can follow changes to it. Both are guarded by settingsMutex.
+var defaultConfig CommandConfig
+var implicitSettings map[string]bool
 
 func init() {
 	circuitSettings = make(map[string]*Settings)
+	implicitSettings = make(map[string]bool)
 	settingsMutex = &sync.RWMutex{}
 	log = DefaultLogger
 }
 
-// Configure applies settings for a set of circuits
-func Configure(cmds map[string]CommandConfig) {
+// Configure applies settings for a set of circuits. If any config is invalid, an error is
+// returned and no settings are applied.
+func Configure(cmds map[string]CommandConfig) error {
+	for k, v := range cmds {
+		if err := validateConfig(k, v); err != nil {
+			return err
+		}
+	}
+
 	for k, v := range cmds {
 		ConfigureCommand(k, v)
 	}
+	return nil
+}
+
+// ConfigureCommand applies settings for a circuit. If the circuit already exists, its executor pool
+// is resized to the new MaxConcurrentRequests without interrupting running commands, unless the pool
+// is shared through PoolName. Changing the rolling window of an existing circuit resets its metrics.
+//
+// An error is returned, and no settings are applied, if any value is out of range.
+func ConfigureCommand(name string, config CommandConfig) error {
+	if err := validateConfig(name, config); err != nil {
+		return err
+	}
+
+	name = resolveAlias(name)
+	settings := storeSettings(name, config)
+	log.Debug("applied command config", "circuit", name, "timeout", settings.Timeout, "max_concurrent_requests", settings.MaxConcurrentRequests)
+
+	// The circuit lock is taken before the settings lock when circuits are created,
+	// so it must not be taken while holding the settings lock here.
+	circuitBreakersMutex.RLock()
+	cb, ok := circuitBreakers[name]
+	circuitBreakersMutex.RUnlock()
+	if ok {
+		resizePool(cb, settings)
+		cb.metrics.configureWindow(settings)
+	}
+	return nil
+}
+
+// SetDefaultConfig sets the config of every command which has not been configured with Configure or
+// ConfigureCommand, including those already running. Zero fields of config take the package defaults,
+// such as DefaultTimeout. Commands configured explicitly keep their own config.
+//
+// An error is returned, and the default is left unchanged, if any value is out of range.
+func SetDefaultConfig(config CommandConfig) error {
+	if err := validateConfig("default", config); err != nil {
+		return err
+	}
+
+	settingsMutex.Lock()
+	defaultConfig = config
+	updated := make(map[string]*Settings, len(implicitSettings))
+	for name := range implicitSettings {
+		updated[name] = newSettings(config)
+		circuitSettings[name] = updated[name]
+	}
+	settingsMutex.Unlock()
+
+	circuitBreakersMutex.RLock()
+	defer circuitBreakersMutex.RUnlock()
+	for name, settings := range updated {
+		if cb, ok := circuitBreakers[name]; ok {
+			resizePool(cb, settings)
+			cb.metrics.configureWindow(settings)
+		}
+	}
+	return nil
+}
+
+// resizePool applies the MaxConcurrentRequests of settings to the executor pool of cb, unless the pool
+// is shared with other commands, which would otherwise all be resized by whichever was configured last.
+func resizePool(cb *CircuitBreaker, settings *Settings) {
+	if cb.executorPool.shared {
+		return
+	}
+	cb.executorPool.resize(settings.MaxConcurrentRequests)
+}
+
+func validateConfig(name string, config CommandConfig) error {
+	if config.Timeout < 0 && config.Timeout != NoTimeout {
+		return fmt.Errorf("hystrix: invalid config for %q: timeout %d must not be negative unless it is NoTimeout", name, config.Timeout)
+	}
+	if config.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: max concurrent requests %d must not be negative", name, config.MaxConcurrentRequests)
+	}
+	if config.RequestVolumeThreshold < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: request volume threshold %d must not be negative", name, config.RequestVolumeThreshold)
+	}
+	if config.SleepWindow < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: sleep window %d must not be negative", name, config.SleepWindow)
+	}
+	if config.SleepWindowJitter < 0 || config.SleepWindowJitter > 100 {
+		return fmt.Errorf("hystrix: invalid config for %q: sleep window jitter %d must be between 0 and 100", name, config.SleepWindowJitter)
+	}
+	if config.ConsecutiveFailureThreshold < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: consecutive failure threshold %d must not be negative", name, config.ConsecutiveFailureThreshold)
+	}
+	if config.SleepWindowMultiplier != 0 && config.SleepWindowMultiplier < 1 {
+		return fmt.Errorf("hystrix: invalid config for %q: sleep window multiplier %v must be at least 1", name, config.SleepWindowMultiplier)
+	}
+	if config.MaxSleepWindow < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: max sleep window %d must not be negative", name, config.MaxSleepWindow)
+	}
+	if config.MaxConcurrentFallbacks < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: max concurrent fallbacks %d must not be negative", name, config.MaxConcurrentFallbacks)
+	}
+	if config.MaxQueueSize < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: max queue size %d must not be negative", name, config.MaxQueueSize)
+	}
+	if config.QueueTimeout < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: queue timeout %d must not be negative", name, config.QueueTimeout)
+	}
+	if config.MaxRetries < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: max retries %d must not be negative", name, config.MaxRetries)
+	}
+	if config.RetryBackoff < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: retry backoff %d must not be negative", name, config.RetryBackoff)
+	}
+	if config.LatencyThreshold < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: latency threshold %d must not be negative", name, config.LatencyThreshold)
+	}
+	if config.LatencyPercentile < 0 || config.LatencyPercentile > 100 {
+		return fmt.Errorf("hystrix: invalid config for %q: latency percentile %v must be between 0 and 100", name, config.LatencyPercentile)
+	}
+	if config.AdaptiveTimeoutPercentile < 0 || config.AdaptiveTimeoutPercentile > 100 {
+		return fmt.Errorf("hystrix: invalid config for %q: adaptive timeout percentile %v must be between 0 and 100", name, config.AdaptiveTimeoutPercentile)
+	}
+	if config.AdaptiveTimeoutMargin < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: adaptive timeout margin %d must not be negative", name, config.AdaptiveTimeoutMargin)
+	}
+	if config.MinTimeout < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: min timeout %d must not be negative", name, config.MinTimeout)
+	}
+	if config.MinTimeout > 0 && config.Timeout > 0 && config.MinTimeout > config.Timeout {
+		return fmt.Errorf("hystrix: invalid config for %q: min timeout %d must not exceed timeout %d", name, config.MinTimeout, config.Timeout)
+	}
+	if config.RequestVolumePerSecond < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: request volume per second %d must not be negative", name, config.RequestVolumePerSecond)
+	}
+	if config.HalfOpenMaxRequests < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: half-open max requests %d must not be negative", name, config.HalfOpenMaxRequests)
+	}
+	if config.HalfOpenSuccessThreshold < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: half-open success threshold %d must not be negative", name, config.HalfOpenSuccessThreshold)
+	}
+	if config.RollingWindow < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: rolling window %d must not be negative", name, config.RollingWindow)
+	}
+	if config.RollingBuckets < 0 {
+		return fmt.Errorf("hystrix: invalid config for %q: rolling buckets %d must not be negative", name, config.RollingBuckets)
+	}
+	window, buckets := rollingWindow(config)
+	if buckets > window {
+		return fmt.Errorf("hystrix: invalid config for %q: rolling window of %dms is too short for %d buckets", name, window, buckets)
+	}
+	if config.ErrorPercentThreshold < 0 || config.ErrorPercentThreshold > 100 {
+		return fmt.Errorf("hystrix: invalid config for %q: error percent threshold %d must be between 0 and 100", name, config.ErrorPercentThreshold)
+	}
+	return nil
+}
+
+func storeSettings(name string, config CommandConfig) *Settings {
+	settings := newSettings(config)
+
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
+	circuitSettings[name] = settings
+	delete(implicitSettings, name)
+	return settings
 }
 
-// ConfigureCommand applies settings for a circuit
-func ConfigureCommand(name string, config CommandConfig) {
+// storeDefaultSettings stores the settings of the default config for name, unless it has been
+// configured in the meantime.
+func storeDefaultSettings(name string) *Settings {
 	settingsMutex.Lock()
 	defer settingsMutex.Unlock()
 
+	if settings, ok := circuitSettings[name]; ok {
+		return settings
+	}
+
+	settings := newSettings(defaultConfig)
+	circuitSettings[name] = settings
+	implicitSettings[name] = true
+	return settings
+}
+
+// newSettings returns the settings for config, applying the package defaults to its zero fields.
+func newSettings(config CommandConfig) *Settings {
 	timeout := DefaultTimeout
 	if config.Timeout != 0 {
 		timeout = config.Timeout
@@ -79,33 +413,207 @@ func ConfigureCommand(name string, config CommandConfig) {
 		sleep = config.SleepWindow
 	}
 
+	maxSleep := DefaultMaxSleepWindow
+	if config.MaxSleepWindow != 0 {
+		maxSleep = config.MaxSleepWindow
+	}
+
 	errorPercent := DefaultErrorPercentThreshold
 	if config.ErrorPercentThreshold != 0 {
 		errorPercent = config.ErrorPercentThreshold
 	}
 
-	circuitSettings[name] = &Settings{
-		Timeout:                time.Duration(timeout) * time.Millisecond,
-		MaxConcurrentRequests:  max,
-		RequestVolumeThreshold: uint64(volume),
-		SleepWindow:            time.Duration(sleep) * time.Millisecond,
-		ErrorPercentThreshold:  errorPercent,
+	halfOpen := DefaultHalfOpenMaxRequests
+	if config.HalfOpenMaxRequests != 0 {
+		halfOpen = config.HalfOpenMaxRequests
+	}
+
+	halfOpenSuccesses := halfOpen
+	if config.HalfOpenSuccessThreshold != 0 {
+		halfOpenSuccesses = config.HalfOpenSuccessThreshold
+	}
+
+	latencyPercentile := DefaultLatencyPercentile
+	if config.LatencyPercentile != 0 {
+		latencyPercentile = config.LatencyPercentile
 	}
+
+	adaptivePercentile := DefaultAdaptiveTimeoutPercentile
+	if config.AdaptiveTimeoutPercentile != 0 {
+		adaptivePercentile = config.AdaptiveTimeoutPercentile
+	}
+
+	window, buckets := rollingWindow(config)
+
+	settings := &Settings{
+		Timeout:                     timeoutDuration(timeout),
+		MaxConcurrentRequests:       max,
+		RequestVolumeThreshold:      uint64(volume),
+		SleepWindow:                 time.Duration(sleep) * time.Millisecond,
+		ErrorPercentThreshold:       errorPercent,
+		IsErrorIgnorable:            config.IsErrorIgnorable,
+		ErrorEvent:                  config.ErrorEvent,
+		PropagatePanics:             config.PropagatePanics,
+		MaxQueueSize:                config.MaxQueueSize,
+		QueueTimeout:                time.Duration(config.QueueTimeout) * time.Millisecond,
+		RollingWindow:               time.Duration(window) * time.Millisecond,
+		RollingBuckets:              buckets,
+		RequestVolumePerSecond:      config.RequestVolumePerSecond,
+		PoolName:                    config.PoolName,
+		HalfOpenMaxRequests:         halfOpen,
+		HalfOpenSuccessThreshold:    halfOpenSuccesses,
+		SleepWindowJitter:           config.SleepWindowJitter,
+		ConsecutiveFailureThreshold: config.ConsecutiveFailureThreshold,
+		MonitorOnly:                 config.MonitorOnly,
+		MetricsNamespace:            config.MetricsNamespace,
+		MaxRetries:                  config.MaxRetries,
+		RetryBackoff:                time.Duration(config.RetryBackoff) * time.Millisecond,
+		LatencyThreshold:            time.Duration(config.LatencyThreshold) * time.Millisecond,
+		LatencyPercentile:           latencyPercentile,
+		AdaptiveTimeout:             config.AdaptiveTimeout,
+		AdaptiveTimeoutPercentile:   adaptivePercentile,
+		AdaptiveTimeoutMargin:       time.Duration(config.AdaptiveTimeoutMargin) * time.Millisecond,
+		MinTimeout:                  time.Duration(config.MinTimeout) * time.Millisecond,
+		MaxConcurrentFallbacks:      config.MaxConcurrentFallbacks,
+		SleepWindowMultiplier:       config.SleepWindowMultiplier,
+		MaxSleepWindow:              time.Duration(maxSleep) * time.Millisecond,
+		CancelOnTimeout:             config.CancelOnTimeout,
+		Group:                       config.Group,
+	}
+
+	return settings
+}
+
+// overrideSettings returns a copy of the settings registered for name with any non-zero fields
+// of config applied. Settings which govern the shared executor pool or circuit state are not applied.
+func overrideSettings(name string, config CommandConfig) *Settings {
+	s := *getSettings(name)
+
+	if config.Timeout != 0 {
+		s.Timeout = timeoutDuration(config.Timeout)
+	}
+	if config.IsErrorIgnorable != nil {
+		s.IsErrorIgnorable = config.IsErrorIgnorable
+	}
+	if config.ErrorEvent != nil {
+		s.ErrorEvent = config.ErrorEvent
+	}
+	if config.PropagatePanics {
+		s.PropagatePanics = true
+	}
+	if config.CancelOnTimeout {
+		s.CancelOnTimeout = true
+	}
+	if config.MaxQueueSize != 0 {
+		s.MaxQueueSize = config.MaxQueueSize
+	}
+	if config.QueueTimeout != 0 {
+		s.QueueTimeout = time.Duration(config.QueueTimeout) * time.Millisecond
+	}
+	if config.MaxRetries != 0 {
+		s.MaxRetries = config.MaxRetries
+	}
+	if config.RetryBackoff != 0 {
+		s.RetryBackoff = time.Duration(config.RetryBackoff) * time.Millisecond
+	}
+
+	return &s
+}
+
+// rollingWindow returns the rolling window, in milliseconds, and bucket count for config, applying defaults.
+func rollingWindow(config CommandConfig) (int, int) {
+	window := DefaultRollingWindow
+	if config.RollingWindow != 0 {
+		window = config.RollingWindow
+	}
+
+	buckets := DefaultRollingBuckets
+	if config.RollingBuckets != 0 {
+		buckets = config.RollingBuckets
+	}
+
+	return window, buckets
+}
+
+// timeoutDuration converts a configured timeout in milliseconds into the duration held by Settings,
+// where NoTimeout is represented by zero.
+func timeoutDuration(timeout int) time.Duration {
+	if timeout == NoTimeout {
+		return 0
+	}
+	return time.Duration(timeout) * time.Millisecond
 }
 
 func getSettings(name string) *Settings {
+	name = resolveAlias(name)
 	settingsMutex.RLock()
 	s, exists := circuitSettings[name]
 	settingsMutex.RUnlock()
 
 	if !exists {
-		ConfigureCommand(name, CommandConfig{})
-		s = getSettings(name)
+		s = storeDefaultSettings(name)
 	}
 
 	return s
 }
 
+// GetConfig returns the effective config for a command, including any defaults which were applied.
+func GetConfig(name string) CommandConfig {
+	s := getSettings(name)
+
+	timeout := int(s.Timeout / time.Millisecond)
+	if s.Timeout == 0 {
+		timeout = NoTimeout
+	}
+
+	return CommandConfig{
+		Timeout:                     timeout,
+		MaxConcurrentRequests:       s.MaxConcurrentRequests,
+		RequestVolumeThreshold:      int(s.RequestVolumeThreshold),
+		SleepWindow:                 int(s.SleepWindow / time.Millisecond),
+		ErrorPercentThreshold:       s.ErrorPercentThreshold,
+		IsErrorIgnorable:            s.IsErrorIgnorable,
+		ErrorEvent:                  s.ErrorEvent,
+		PropagatePanics:             s.PropagatePanics,
+		MaxQueueSize:                s.MaxQueueSize,
+		QueueTimeout:                int(s.QueueTimeout / time.Millisecond),
+		RollingWindow:               int(s.RollingWindow / time.Millisecond),
+		RollingBuckets:              s.RollingBuckets,
+		RequestVolumePerSecond:      s.RequestVolumePerSecond,
+		PoolName:                    s.PoolName,
+		HalfOpenMaxRequests:         s.HalfOpenMaxRequests,
+		HalfOpenSuccessThreshold:    s.HalfOpenSuccessThreshold,
+		SleepWindowJitter:           s.SleepWindowJitter,
+		ConsecutiveFailureThreshold: s.ConsecutiveFailureThreshold,
+		MonitorOnly:                 s.MonitorOnly,
+		MetricsNamespace:            s.MetricsNamespace,
+		MaxRetries:                  s.MaxRetries,
+		RetryBackoff:                int(s.RetryBackoff / time.Millisecond),
+		LatencyThreshold:            int(s.LatencyThreshold / time.Millisecond),
+		LatencyPercentile:           s.LatencyPercentile,
+		AdaptiveTimeout:             s.AdaptiveTimeout,
+		AdaptiveTimeoutPercentile:   s.AdaptiveTimeoutPercentile,
+		AdaptiveTimeoutMargin:       int(s.AdaptiveTimeoutMargin / time.Millisecond),
+		MinTimeout:                  int(s.MinTimeout / time.Millisecond),
+		MaxConcurrentFallbacks:      s.MaxConcurrentFallbacks,
+		SleepWindowMultiplier:       s.SleepWindowMultiplier,
+		MaxSleepWindow:              int(s.MaxSleepWindow / time.Millisecond),
+		CancelOnTimeout:             s.CancelOnTimeout,
+		Group:                       s.Group,
+	}
+}
+
+// IsConfigured reports whether name has been configured with Configure or ConfigureCommand. Commands
+// which only run with the default config are not, so tests can catch a misspelt command name.
+func IsConfigured(name string) bool {
+	name = resolveAlias(name)
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+
+	_, exists := circuitSettings[name]
+	return exists && !implicitSettings[name]
+}
+
 func GetCircuitSettings() map[string]*Settings {
 	copy := make(map[string]*Settings)
 
@@ -118,7 +626,17 @@ func GetCircuitSettings() map[string]*Settings {
 	return copy
 }
 
-// SetLogger configures the logger that will be used. This only applies to the hystrix package.
+// SetLogger configures a Printf-style logger that will be used. This only applies to the hystrix package.
+// Messages of every level are written to it.
 func SetLogger(l logger) {
+	if structured, ok := l.(Logger); ok {
+		log = structured
+		return
+	}
+	log = printfLogger{l}
+}
+
+// SetStructuredLogger configures a leveled logger that will be used. This only applies to the hystrix package.
+func SetStructuredLogger(l Logger) {
 	log = l
 }
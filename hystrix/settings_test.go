@@ -57,3 +57,172 @@ func TestGetCircuitSettings(t *testing.T) {
 		})
 	})
 }
+
+func TestOverrideSettings(t *testing.T) {
+	Convey("given a command configured for a 10000 millisecond timeout and 30 concurrent requests", t, func() {
+		ConfigureCommand("override", CommandConfig{Timeout: 10000, MaxConcurrentRequests: 30})
+
+		Convey("overriding the timeout, concurrency and circuit thresholds", func() {
+			s := overrideSettings("override", CommandConfig{
+				Timeout:                100,
+				MaxConcurrentRequests:  100,
+				RequestVolumeThreshold: 1,
+				SleepWindow:            1,
+				ErrorPercentThreshold:  1,
+			})
+
+			Convey("only the timeout should be applied", func() {
+				So(s.Timeout, ShouldEqual, time.Duration(100*time.Millisecond))
+				So(s.MaxConcurrentRequests, ShouldEqual, 30)
+				So(s.RequestVolumeThreshold, ShouldEqual, DefaultVolumeThreshold)
+				So(s.SleepWindow, ShouldEqual, time.Duration(DefaultSleepWindow)*time.Millisecond)
+				So(s.ErrorPercentThreshold, ShouldEqual, DefaultErrorPercentThreshold)
+			})
+
+			Convey("the registered settings should be unchanged", func() {
+				So(getSettings("override").Timeout, ShouldEqual, time.Duration(10*time.Second))
+			})
+		})
+	})
+}
+
+func TestConfigureValidation(t *testing.T) {
+	Convey("given an invalid config", t, func() {
+		ConfigureCommand("invalid", CommandConfig{Timeout: 100})
+
+		Convey("a negative timeout should be rejected", func() {
+			So(ConfigureCommand("invalid", CommandConfig{Timeout: -2}), ShouldNotBeNil)
+			So(getSettings("invalid").Timeout, ShouldEqual, time.Duration(100*time.Millisecond))
+		})
+
+		Convey("an error percent threshold over 100 should be rejected", func() {
+			So(ConfigureCommand("invalid", CommandConfig{ErrorPercentThreshold: 500}), ShouldNotBeNil)
+		})
+
+		Convey("a negative volume threshold should be rejected", func() {
+			So(ConfigureCommand("invalid", CommandConfig{RequestVolumeThreshold: -1}), ShouldNotBeNil)
+		})
+
+		Convey("a negative max concurrency should be rejected", func() {
+			So(ConfigureCommand("invalid", CommandConfig{MaxConcurrentRequests: -1}), ShouldNotBeNil)
+		})
+
+		Convey("a rolling window shorter than a millisecond per bucket should be rejected", func() {
+			So(ConfigureCommand("invalid", CommandConfig{RollingWindow: 5, RollingBuckets: 10}), ShouldNotBeNil)
+			So(ConfigureCommand("invalid", CommandConfig{RollingBuckets: 20000}), ShouldNotBeNil)
+		})
+
+		Convey("Configure should apply none of the given configs", func() {
+			err := Configure(map[string]CommandConfig{
+				"invalid":       {Timeout: 200},
+				"invalid-other": {SleepWindow: -1},
+			})
+			So(err, ShouldNotBeNil)
+			So(getSettings("invalid").Timeout, ShouldEqual, time.Duration(100*time.Millisecond))
+		})
+	})
+}
+
+func TestGetConfig(t *testing.T) {
+	Convey("given a command configured with only a timeout", t, func() {
+		So(ConfigureCommand("get-config", CommandConfig{Timeout: 250}), ShouldBeNil)
+
+		Convey("the config should report the timeout and the defaults", func() {
+			config := GetConfig("get-config")
+			So(config.Timeout, ShouldEqual, 250)
+			So(config.MaxConcurrentRequests, ShouldEqual, DefaultMaxConcurrent)
+			So(config.RequestVolumeThreshold, ShouldEqual, DefaultVolumeThreshold)
+			So(config.SleepWindow, ShouldEqual, DefaultSleepWindow)
+			So(config.ErrorPercentThreshold, ShouldEqual, DefaultErrorPercentThreshold)
+			So(config.HalfOpenMaxRequests, ShouldEqual, DefaultHalfOpenMaxRequests)
+			So(config.HalfOpenSuccessThreshold, ShouldEqual, DefaultHalfOpenMaxRequests)
+		})
+	})
+
+	Convey("given a command configured with no timeout", t, func() {
+		So(ConfigureCommand("get-config-no-timeout", CommandConfig{Timeout: NoTimeout}), ShouldBeNil)
+
+		Convey("the stored timeout should be zero", func() {
+			So(getSettings("get-config-no-timeout").Timeout, ShouldEqual, time.Duration(0))
+		})
+
+		Convey("the config should report NoTimeout", func() {
+			So(GetConfig("get-config-no-timeout").Timeout, ShouldEqual, NoTimeout)
+		})
+	})
+}
+
+func TestRollingWindow(t *testing.T) {
+	Convey("given a command with the default rolling window", t, func() {
+		defer Flush()
+
+		ConfigureCommand("window", CommandConfig{})
+		cb, _, _ := GetCircuit("window")
+
+		Convey("its metrics are kept in 10 one second buckets", func() {
+			So(getSettings("window").RollingWindow, ShouldEqual, 10*time.Second)
+			So(cb.metrics.DefaultCollector().Window(), ShouldEqual, 10*time.Second)
+			So(cb.metrics.DefaultCollector().Buckets(), ShouldEqual, 10)
+		})
+
+		Convey("reconfiguring it with a 60 second window applies to its metrics", func() {
+			So(ConfigureCommand("window", CommandConfig{RollingWindow: 60000, RollingBuckets: 60}), ShouldBeNil)
+			So(cb.metrics.DefaultCollector().Window(), ShouldEqual, 60*time.Second)
+			So(cb.metrics.DefaultCollector().Buckets(), ShouldEqual, 60)
+			So(GetConfig("window").RollingWindow, ShouldEqual, 60000)
+		})
+	})
+}
+
+func TestSetDefaultConfig(t *testing.T) {
+	Convey("given a default config with a 500 millisecond timeout", t, func() {
+		defer Flush()
+		defer SetDefaultConfig(CommandConfig{})
+
+		ConfigureCommand("default-explicit", CommandConfig{MaxConcurrentRequests: 3})
+		GetCircuit("default-early")
+		So(SetDefaultConfig(CommandConfig{Timeout: 500, MaxConcurrentRequests: 20}), ShouldBeNil)
+
+		Convey("commands which were never configured use it", func() {
+			So(GetConfig("default-unknown").Timeout, ShouldEqual, 500)
+			So(GetConfig("default-unknown").MaxConcurrentRequests, ShouldEqual, 20)
+			So(GetConfig("default-unknown").SleepWindow, ShouldEqual, DefaultSleepWindow)
+		})
+
+		Convey("commands which were already running pick it up", func() {
+			So(GetConfig("default-early").Timeout, ShouldEqual, 500)
+			max, _ := MaxConcurrency("default-early")
+			So(max, ShouldEqual, 20)
+		})
+
+		Convey("commands configured explicitly keep their own config", func() {
+			So(GetConfig("default-explicit").Timeout, ShouldEqual, DefaultTimeout)
+			So(GetConfig("default-explicit").MaxConcurrentRequests, ShouldEqual, 3)
+
+			ConfigureCommand("default-configured", CommandConfig{})
+			So(GetConfig("default-configured").Timeout, ShouldEqual, DefaultTimeout)
+		})
+
+		Convey("an invalid default is rejected", func() {
+			So(SetDefaultConfig(CommandConfig{Timeout: -5}), ShouldNotBeNil)
+			So(GetConfig("default-unknown").Timeout, ShouldEqual, 500)
+		})
+	})
+}
+
+func TestIsConfigured(t *testing.T) {
+	Convey("given a configured command", t, func() {
+		defer Flush()
+
+		ConfigureCommand("payments", CommandConfig{Timeout: 100})
+
+		Convey("it is configured", func() {
+			So(IsConfigured("payments"), ShouldBeTrue)
+		})
+
+		Convey("a misspelt name which has run with the defaults is not", func() {
+			Do("paymnets", func() error { return nil }, nil)
+			So(IsConfigured("paymnets"), ShouldBeFalse)
+		})
+	})
+}
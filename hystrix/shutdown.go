@@ -0,0 +1,63 @@
+package hystrix
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// shuttingDown is set once Shutdown has been called, until Flush.
+var shuttingDown int32
+
+// inFlight counts the commands which have been executed and have not reported their outcome yet,
+// including those waiting for a ticket and those running their fallback.
+var inFlight int64
+
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Shutdown stops accepting new commands and waits for the commands which are already running to finish.
+// Commands executed after Shutdown is called fail with ErrShuttingDown, which is passed to their fallback.
+// A command has finished once its outcome is reported, so Shutdown also waits for commands queued for
+// a ticket and for fallbacks. Flush lets commands run again.
+//
+// Once every command has finished, or ctx is done, the goroutines collecting metrics for each circuit
+// record what has been reported to them and are stopped. If ctx is done first, its error is returned.
+func Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&shuttingDown, 1)
+	defer stopMetrics()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(&inFlight) > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func isShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+// beginCommand counts a command as in flight. It must be called before the command checks
+// isShuttingDown, so that Shutdown either turns the command away or waits for it.
+func beginCommand() {
+	atomic.AddInt64(&inFlight, 1)
+}
+
+// endCommand counts a command as finished once its outcome has been reported.
+func endCommand() {
+	atomic.AddInt64(&inFlight, -1)
+}
+
+func stopMetrics() {
+	for _, cb := range circuitsWhere(nil) {
+		cb.metrics.flush()
+		cb.stopMetrics()
+	}
+}
@@ -0,0 +1,125 @@
+package hystrix
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestShutdown(t *testing.T) {
+	Convey("with a running command", t, func() {
+		defer Flush()
+
+		finished := make(chan bool, 1)
+		Go("shutdown", func() error {
+			time.Sleep(50 * time.Millisecond)
+			finished <- true
+			return nil
+		}, nil)
+		time.Sleep(10 * time.Millisecond)
+
+		Convey("Shutdown waits for it to finish", func() {
+			So(Shutdown(context.Background()), ShouldBeNil)
+			So(len(finished), ShouldEqual, 1)
+
+			cb, _, _ := GetCircuit("shutdown")
+			So(cb.executorPool.ActiveCount(), ShouldEqual, 0)
+		})
+
+		Convey("Shutdown gives up once the context is done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			So(Shutdown(ctx), ShouldResemble, context.DeadlineExceeded)
+			So(len(finished), ShouldEqual, 0)
+		})
+
+		Convey("new commands are passed ErrShuttingDown", func() {
+			shutdown := make(chan error, 1)
+			go func() { shutdown <- Shutdown(context.Background()) }()
+			defer func() { <-shutdown }()
+			time.Sleep(5 * time.Millisecond)
+
+			var fallbackErr error
+			err := Do("shutdown", func() error {
+				return nil
+			}, func(err error) error {
+				fallbackErr = err
+				return err
+			})
+			So(errors.Is(fallbackErr, ErrShuttingDown), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, ErrShuttingDown.Error())
+		})
+	})
+
+	Convey("with a command queued for a ticket and a fallback running", t, func() {
+		defer Flush()
+
+		ConfigureCommand("shutdown-queued", CommandConfig{MaxConcurrentRequests: 1, MaxQueueSize: 1, QueueTimeout: 1000})
+		releaseRun := make(chan struct{})
+		releaseFallback := make(chan struct{})
+		running := make(chan struct{})
+		done := make(chan error, 3)
+		go func() {
+			done <- Do("shutdown-queued", func() error {
+				close(running)
+				<-releaseRun
+				return nil
+			}, nil)
+		}()
+		<-running
+		go func() {
+			done <- Do("shutdown-queued", func() error { return nil }, nil)
+		}()
+
+		falling := make(chan struct{})
+		go func() {
+			done <- Do("shutdown-fallback", func() error {
+				return errors.New("boom")
+			}, func(err error) error {
+				close(falling)
+				<-releaseFallback
+				return nil
+			})
+		}()
+		<-falling
+		cb, _, _ := GetCircuit("shutdown-queued")
+		for cb.executorPool.queueLength() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		Convey("Shutdown waits for both and records their outcomes", func() {
+			shutdown := make(chan error, 1)
+			go func() { shutdown <- Shutdown(context.Background()) }()
+
+			time.Sleep(3 * shutdownPollInterval)
+			So(len(shutdown), ShouldEqual, 0)
+
+			// no command holds a ticket once these two have finished, but the fallback is still running
+			close(releaseRun)
+			<-done
+			<-done
+			time.Sleep(3 * shutdownPollInterval)
+			So(len(shutdown), ShouldEqual, 0)
+
+			close(releaseFallback)
+			So(<-shutdown, ShouldBeNil)
+			So(<-done, ShouldBeNil)
+
+			snapshot, _ := Metrics("shutdown-queued")
+			So(snapshot.Successes, ShouldEqual, 2)
+			snapshot, _ = Metrics("shutdown-fallback")
+			So(snapshot.FallbackSuccesses, ShouldEqual, 1)
+		})
+	})
+
+	Convey("after Shutdown, Flush lets commands run again", t, func() {
+		So(Shutdown(context.Background()), ShouldBeNil)
+		Flush()
+		So(Do("shutdown-flushed", func() error { return nil }, nil), ShouldBeNil)
+		Flush()
+	})
+}
@@ -0,0 +1,155 @@
+package hystrix
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix/rolling"
+)
+
+// NewSnapshotHandler returns a server which responds to each GET with the current metrics of every circuit
+// as a single JSON document. It reports the same data as the StreamHandler, for clients which would rather
+// poll than hold a stream open.
+func NewSnapshotHandler() *SnapshotHandler {
+	return &SnapshotHandler{}
+}
+
+// SnapshotHandler serves a one-shot JSON document of the metrics for all circuits.
+type SnapshotHandler struct{}
+
+var _ http.Handler = (*SnapshotHandler)(nil)
+
+func (sh *SnapshotHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		rw.Header().Set("Allow", http.MethodGet)
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	eventBytes, err := json.Marshal(takeSnapshot())
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Write(eventBytes)
+}
+
+func takeSnapshot() *snapshotMetrics {
+	circuits := circuitsWhere(nil)
+	commands := make([]snapshotCmdMetric, 0, len(circuits))
+	for _, cb := range circuits {
+		commands = append(commands, snapshotCommand(cb))
+	}
+
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+
+	return &snapshotMetrics{
+		Time:     currentTime(),
+		Commands: commands,
+	}
+}
+
+func snapshotCommand(cb *CircuitBreaker) snapshotCmdMetric {
+	now := time.Now()
+	collector := cb.metrics.DefaultCollector()
+
+	return snapshotCmdMetric{
+		Name:              cb.Name,
+		Group:             getSettings(cb.Name).group(cb.Name),
+		Open:              cb.IsOpen(),
+		ErrorPct:          cb.metrics.ErrorPercent(now),
+		ActiveCount:       cb.executorPool.ActiveCount(),
+		MaxConcurrency:    cb.executorPool.size(),
+		MaxActiveRequests: cb.executorPool.Metrics.maxActiveRequests(now),
+
+		Requests:                collector.NumRequests().Sum(now),
+		Errors:                  collector.Errors().Sum(now),
+		Successes:               collector.Successes().Sum(now),
+		Failures:                collector.Failures().Sum(now),
+		Rejects:                 collector.Rejects().Sum(now),
+		ShortCircuits:           collector.ShortCircuits().Sum(now),
+		Timeouts:                collector.Timeouts().Sum(now),
+		FallbackSuccesses:       collector.FallbackSuccesses().Sum(now),
+		FallbackFailures:        collector.FallbackFailures().Sum(now),
+		ContextCanceled:         collector.ContextCanceled().Sum(now),
+		ContextDeadlineExceeded: collector.ContextDeadlineExceeded().Sum(now),
+		Queued:                  collector.Queued().Sum(now),
+		NoFallback:              collector.NoFallback().Sum(now),
+		Retries:                 collector.Retries().Sum(now),
+		FallbackDegraded:        collector.FallbackDegraded().Sum(now),
+		Blocked:                 collector.Blocked().Sum(now),
+		FallbackRejects:         collector.FallbackRejects().Sum(now),
+
+		LatencyExecute:   snapshotLatencyTimings(collector.RunDuration()),
+		LatencyTotal:     snapshotLatencyTimings(collector.TotalDuration()),
+		LatencyFallback:  snapshotLatencyTimings(collector.FallbackDuration()),
+		LatencyQueueWait: snapshotLatencyTimings(collector.QueueWaitDuration()),
+	}
+}
+
+func snapshotLatencyTimings(r *rolling.Timing) snapshotCmdLatency {
+	return snapshotCmdLatency{
+		Timing0:   r.Percentile(0),
+		Timing25:  r.Percentile(25),
+		Timing50:  r.Percentile(50),
+		Timing90:  r.Percentile(90),
+		Timing99:  r.Percentile(99),
+		Timing100: r.Percentile(100),
+	}
+}
+
+type snapshotMetrics struct {
+	Time     int64               `json:"current_time"`
+	Commands []snapshotCmdMetric `json:"commands"`
+}
+
+type snapshotCmdMetric struct {
+	Name              string `json:"name"`
+	Group             string `json:"group"`
+	Open              bool   `json:"open"`
+	ErrorPct          int    `json:"error_percentage"`
+	ActiveCount       int    `json:"concurrency_in_use"`
+	MaxConcurrency    int    `json:"max_concurrency"`
+	MaxActiveRequests int    `json:"max_active_requests"`
+
+	Requests                float64 `json:"requests"`
+	Errors                  float64 `json:"errors"`
+	Successes               float64 `json:"successes"`
+	Failures                float64 `json:"failures"`
+	Rejects                 float64 `json:"rejects"`
+	ShortCircuits           float64 `json:"short_circuits"`
+	Timeouts                float64 `json:"timeouts"`
+	FallbackSuccesses       float64 `json:"fallback_successes"`
+	FallbackFailures        float64 `json:"fallback_failures"`
+	ContextCanceled         float64 `json:"context_canceled"`
+	ContextDeadlineExceeded float64 `json:"context_deadline_exceeded"`
+	Queued                  float64 `json:"queued"`
+	NoFallback              float64 `json:"no_fallback"`
+	Retries                 float64 `json:"retries"`
+	FallbackDegraded        float64 `json:"fallback_degraded"`
+	Blocked                 float64 `json:"blocked"`
+	FallbackRejects         float64 `json:"fallback_rejects"`
+
+	// Latencies are in milliseconds.
+	LatencyExecute  snapshotCmdLatency `json:"latency_execute"`
+	LatencyTotal    snapshotCmdLatency `json:"latency_total"`
+	LatencyFallback snapshotCmdLatency `json:"latency_fallback"`
+	// LatencyQueueWait is how long executions waited for a ticket.
+	LatencyQueueWait snapshotCmdLatency `json:"latency_queue_wait"`
+}
+
+type snapshotCmdLatency struct {
+	Timing0   uint32 `json:"0"`
+	Timing25  uint32 `json:"25"`
+	Timing50  uint32 `json:"50"`
+	Timing90  uint32 `json:"90"`
+	Timing99  uint32 `json:"99"`
+	Timing100 uint32 `json:"100"`
+}
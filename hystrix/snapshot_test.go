@@ -0,0 +1,54 @@
+package hystrix
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSnapshotHandler(t *testing.T) {
+	Convey("given a snapshot server and a command which has run", t, func() {
+		defer Flush()
+
+		server := httptest.NewServer(NewSnapshotHandler())
+		defer server.Close()
+
+		sleepingCommand(t, "snapshot", 1*time.Millisecond)
+		failingCommand(t, "snapshot", 1*time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+
+		Convey("a GET returns the metrics of the command", func() {
+			res, err := http.Get(server.URL)
+			So(err, ShouldBeNil)
+			defer res.Body.Close()
+			So(res.StatusCode, ShouldEqual, http.StatusOK)
+			So(res.Header.Get("Content-Type"), ShouldEqual, "application/json")
+
+			var snapshot snapshotMetrics
+			So(json.NewDecoder(res.Body).Decode(&snapshot), ShouldBeNil)
+			So(snapshot.Commands, ShouldHaveLength, 1)
+
+			cmd := snapshot.Commands[0]
+			So(cmd.Name, ShouldEqual, "snapshot")
+			So(cmd.Group, ShouldEqual, "snapshot")
+			So(cmd.Requests, ShouldEqual, 2)
+			So(cmd.Successes, ShouldEqual, 1)
+			So(cmd.Failures, ShouldEqual, 1)
+			So(cmd.ErrorPct, ShouldEqual, 50)
+			So(cmd.Open, ShouldBeFalse)
+			So(cmd.MaxConcurrency, ShouldEqual, DefaultMaxConcurrent)
+			So(cmd.MaxActiveRequests, ShouldEqual, 1)
+		})
+
+		Convey("a POST is rejected", func() {
+			res, err := http.Post(server.URL, "application/json", nil)
+			So(err, ShouldBeNil)
+			res.Body.Close()
+			So(res.StatusCode, ShouldEqual, http.StatusMethodNotAllowed)
+		})
+	})
+}
@@ -0,0 +1,79 @@
+package hystrix
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A StoredState is the part of the state of a circuit kept in its StateStore.
+type StoredState struct {
+	// Open is true while the circuit is open, including while it is half-open.
+	Open bool
+	// OpenedOrLastTested is when the circuit opened, or when a test request last failed, which is when
+	// its sleep window started. It is the zero time while the circuit is closed.
+	OpenedOrLastTested time.Time
+}
+
+// A StateStore holds whether circuits are open and when their sleep windows started, so that the
+// decision can be shared by several processes, each executing the same commands. Only the open flag
+// and the sleep window are stored: the metrics, forced states and test requests of a circuit are still
+// tracked by each process.
+//
+// Load is called each time a command checks its circuit, and both methods are called while the lock of
+// the circuit is held, so a store backed by a remote service should answer from a local cache.
+type StateStore interface {
+	// Load returns the state stored for the named circuit, or the zero StoredState, a closed circuit,
+	// if there is none.
+	Load(name string) StoredState
+	// Save replaces the state stored for the named circuit.
+	Save(name string, state StoredState)
+}
+
+// stateStores gives every value stored in currentStateStore the same concrete type, as atomic.Value requires.
+type stateStores struct {
+	store StateStore
+}
+
+var currentStateStore atomic.Value
+
+func init() {
+	currentStateStore.Store(stateStores{})
+}
+
+// SetStateStore makes circuits created afterwards keep their state in store, replacing any previous
+// store. Passing nil restores the default, which keeps the state of each circuit in memory. Circuits
+// which already exist keep the store they were created with, so call it before executing any command.
+func SetStateStore(store StateStore) {
+	currentStateStore.Store(stateStores{store: store})
+}
+
+// stateStoreFor returns the store for a new circuit: the installed StateStore, or one in memory.
+func stateStoreFor() StateStore {
+	if store := currentStateStore.Load().(stateStores).store; store != nil {
+		return store
+	}
+	return &memoryStateStore{}
+}
+
+// memoryStateStore is the default StateStore. Each circuit has its own, so it is forgotten along
+// with the circuit by Flush.
+type memoryStateStore struct {
+	mu     sync.Mutex
+	states map[string]StoredState
+}
+
+func (m *memoryStateStore) Load(name string) StoredState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.states[name]
+}
+
+func (m *memoryStateStore) Save(name string, state StoredState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.states == nil {
+		m.states = make(map[string]StoredState)
+	}
+	m.states[name] = state
+}
@@ -0,0 +1,55 @@
+package hystrix
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStateStore(t *testing.T) {
+	Convey("with a state store shared by every circuit", t, func() {
+		defer Flush()
+		defer SetStateStore(nil)
+
+		store := &memoryStateStore{}
+		SetStateStore(store)
+		ConfigureCommand("stored", CommandConfig{RequestVolumeThreshold: 5, SleepWindow: 60000})
+
+		Convey("opening a circuit is saved to the store", func() {
+			for i := 0; i < 6; i++ {
+				Do("stored", func() error { return fmt.Errorf("boom") }, nil)
+			}
+			cb, _, _ := GetCircuit("stored")
+			cb.metrics.flush()
+			So(cb.IsOpen(), ShouldBeTrue)
+			So(store.Load("stored").Open, ShouldBeTrue)
+			So(store.Load("stored").OpenedOrLastTested.IsZero(), ShouldBeFalse)
+
+			Convey("and resetting it closes it in the store", func() {
+				So(ResetCircuit("stored"), ShouldBeNil)
+				So(store.Load("stored"), ShouldResemble, StoredState{})
+			})
+		})
+
+		Convey("a circuit opened elsewhere short-circuits here", func() {
+			store.Save("stored", StoredState{Open: true, OpenedOrLastTested: getClock().Now()})
+
+			err := Do("stored", func() error { return nil }, nil)
+			So(err.Error(), ShouldEqual, "hystrix: circuit open (command: stored)")
+
+			cb, _, _ := GetCircuit("stored")
+			So(cb.State(), ShouldEqual, CircuitOpen)
+		})
+	})
+
+	Convey("without a state store, each circuit keeps its own state", t, func() {
+		defer Flush()
+
+		cb, _, _ := GetCircuit("stored-default")
+		other, _, _ := GetCircuit("stored-default-other")
+		cb.setOpen(causeErrors)
+		So(other.State(), ShouldEqual, CircuitClosed)
+		So(cb.State(), ShouldEqual, CircuitOpen)
+	})
+}
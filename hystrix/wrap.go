@@ -0,0 +1,72 @@
+package hystrix
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// A RunWrapper decorates the run function of every command, for instance to trace it. name is the
+// name of the command.
+type RunWrapper func(name string, run func(context.Context) error) func(context.Context) error
+
+// A FallbackWrapper decorates the fallback of every command which has one. name is the name of the command.
+type FallbackWrapper func(name string, fallback func(context.Context, error) error) func(context.Context, error) error
+
+// wrappers gives every value stored in currentWrappers the same concrete type, as atomic.Value requires.
+type wrappers struct {
+	run      RunWrapper
+	fallback FallbackWrapper
+}
+
+// currentWrappers is read by every command without locking. wrappersMutex serializes the setters, so
+// that installing one wrapper doesn't undo another installed at the same time.
+var (
+	currentWrappers atomic.Value
+	wrappersMutex   sync.Mutex
+)
+
+func init() {
+	currentWrappers.Store(wrappers{})
+}
+
+// SetRunWrapper installs w around the run function of every command executed afterwards, replacing
+// any previous wrapper. Passing nil removes it.
+//
+// The wrapped function is what the command runs and times: the run duration includes w, and the
+// outcome is reported to the circuit's metrics only after it returns. A command which times out
+// reports its timeout without waiting for it.
+func SetRunWrapper(w RunWrapper) {
+	wrappersMutex.Lock()
+	defer wrappersMutex.Unlock()
+
+	current := currentWrappers.Load().(wrappers)
+	current.run = w
+	currentWrappers.Store(current)
+}
+
+// SetFallbackWrapper installs w around the fallback of every command executed afterwards, replacing
+// any previous wrapper. Passing nil removes it.
+//
+// As with the fallback itself, the outcome of the command is reported to the circuit's metrics
+// after the wrapped fallback returns.
+func SetFallbackWrapper(w FallbackWrapper) {
+	wrappersMutex.Lock()
+	defer wrappersMutex.Unlock()
+
+	current := currentWrappers.Load().(wrappers)
+	current.fallback = w
+	currentWrappers.Store(current)
+}
+
+// wrap applies the installed wrappers to the functions of a command.
+func wrap(name string, run runFuncC, fallback fallbackFuncC) (runFuncC, fallbackFuncC) {
+	current := currentWrappers.Load().(wrappers)
+	if current.run != nil {
+		run = current.run(name, run)
+	}
+	if current.fallback != nil && fallback != nil {
+		fallback = current.fallback(name, fallback)
+	}
+	return run, fallback
+}
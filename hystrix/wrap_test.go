@@ -0,0 +1,86 @@
+package hystrix
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWrappers(t *testing.T) {
+	Convey("with run and fallback wrappers installed", t, func() {
+		defer Flush()
+		defer SetRunWrapper(nil)
+		defer SetFallbackWrapper(nil)
+
+		var mu sync.Mutex
+		var calls []string
+		record := func(call string) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, call)
+		}
+
+		SetRunWrapper(func(name string, run func(context.Context) error) func(context.Context) error {
+			return func(ctx context.Context) error {
+				record("start run " + name)
+				defer record("end run " + name)
+				return run(ctx)
+			}
+		})
+		SetFallbackWrapper(func(name string, fallback func(context.Context, error) error) func(context.Context, error) error {
+			return func(ctx context.Context, err error) error {
+				record("start fallback " + name)
+				defer record("end fallback " + name)
+				return fallback(ctx, err)
+			}
+		})
+
+		Convey("a failing command runs both inside their wrappers", func() {
+			err := Do("wrapped", func() error {
+				record("run")
+				return fmt.Errorf("boom")
+			}, func(err error) error {
+				record("fallback")
+				return nil
+			})
+			So(err, ShouldBeNil)
+
+			mu.Lock()
+			defer mu.Unlock()
+			So(calls, ShouldResemble, []string{
+				"start run wrapped", "run", "end run wrapped",
+				"start fallback wrapped", "fallback", "end fallback wrapped",
+			})
+
+			Convey("and its outcome is still reported", func() {
+				snapshot, _ := Metrics("wrapped")
+				So(snapshot.Failures, ShouldEqual, 1)
+				So(snapshot.FallbackSuccesses, ShouldEqual, 1)
+			})
+		})
+
+		Convey("a command without a fallback only wraps run", func() {
+			err := Do("wrapped", func() error {
+				return fmt.Errorf("boom")
+			}, nil)
+			So(err.Error(), ShouldEqual, "boom")
+
+			mu.Lock()
+			defer mu.Unlock()
+			So(calls, ShouldResemble, []string{"start run wrapped", "end run wrapped"})
+		})
+
+		Convey("removing the wrappers stops them being applied", func() {
+			SetRunWrapper(nil)
+			SetFallbackWrapper(nil)
+			Do("wrapped", func() error { return nil }, nil)
+
+			mu.Lock()
+			defer mu.Unlock()
+			So(calls, ShouldHaveLength, 0)
+		})
+	})
+}
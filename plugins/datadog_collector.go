@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"sort"
 
 	// Developed on https://github.com/DataDog/datadog-go/tree/a27810dd518c69be741a7fd5d0e39f674f615be8
 	"github.com/DataDog/datadog-go/statsd"
@@ -26,6 +27,12 @@ const (
 	DM_FallbackFailures  = "hystrix.fallbackFailures"
 	DM_TotalDuration     = "hystrix.totalDuration"
 	DM_RunDuration       = "hystrix.runDuration"
+	DM_FallbackDuration  = "hystrix.fallbackDuration"
+	DM_QueueWaitDuration = "hystrix.queueWaitDuration"
+	DM_NoFallback        = "hystrix.noFallback"
+	DM_FallbackDegraded  = "hystrix.fallbackDegraded"
+	DM_Blocked           = "hystrix.blocked"
+	DM_FallbackRejects   = "hystrix.fallbackRejects"
 )
 
 type (
@@ -60,10 +67,63 @@ type (
 	// As new circuits come online you get graphing and monitoring "for free".
 	DatadogCollector struct {
 		client DatadogClient
+		names  DatadogMetricNames
 		tags   []string
 	}
+
+	// DatadogMetricNames holds the name reported for each metric sent by a
+	// DatadogCollector.
+	DatadogMetricNames struct {
+		CircuitOpen       string
+		Attempts          string
+		Errors            string
+		Successes         string
+		Failures          string
+		Rejects           string
+		ShortCircuits     string
+		Timeouts          string
+		FallbackSuccesses string
+		FallbackFailures  string
+		TotalDuration     string
+		RunDuration       string
+		// FallbackDuration is not reported when it is empty.
+		FallbackDuration string
+		// QueueWaitDuration is not reported when it is empty.
+		QueueWaitDuration string
+		// NoFallback is not reported when it is empty.
+		NoFallback string
+		// FallbackDegraded is not reported when it is empty.
+		FallbackDegraded string
+		// Blocked is not reported when it is empty.
+		Blocked string
+		// FallbackRejects is not reported when it is empty.
+		FallbackRejects string
+	}
 )
 
+// DefaultDatadogMetricNames are the metric names used unless others are given
+// to NewDatadogCollectorWithNames.
+var DefaultDatadogMetricNames = DatadogMetricNames{
+	CircuitOpen:       DM_CircuitOpen,
+	Attempts:          DM_Attempts,
+	Errors:            DM_Errors,
+	Successes:         DM_Successes,
+	Failures:          DM_Failures,
+	Rejects:           DM_Rejects,
+	ShortCircuits:     DM_ShortCircuits,
+	Timeouts:          DM_Timeouts,
+	FallbackSuccesses: DM_FallbackSuccesses,
+	FallbackFailures:  DM_FallbackFailures,
+	TotalDuration:     DM_TotalDuration,
+	RunDuration:       DM_RunDuration,
+	FallbackDuration:  DM_FallbackDuration,
+	QueueWaitDuration: DM_QueueWaitDuration,
+	NoFallback:        DM_NoFallback,
+	FallbackDegraded:  DM_FallbackDegraded,
+	Blocked:           DM_Blocked,
+	FallbackRejects:   DM_FallbackRejects,
+}
+
 // NewDatadogCollector creates a collector for a specific circuit with a
 // "github.com/DataDog/datadog-go/statsd".(*Client).
 //
@@ -99,57 +159,145 @@ func NewDatadogCollector(addr, prefix string) (func(string) metricCollector.Metr
 	return NewDatadogCollectorWithClient(c), nil
 }
 
+// NewStatsDCollector creates a collector for a specific circuit which ships
+// metrics to DogStatsD, tagging every metric with the given tags in addition to
+// the circuit name.
+//
+// Metrics are batched by a buffered "github.com/DataDog/datadog-go/statsd".(*Client),
+// which flushes on an interval rather than sending a packet for every event.
+//
+// addr is in the format "<host>:<port>" (e.g. "localhost:8125")
+//
+// prefix and tags may be empty
+//
+// The collector is registered alongside the default collector, which keeps
+// tracking circuit health:
+//
+//	collector, err := plugins.NewStatsDCollector("localhost:8125", "myapp.", []string{"env:prod"})
+//	if err != nil {
+//		panic(err)
+//	}
+//	metricCollector.Registry.Register(collector)
+func NewStatsDCollector(addr, prefix string, tags []string) (func(string) metricCollector.MetricCollector, error) {
+	c, err := statsd.NewBuffered(addr, 100)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Namespace = prefix
+
+	return NewDatadogCollectorWithNames(c, DefaultDatadogMetricNames, tags), nil
+}
+
 // NewDatadogCollectorWithClient accepts an interface which allows you to
 // provide your own implementation of a statsd client, alter configuration on
 // "github.com/DataDog/datadog-go/statsd".(*Client), provide additional tags per
 // circuit-metric tuple, and add logging if you need it.
 func NewDatadogCollectorWithClient(client DatadogClient) func(string) metricCollector.MetricCollector {
+	return NewDatadogCollectorWithNames(client, DefaultDatadogMetricNames, nil)
+}
+
+// NewDatadogCollectorWithNames is like NewDatadogCollectorWithClient, but
+// reports each metric under the given names and adds tags to every metric.
+func NewDatadogCollectorWithNames(client DatadogClient, names DatadogMetricNames, tags []string) func(string) metricCollector.MetricCollector {
 
 	return func(name string) metricCollector.MetricCollector {
 
+		circuitTags := make([]string, 0, len(tags)+1)
+		circuitTags = append(circuitTags, "hystrixcircuit:"+name)
+		circuitTags = append(circuitTags, tags...)
+
 		return &DatadogCollector{
 			client: client,
-			tags:   []string{"hystrixcircuit:" + name},
+			names:  names,
+			tags:   circuitTags,
 		}
 	}
 }
 
+// Update sends the metrics of an execution. Any tags it was executed with are added to those of the
+// circuit as key:value tags.
 func (dc *DatadogCollector) Update(r metricCollector.MetricResult) {
+	tags := dc.tags
+	if len(r.Tags) > 0 {
+		tags = withExecutionTags(dc.tags, r.Tags)
+	}
+
 	if r.Attempts > 0 {
-		dc.client.Count(DM_Attempts, int64(r.Attempts), dc.tags, 1.0)
+		dc.client.Count(dc.names.Attempts, int64(r.Attempts), tags, 1.0)
 	}
 	if r.Errors > 0 {
-		dc.client.Count(DM_Errors, int64(r.Errors), dc.tags, 1.0)
+		dc.client.Count(dc.names.Errors, int64(r.Errors), tags, 1.0)
 	}
 	if r.Successes > 0 {
-		dc.client.Gauge(DM_CircuitOpen, 0, dc.tags, 1.0)
-		dc.client.Count(DM_Successes, int64(r.Successes), dc.tags, 1.0)
+		dc.client.Gauge(dc.names.CircuitOpen, 0, tags, 1.0)
+		dc.client.Count(dc.names.Successes, int64(r.Successes), tags, 1.0)
 	}
 	if r.Failures > 0 {
-		dc.client.Count(DM_Failures, int64(r.Failures), dc.tags, 1.0)
+		dc.client.Count(dc.names.Failures, int64(r.Failures), tags, 1.0)
 	}
 	if r.Rejects > 0 {
-		dc.client.Count(DM_Rejects, int64(r.Rejects), dc.tags, 1.0)
+		dc.client.Count(dc.names.Rejects, int64(r.Rejects), tags, 1.0)
 	}
 	if r.ShortCircuits > 0 {
-		dc.client.Gauge(DM_CircuitOpen, 1, dc.tags, 1.0)
-		dc.client.Count(DM_ShortCircuits, int64(r.ShortCircuits), dc.tags, 1.0)
+		dc.client.Gauge(dc.names.CircuitOpen, 1, tags, 1.0)
+		dc.client.Count(dc.names.ShortCircuits, int64(r.ShortCircuits), tags, 1.0)
 	}
 	if r.Timeouts > 0 {
-		dc.client.Count(DM_Timeouts, int64(r.Timeouts), dc.tags, 1.0)
+		dc.client.Count(dc.names.Timeouts, int64(r.Timeouts), tags, 1.0)
 	}
 	if r.FallbackSuccesses > 0 {
-		dc.client.Count(DM_FallbackSuccesses, int64(r.FallbackSuccesses), dc.tags, 1.0)
+		dc.client.Count(dc.names.FallbackSuccesses, int64(r.FallbackSuccesses), tags, 1.0)
 	}
 	if r.FallbackFailures > 0 {
-		dc.client.Count(DM_FallbackFailures, int64(r.FallbackFailures), dc.tags, 1.0)
+		dc.client.Count(dc.names.FallbackFailures, int64(r.FallbackFailures), tags, 1.0)
+	}
+	if dc.names.NoFallback != "" && r.NoFallback > 0 {
+		dc.client.Count(dc.names.NoFallback, int64(r.NoFallback), tags, 1.0)
+	}
+	if dc.names.FallbackDegraded != "" && r.FallbackDegraded > 0 {
+		dc.client.Count(dc.names.FallbackDegraded, int64(r.FallbackDegraded), tags, 1.0)
+	}
+	if dc.names.Blocked != "" && r.Blocked > 0 {
+		dc.client.Count(dc.names.Blocked, int64(r.Blocked), tags, 1.0)
+	}
+	if dc.names.FallbackRejects != "" && r.FallbackRejects > 0 {
+		dc.client.Count(dc.names.FallbackRejects, int64(r.FallbackRejects), tags, 1.0)
 	}
 
 	ms := float64(r.TotalDuration.Nanoseconds() / 1000000)
-	dc.client.TimeInMilliseconds(DM_TotalDuration, ms, dc.tags, 1.0)
+	dc.client.TimeInMilliseconds(dc.names.TotalDuration, ms, tags, 1.0)
 
-	ms = float64(r.RunDuration.Nanoseconds() / 1000000)
-	dc.client.TimeInMilliseconds(DM_RunDuration, ms, dc.tags, 1.0)
+	if r.Executed {
+		ms = float64(r.RunDuration.Nanoseconds() / 1000000)
+		dc.client.TimeInMilliseconds(dc.names.RunDuration, ms, tags, 1.0)
+	}
+
+	if dc.names.FallbackDuration != "" && (r.FallbackSuccesses > 0 || r.FallbackFailures > 0) {
+		ms = float64(r.FallbackDuration.Nanoseconds() / 1000000)
+		dc.client.TimeInMilliseconds(dc.names.FallbackDuration, ms, tags, 1.0)
+	}
+
+	if dc.names.QueueWaitDuration != "" && r.QueueWaitDuration > 0 {
+		ms = float64(r.QueueWaitDuration.Nanoseconds() / 1000000)
+		dc.client.TimeInMilliseconds(dc.names.QueueWaitDuration, ms, tags, 1.0)
+	}
+}
+
+// withExecutionTags returns the tags of a circuit followed by those of an execution, sorted by key.
+func withExecutionTags(circuitTags []string, executionTags map[string]string) []string {
+	keys := make([]string, 0, len(executionTags))
+	for key := range executionTags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tags := make([]string, 0, len(circuitTags)+len(keys))
+	tags = append(tags, circuitTags...)
+	for _, key := range keys {
+		tags = append(tags, key+":"+executionTags[key])
+	}
+	return tags
 }
 
 // Reset is a noop operation in this collector.
@@ -0,0 +1,87 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix/metric_collector"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type recordingDatadogClient struct {
+	counts  map[string]int64
+	timings map[string]float64
+	tags    []string
+}
+
+func newRecordingDatadogClient() *recordingDatadogClient {
+	return &recordingDatadogClient{
+		counts:  make(map[string]int64),
+		timings: make(map[string]float64),
+	}
+}
+
+func (c *recordingDatadogClient) Count(name string, value int64, tags []string, rate float64) error {
+	c.counts[name] += value
+	c.tags = tags
+	return nil
+}
+
+func (c *recordingDatadogClient) Gauge(name string, value float64, tags []string, rate float64) error {
+	return nil
+}
+
+func (c *recordingDatadogClient) TimeInMilliseconds(name string, value float64, tags []string, rate float64) error {
+	c.timings[name] = value
+	return nil
+}
+
+func TestDatadogCollectorNames(t *testing.T) {
+	Convey("when creating a collector with custom metric names and tags", t, func() {
+		client := newRecordingDatadogClient()
+		names := DefaultDatadogMetricNames
+		names.Attempts = "custom.attempts"
+		names.RunDuration = "custom.runDuration"
+
+		collector := NewDatadogCollectorWithNames(client, names, []string{"env:test"})("foo")
+		collector.Update(metricCollector.MetricResult{
+			Attempts:          1,
+			Failures:          1,
+			FallbackSuccesses: 1,
+			RunDuration:       20 * time.Millisecond,
+			FallbackDuration:  5 * time.Millisecond,
+			Executed:          true,
+		})
+
+		Convey("the custom names are used", func() {
+			So(client.counts["custom.attempts"], ShouldEqual, 1)
+			So(client.counts[DM_Failures], ShouldEqual, 1)
+			So(client.timings["custom.runDuration"], ShouldEqual, 20)
+			So(client.timings[DM_FallbackDuration], ShouldEqual, 5)
+		})
+
+		Convey("the circuit tag is sent along with the given tags", func() {
+			So(client.tags, ShouldResemble, []string{"hystrixcircuit:foo", "env:test"})
+		})
+	})
+}
+
+func TestDatadogCollectorExecutionTags(t *testing.T) {
+	Convey("when an execution has tags", t, func() {
+		client := newRecordingDatadogClient()
+		collector := NewDatadogCollectorWithNames(client, DefaultDatadogMetricNames, []string{"env:test"})("foo")
+		collector.Update(metricCollector.MetricResult{
+			Attempts: 1,
+			Tags:     map[string]string{"region": "eu", "host": "db-1"},
+		})
+
+		Convey("they follow the tags of the circuit, sorted by key", func() {
+			So(client.tags, ShouldResemble, []string{"hystrixcircuit:foo", "env:test", "host:db-1", "region:eu"})
+		})
+
+		Convey("the tags of the circuit are left alone", func() {
+			collector.Update(metricCollector.MetricResult{Attempts: 1})
+			So(client.tags, ShouldResemble, []string{"hystrixcircuit:foo", "env:test"})
+		})
+	})
+}
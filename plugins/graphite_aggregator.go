@@ -30,8 +30,14 @@ type GraphiteCollector struct {
 	timeoutsPrefix          string
 	fallbackSuccessesPrefix string
 	fallbackFailuresPrefix  string
+	noFallbackPrefix        string
+	fallbackDegradedPrefix  string
+	blockedPrefix           string
+	fallbackRejectsPrefix   string
 	totalDurationPrefix     string
 	runDurationPrefix       string
+	fallbackDurationPrefix  string
+	queueWaitDurationPrefix string
 }
 
 // GraphiteCollectorConfig provides configuration that the graphite client will need.
@@ -67,8 +73,14 @@ func NewGraphiteCollector(name string) metricCollector.MetricCollector {
 		timeoutsPrefix:          name + ".timeouts",
 		fallbackSuccessesPrefix: name + ".fallbackSuccesses",
 		fallbackFailuresPrefix:  name + ".fallbackFailures",
+		noFallbackPrefix:        name + ".noFallback",
+		fallbackDegradedPrefix:  name + ".fallbackDegraded",
+		blockedPrefix:           name + ".blocked",
+		fallbackRejectsPrefix:   name + ".fallbackRejects",
 		totalDurationPrefix:     name + ".totalDuration",
 		runDurationPrefix:       name + ".runDuration",
+		fallbackDurationPrefix:  name + ".fallbackDuration",
+		queueWaitDurationPrefix: name + ".queueWaitDuration",
 	}
 }
 
@@ -101,8 +113,20 @@ func (g *GraphiteCollector) Update(r metricCollector.MetricResult) {
 	g.incrementCounterMetric(g.timeoutsPrefix, r.Timeouts)
 	g.incrementCounterMetric(g.fallbackSuccessesPrefix, r.FallbackSuccesses)
 	g.incrementCounterMetric(g.fallbackFailuresPrefix, r.FallbackFailures)
+	g.incrementCounterMetric(g.noFallbackPrefix, r.NoFallback)
+	g.incrementCounterMetric(g.fallbackDegradedPrefix, r.FallbackDegraded)
+	g.incrementCounterMetric(g.blockedPrefix, r.Blocked)
+	g.incrementCounterMetric(g.fallbackRejectsPrefix, r.FallbackRejects)
 	g.updateTimerMetric(g.totalDurationPrefix, r.TotalDuration)
-	g.updateTimerMetric(g.runDurationPrefix, r.RunDuration)
+	if r.Executed {
+		g.updateTimerMetric(g.runDurationPrefix, r.RunDuration)
+	}
+	if r.FallbackSuccesses > 0 || r.FallbackFailures > 0 {
+		g.updateTimerMetric(g.fallbackDurationPrefix, r.FallbackDuration)
+	}
+	if r.QueueWaitDuration > 0 {
+		g.updateTimerMetric(g.queueWaitDurationPrefix, r.QueueWaitDuration)
+	}
 }
 
 // Reset is a noop operation in this collector.
@@ -0,0 +1,205 @@
+package plugins
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/afex/hystrix-go/hystrix/metric_collector"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// OTelCommandAttribute is the attribute which identifies the circuit on every
+// measurement recorded by the OTelCollector.
+const OTelCommandAttribute = "hystrix.command"
+
+const (
+	otelAttempts = iota
+	otelErrors
+	otelSuccesses
+	otelFailures
+	otelRejects
+	otelShortCircuits
+	otelTimeouts
+	otelFallbackSuccesses
+	otelFallbackFailures
+	otelNoFallback
+	otelFallbackDegraded
+	otelBlocked
+	otelFallbackRejects
+	otelCounterCount
+)
+
+var otelCounters = [otelCounterCount]struct {
+	name        string
+	description string
+}{
+	otelAttempts:          {"hystrix.attempts", "Number of command executions attempted."},
+	otelErrors:            {"hystrix.errors", "Number of command executions which did not succeed."},
+	otelSuccesses:         {"hystrix.successes", "Number of command executions which succeeded."},
+	otelFailures:          {"hystrix.failures", "Number of command executions whose run function returned an error."},
+	otelRejects:           {"hystrix.rejects", "Number of command executions rejected due to max concurrency."},
+	otelShortCircuits:     {"hystrix.short_circuits", "Number of command executions short-circuited by an open circuit."},
+	otelTimeouts:          {"hystrix.timeouts", "Number of command executions which timed out."},
+	otelFallbackSuccesses: {"hystrix.fallback_successes", "Number of fallbacks which succeeded."},
+	otelFallbackFailures:  {"hystrix.fallback_failures", "Number of fallbacks which returned an error."},
+	otelNoFallback:        {"hystrix.no_fallback", "Number of command executions which failed without a fallback."},
+	otelFallbackDegraded:  {"hystrix.fallback_degraded", "Number of fallbacks which succeeded with a degraded result."},
+	otelBlocked:           {"hystrix.blocked", "Number of command executions turned away because the command was blocked."},
+	otelFallbackRejects:   {"hystrix.fallback_rejects", "Number of fallbacks not run because too many were already running."},
+}
+
+// OTelCollector fulfills the metricCollector interface allowing users to record
+// circuit stats with an OpenTelemetry metric.Meter. To use, create the collector
+// with NewOTelCollector and register the returned function with
+// metricCollector.Registry.Register.
+//
+// Event counts are accumulated in memory and reported through asynchronous
+// counters when the meter is collected, so Update stays cheap no matter how
+// often it is called. Run, fallback and queue wait durations are recorded to histograms.
+type OTelCollector struct {
+	counts            *[otelCounterCount]int64
+	runDuration       metric.Float64Histogram
+	fallbackDuration  metric.Float64Histogram
+	queueWaitDuration metric.Float64Histogram
+	attributes        metric.MeasurementOption
+}
+
+type otelCommand struct {
+	counts     [otelCounterCount]int64
+	attributes metric.MeasurementOption
+}
+
+// NewOTelCollector creates the hystrix instruments on the given meter and
+// returns a collector initializer for use with metricCollector.Registry.Register.
+//
+// Example use
+//
+//	package main
+//
+//	import (
+//		"github.com/afex/hystrix-go/plugins"
+//		"github.com/afex/hystrix-go/hystrix/metric_collector"
+//		"go.opentelemetry.io/otel"
+//	)
+//
+//	func main() {
+//		collector, err := plugins.NewOTelCollector(otel.Meter("myapp"))
+//		if err != nil {
+//			panic(err)
+//		}
+//		metricCollector.Registry.Register(collector)
+//	}
+func NewOTelCollector(meter metric.Meter) (func(string) metricCollector.MetricCollector, error) {
+	var instruments [otelCounterCount]metric.Int64ObservableCounter
+	observables := make([]metric.Observable, 0, otelCounterCount)
+	for i, c := range otelCounters {
+		instrument, err := meter.Int64ObservableCounter(c.name, metric.WithDescription(c.description))
+		if err != nil {
+			return nil, err
+		}
+		instruments[i] = instrument
+		observables = append(observables, instrument)
+	}
+
+	runDuration, err := meter.Float64Histogram("hystrix.run_duration",
+		metric.WithDescription("Duration of the run function of command executions."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	fallbackDuration, err := meter.Float64Histogram("hystrix.fallback_duration",
+		metric.WithDescription("Duration of the fallbacks of command executions."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	queueWaitDuration, err := meter.Float64Histogram("hystrix.queue_wait_duration",
+		metric.WithDescription("Time command executions waited for a ticket from the executor pool."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex := &sync.RWMutex{}
+	commands := make(map[string]*otelCommand)
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		mutex.RLock()
+		defer mutex.RUnlock()
+
+		for _, cmd := range commands {
+			for i, instrument := range instruments {
+				o.ObserveInt64(instrument, atomic.LoadInt64(&cmd.counts[i]), cmd.attributes)
+			}
+		}
+		return nil
+	}, observables...)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(name string) metricCollector.MetricCollector {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		// circuits are recreated after a Flush, so reuse the counts to keep them monotonic
+		cmd, ok := commands[name]
+		if !ok {
+			cmd = &otelCommand{
+				attributes: metric.WithAttributeSet(attribute.NewSet(attribute.String(OTelCommandAttribute, name))),
+			}
+			commands[name] = cmd
+		}
+
+		return &OTelCollector{
+			counts:            &cmd.counts,
+			runDuration:       runDuration,
+			fallbackDuration:  fallbackDuration,
+			queueWaitDuration: queueWaitDuration,
+			attributes:        cmd.attributes,
+		}
+	}, nil
+}
+
+func (oc *OTelCollector) add(counter int, value float64) {
+	if value == 0 {
+		return
+	}
+	atomic.AddInt64(&oc.counts[counter], int64(value))
+}
+
+func (oc *OTelCollector) Update(r metricCollector.MetricResult) {
+	oc.add(otelAttempts, r.Attempts)
+	oc.add(otelErrors, r.Errors)
+	oc.add(otelSuccesses, r.Successes)
+	oc.add(otelFailures, r.Failures)
+	oc.add(otelRejects, r.Rejects)
+	oc.add(otelShortCircuits, r.ShortCircuits)
+	oc.add(otelTimeouts, r.Timeouts)
+	oc.add(otelFallbackSuccesses, r.FallbackSuccesses)
+	oc.add(otelFallbackFailures, r.FallbackFailures)
+	oc.add(otelNoFallback, r.NoFallback)
+	oc.add(otelFallbackDegraded, r.FallbackDegraded)
+	oc.add(otelBlocked, r.Blocked)
+	oc.add(otelFallbackRejects, r.FallbackRejects)
+
+	if r.Executed {
+		oc.runDuration.Record(context.Background(), r.RunDuration.Seconds(), oc.attributes)
+	}
+	if r.FallbackSuccesses > 0 || r.FallbackFailures > 0 {
+		oc.fallbackDuration.Record(context.Background(), r.FallbackDuration.Seconds(), oc.attributes)
+	}
+	if r.QueueWaitDuration > 0 {
+		oc.queueWaitDuration.Record(context.Background(), r.QueueWaitDuration.Seconds(), oc.attributes)
+	}
+}
+
+// Reset is a noop operation in this collector, as OpenTelemetry counters are monotonic.
+func (oc *OTelCollector) Reset() {}
@@ -0,0 +1,75 @@
+package plugins
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix/metric_collector"
+	. "github.com/smartystreets/goconvey/convey"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func collectOTel(reader sdkmetric.Reader) map[string]metricdata.Aggregation {
+	var rm metricdata.ResourceMetrics
+	reader.Collect(context.Background(), &rm)
+
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	return metrics
+}
+
+func TestOTelCollector(t *testing.T) {
+	Convey("when initializing the collector", t, func() {
+		reader := sdkmetric.NewManualReader()
+		meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+		initializer, err := NewOTelCollector(meter)
+		So(err, ShouldBeNil)
+
+		Convey("and a failed execution with a fallback is reported", func() {
+			collector := initializer("foo")
+			for i := 0; i < 3; i++ {
+				collector.Update(metricCollector.MetricResult{
+					Attempts:          1,
+					Errors:            1,
+					Failures:          1,
+					FallbackSuccesses: 1,
+					RunDuration:       10 * time.Millisecond,
+					Executed:          true,
+				})
+			}
+
+			metrics := collectOTel(reader)
+
+			Convey("the counters are observed with the command attribute", func() {
+				sum := metrics["hystrix.attempts"].(metricdata.Sum[int64])
+				So(len(sum.DataPoints), ShouldEqual, 1)
+				So(sum.DataPoints[0].Value, ShouldEqual, 3)
+
+				command, ok := sum.DataPoints[0].Attributes.Value(OTelCommandAttribute)
+				So(ok, ShouldBeTrue)
+				So(command.AsString(), ShouldEqual, "foo")
+
+				So(metrics["hystrix.successes"].(metricdata.Sum[int64]).DataPoints[0].Value, ShouldEqual, 0)
+				So(metrics["hystrix.fallback_successes"].(metricdata.Sum[int64]).DataPoints[0].Value, ShouldEqual, 3)
+			})
+
+			Convey("the run duration is recorded", func() {
+				histogram := metrics["hystrix.run_duration"].(metricdata.Histogram[float64])
+				So(len(histogram.DataPoints), ShouldEqual, 1)
+				So(histogram.DataPoints[0].Count, ShouldEqual, 3)
+			})
+
+			Convey("the circuit being recreated keeps the counts", func() {
+				initializer("foo").Update(metricCollector.MetricResult{Attempts: 1})
+				sum := collectOTel(reader)["hystrix.attempts"].(metricdata.Sum[int64])
+				So(sum.DataPoints[0].Value, ShouldEqual, 4)
+			})
+		})
+	})
+}
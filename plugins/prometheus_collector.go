@@ -0,0 +1,201 @@
+package plugins
+
+import (
+	"github.com/afex/hystrix-go/hystrix/metric_collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusCommandLabel is the label which identifies the circuit on every metric
+// exported by the PrometheusCollector.
+const PrometheusCommandLabel = "hystrix_command"
+
+// PrometheusCollector fulfills the metricCollector interface allowing users to expose circuit
+// stats to Prometheus. To use, create the collector with NewPrometheusCollector and register
+// the returned function with metricCollector.Registry.Register.
+//
+// This Collector uses github.com/prometheus/client_golang for instrumentation.
+type PrometheusCollector struct {
+	attempts          prometheus.Counter
+	errors            prometheus.Counter
+	successes         prometheus.Counter
+	failures          prometheus.Counter
+	rejects           prometheus.Counter
+	shortCircuits     prometheus.Counter
+	timeouts          prometheus.Counter
+	fallbackSuccesses prometheus.Counter
+	fallbackFailures  prometheus.Counter
+	noFallback        prometheus.Counter
+	fallbackDegraded  prometheus.Counter
+	blocked           prometheus.Counter
+	fallbackRejects   prometheus.Counter
+	runDuration       prometheus.Observer
+	fallbackDuration  prometheus.Observer
+	queueWaitDuration prometheus.Observer
+}
+
+type prometheusVectors struct {
+	attempts          *prometheus.CounterVec
+	errors            *prometheus.CounterVec
+	successes         *prometheus.CounterVec
+	failures          *prometheus.CounterVec
+	rejects           *prometheus.CounterVec
+	shortCircuits     *prometheus.CounterVec
+	timeouts          *prometheus.CounterVec
+	fallbackSuccesses *prometheus.CounterVec
+	fallbackFailures  *prometheus.CounterVec
+	noFallback        *prometheus.CounterVec
+	fallbackDegraded  *prometheus.CounterVec
+	blocked           *prometheus.CounterVec
+	fallbackRejects   *prometheus.CounterVec
+	runDuration       *prometheus.HistogramVec
+	fallbackDuration  *prometheus.HistogramVec
+	queueWaitDuration *prometheus.HistogramVec
+}
+
+// NewPrometheusCollector registers the hystrix metrics with prometheus.DefaultRegisterer and
+// returns a collector initializer for use with metricCollector.Registry.Register.
+//
+// Metrics are named {namespace}_hystrix_{metric}, and namespace may be an empty string.
+//
+// Example use
+//
+//	package main
+//
+//	import (
+//		"github.com/afex/hystrix-go/plugins"
+//		"github.com/afex/hystrix-go/hystrix/metric_collector"
+//	)
+//
+//	func main() {
+//		collector, err := plugins.NewPrometheusCollector("myapp")
+//		if err != nil {
+//			panic(err)
+//		}
+//		metricCollector.Registry.Register(collector)
+//	}
+func NewPrometheusCollector(namespace string) (func(string) metricCollector.MetricCollector, error) {
+	return NewPrometheusCollectorWithRegisterer(namespace, prometheus.DefaultRegisterer)
+}
+
+// NewPrometheusCollectorWithRegisterer is like NewPrometheusCollector, but registers the
+// hystrix metrics with the given prometheus.Registerer.
+func NewPrometheusCollectorWithRegisterer(namespace string, registerer prometheus.Registerer) (func(string) metricCollector.MetricCollector, error) {
+	counter := func(name, help string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "hystrix",
+			Name:      name,
+			Help:      help,
+		}, []string{PrometheusCommandLabel})
+	}
+
+	v := &prometheusVectors{
+		attempts:          counter("attempts_total", "Number of command executions attempted."),
+		errors:            counter("errors_total", "Number of command executions which did not succeed."),
+		successes:         counter("successes_total", "Number of command executions which succeeded."),
+		failures:          counter("failures_total", "Number of command executions whose run function returned an error."),
+		rejects:           counter("rejects_total", "Number of command executions rejected due to max concurrency."),
+		shortCircuits:     counter("short_circuits_total", "Number of command executions short-circuited by an open circuit."),
+		timeouts:          counter("timeouts_total", "Number of command executions which timed out."),
+		fallbackSuccesses: counter("fallback_successes_total", "Number of fallbacks which succeeded."),
+		fallbackFailures:  counter("fallback_failures_total", "Number of fallbacks which returned an error."),
+		noFallback:        counter("no_fallback_total", "Number of command executions which failed without a fallback."),
+		fallbackDegraded:  counter("fallback_degraded_total", "Number of fallbacks which succeeded with a degraded result."),
+		blocked:           counter("blocked_total", "Number of command executions turned away because the command was blocked."),
+		fallbackRejects:   counter("fallback_rejects_total", "Number of fallbacks not run because too many were already running."),
+		runDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "hystrix",
+			Name:      "run_duration_seconds",
+			Help:      "Duration of the run function of command executions.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{PrometheusCommandLabel}),
+		fallbackDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "hystrix",
+			Name:      "fallback_duration_seconds",
+			Help:      "Duration of the fallbacks of command executions.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{PrometheusCommandLabel}),
+		queueWaitDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "hystrix",
+			Name:      "queue_wait_duration_seconds",
+			Help:      "Time command executions waited for a ticket from the executor pool.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{PrometheusCommandLabel}),
+	}
+
+	collectors := []prometheus.Collector{
+		v.attempts,
+		v.errors,
+		v.successes,
+		v.failures,
+		v.rejects,
+		v.shortCircuits,
+		v.timeouts,
+		v.fallbackSuccesses,
+		v.fallbackFailures,
+		v.noFallback,
+		v.fallbackDegraded,
+		v.blocked,
+		v.fallbackRejects,
+		v.runDuration,
+		v.fallbackDuration,
+		v.queueWaitDuration,
+	}
+	for _, c := range collectors {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(name string) metricCollector.MetricCollector {
+		return &PrometheusCollector{
+			attempts:          v.attempts.WithLabelValues(name),
+			errors:            v.errors.WithLabelValues(name),
+			successes:         v.successes.WithLabelValues(name),
+			failures:          v.failures.WithLabelValues(name),
+			rejects:           v.rejects.WithLabelValues(name),
+			shortCircuits:     v.shortCircuits.WithLabelValues(name),
+			timeouts:          v.timeouts.WithLabelValues(name),
+			fallbackSuccesses: v.fallbackSuccesses.WithLabelValues(name),
+			fallbackFailures:  v.fallbackFailures.WithLabelValues(name),
+			noFallback:        v.noFallback.WithLabelValues(name),
+			fallbackDegraded:  v.fallbackDegraded.WithLabelValues(name),
+			blocked:           v.blocked.WithLabelValues(name),
+			fallbackRejects:   v.fallbackRejects.WithLabelValues(name),
+			runDuration:       v.runDuration.WithLabelValues(name),
+			fallbackDuration:  v.fallbackDuration.WithLabelValues(name),
+			queueWaitDuration: v.queueWaitDuration.WithLabelValues(name),
+		}
+	}, nil
+}
+
+func (pc *PrometheusCollector) Update(r metricCollector.MetricResult) {
+	pc.attempts.Add(r.Attempts)
+	pc.errors.Add(r.Errors)
+	pc.successes.Add(r.Successes)
+	pc.failures.Add(r.Failures)
+	pc.rejects.Add(r.Rejects)
+	pc.shortCircuits.Add(r.ShortCircuits)
+	pc.timeouts.Add(r.Timeouts)
+	pc.fallbackSuccesses.Add(r.FallbackSuccesses)
+	pc.fallbackFailures.Add(r.FallbackFailures)
+	pc.noFallback.Add(r.NoFallback)
+	pc.fallbackDegraded.Add(r.FallbackDegraded)
+	pc.blocked.Add(r.Blocked)
+	pc.fallbackRejects.Add(r.FallbackRejects)
+	if r.Executed {
+		pc.runDuration.Observe(r.RunDuration.Seconds())
+	}
+	if r.FallbackSuccesses > 0 || r.FallbackFailures > 0 {
+		pc.fallbackDuration.Observe(r.FallbackDuration.Seconds())
+	}
+	if r.QueueWaitDuration > 0 {
+		pc.queueWaitDuration.Observe(r.QueueWaitDuration.Seconds())
+	}
+}
+
+// Reset is a noop operation in this collector, as Prometheus counters are monotonic.
+func (pc *PrometheusCollector) Reset() {}
@@ -0,0 +1,77 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix/metric_collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPrometheusCollector(t *testing.T) {
+	Convey("when initializing the collector", t, func() {
+		registry := prometheus.NewRegistry()
+		initializer, err := NewPrometheusCollectorWithRegisterer("test", registry)
+		So(err, ShouldBeNil)
+
+		Convey("registering it a second time fails", func() {
+			_, err := NewPrometheusCollectorWithRegisterer("test", registry)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("and a failed execution with a fallback is reported", func() {
+			collector := initializer("foo/bar")
+			collector.Update(metricCollector.MetricResult{
+				Attempts:          1,
+				Errors:            1,
+				Failures:          1,
+				FallbackSuccesses: 1,
+				RunDuration:       10 * time.Millisecond,
+				FallbackDuration:  5 * time.Millisecond,
+				Executed:          true,
+			})
+			collector.Reset()
+
+			Convey("the counters are labelled with the command name", func() {
+				So(testutil.ToFloat64(collector.(*PrometheusCollector).attempts), ShouldEqual, 1)
+				So(testutil.ToFloat64(collector.(*PrometheusCollector).failures), ShouldEqual, 1)
+				So(testutil.ToFloat64(collector.(*PrometheusCollector).fallbackSuccesses), ShouldEqual, 1)
+				So(testutil.ToFloat64(collector.(*PrometheusCollector).successes), ShouldEqual, 0)
+
+				count, err := testutil.GatherAndCount(registry, "test_hystrix_attempts_total")
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 1)
+			})
+
+			Convey("the run duration is observed", func() {
+				count, err := testutil.GatherAndCount(registry, "test_hystrix_run_duration_seconds")
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 1)
+			})
+
+			Convey("the fallback duration is observed", func() {
+				count, err := testutil.GatherAndCount(registry, "test_hystrix_fallback_duration_seconds")
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 1)
+			})
+		})
+
+		Convey("and a failed execution without a fallback is reported", func() {
+			collector := initializer("nofallback")
+			collector.Update(metricCollector.MetricResult{
+				Attempts:   1,
+				Errors:     1,
+				Failures:   1,
+				NoFallback: 1,
+				Executed:   true,
+			})
+
+			Convey("it is counted as having no fallback", func() {
+				So(testutil.ToFloat64(collector.(*PrometheusCollector).noFallback), ShouldEqual, 1)
+				So(testutil.ToFloat64(collector.(*PrometheusCollector).fallbackFailures), ShouldEqual, 0)
+			})
+		})
+	})
+}
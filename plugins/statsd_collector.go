@@ -26,10 +26,16 @@ type StatsdCollector struct {
 	timeoutsPrefix          string
 	fallbackSuccessesPrefix string
 	fallbackFailuresPrefix  string
+	noFallbackPrefix        string
+	fallbackDegradedPrefix  string
+	blockedPrefix           string
+	fallbackRejectsPrefix   string
 	canceledPrefix          string
 	deadlinePrefix          string
 	totalDurationPrefix     string
 	runDurationPrefix       string
+	fallbackDurationPrefix  string
+	queueWaitDurationPrefix string
 	concurrencyInUsePrefix  string
 	sampleRate              float32
 }
@@ -106,10 +112,16 @@ func (s *StatsdCollectorClient) NewStatsdCollector(name string) metricCollector.
 		timeoutsPrefix:          name + ".timeouts",
 		fallbackSuccessesPrefix: name + ".fallbackSuccesses",
 		fallbackFailuresPrefix:  name + ".fallbackFailures",
+		noFallbackPrefix:        name + ".noFallback",
+		fallbackDegradedPrefix:  name + ".fallbackDegraded",
+		blockedPrefix:           name + ".blocked",
+		fallbackRejectsPrefix:   name + ".fallbackRejects",
 		canceledPrefix:          name + ".contextCanceled",
 		deadlinePrefix:          name + ".contextDeadlineExceeded",
 		totalDurationPrefix:     name + ".totalDuration",
 		runDurationPrefix:       name + ".runDuration",
+		fallbackDurationPrefix:  name + ".fallbackDuration",
+		queueWaitDurationPrefix: name + ".queueWaitDuration",
 		concurrencyInUsePrefix:  name + ".concurrencyInUse",
 		sampleRate:              s.sampleRate,
 	}
@@ -146,27 +158,48 @@ func (g *StatsdCollector) updateTimingMetric(prefix string, i int64) {
 	}
 }
 
+// Update sends the metrics of an execution. When the command has a MetricsNamespace, the names of its
+// metrics are {config.Prefix}.{namespace}.{circuit_name}.{metric}.
 func (g *StatsdCollector) Update(r metricCollector.MetricResult) {
+	key := func(prefix string) string {
+		if r.Namespace == "" {
+			return prefix
+		}
+		return r.Namespace + "." + prefix
+	}
+
 	if r.Successes > 0 {
-		g.setGauge(g.circuitOpenPrefix, 0)
+		g.setGauge(key(g.circuitOpenPrefix), 0)
 	} else if r.ShortCircuits > 0 {
-		g.setGauge(g.circuitOpenPrefix, 1)
+		g.setGauge(key(g.circuitOpenPrefix), 1)
 	}
 
-	g.incrementCounterMetric(g.attemptsPrefix, r.Attempts)
-	g.incrementCounterMetric(g.errorsPrefix, r.Errors)
-	g.incrementCounterMetric(g.successesPrefix, r.Successes)
-	g.incrementCounterMetric(g.failuresPrefix, r.Failures)
-	g.incrementCounterMetric(g.rejectsPrefix, r.Rejects)
-	g.incrementCounterMetric(g.shortCircuitsPrefix, r.ShortCircuits)
-	g.incrementCounterMetric(g.timeoutsPrefix, r.Timeouts)
-	g.incrementCounterMetric(g.fallbackSuccessesPrefix, r.FallbackSuccesses)
-	g.incrementCounterMetric(g.fallbackFailuresPrefix, r.FallbackFailures)
-	g.incrementCounterMetric(g.canceledPrefix, r.ContextCanceled)
-	g.incrementCounterMetric(g.deadlinePrefix, r.ContextDeadlineExceeded)
-	g.updateTimerMetric(g.totalDurationPrefix, r.TotalDuration)
-	g.updateTimerMetric(g.runDurationPrefix, r.RunDuration)
-	g.updateTimingMetric(g.concurrencyInUsePrefix, int64(100*r.ConcurrencyInUse))
+	g.incrementCounterMetric(key(g.attemptsPrefix), r.Attempts)
+	g.incrementCounterMetric(key(g.errorsPrefix), r.Errors)
+	g.incrementCounterMetric(key(g.successesPrefix), r.Successes)
+	g.incrementCounterMetric(key(g.failuresPrefix), r.Failures)
+	g.incrementCounterMetric(key(g.rejectsPrefix), r.Rejects)
+	g.incrementCounterMetric(key(g.shortCircuitsPrefix), r.ShortCircuits)
+	g.incrementCounterMetric(key(g.timeoutsPrefix), r.Timeouts)
+	g.incrementCounterMetric(key(g.fallbackSuccessesPrefix), r.FallbackSuccesses)
+	g.incrementCounterMetric(key(g.fallbackFailuresPrefix), r.FallbackFailures)
+	g.incrementCounterMetric(key(g.noFallbackPrefix), r.NoFallback)
+	g.incrementCounterMetric(key(g.fallbackDegradedPrefix), r.FallbackDegraded)
+	g.incrementCounterMetric(key(g.blockedPrefix), r.Blocked)
+	g.incrementCounterMetric(key(g.fallbackRejectsPrefix), r.FallbackRejects)
+	g.incrementCounterMetric(key(g.canceledPrefix), r.ContextCanceled)
+	g.incrementCounterMetric(key(g.deadlinePrefix), r.ContextDeadlineExceeded)
+	g.updateTimerMetric(key(g.totalDurationPrefix), r.TotalDuration)
+	if r.Executed {
+		g.updateTimerMetric(key(g.runDurationPrefix), r.RunDuration)
+	}
+	if r.FallbackSuccesses > 0 || r.FallbackFailures > 0 {
+		g.updateTimerMetric(key(g.fallbackDurationPrefix), r.FallbackDuration)
+	}
+	if r.QueueWaitDuration > 0 {
+		g.updateTimerMetric(key(g.queueWaitDurationPrefix), r.QueueWaitDuration)
+	}
+	g.updateTimingMetric(key(g.concurrencyInUsePrefix), int64(100*r.ConcurrencyInUse))
 }
 
 // Reset is a noop operation in this collector.
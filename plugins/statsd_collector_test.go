@@ -3,6 +3,9 @@ package plugins
 import (
 	"testing"
 
+	"github.com/afex/hystrix-go/hystrix/metric_collector"
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/cactus/go-statsd-client/statsd/statsdtest"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -35,3 +38,22 @@ func TestSampleRate(t *testing.T) {
 		})
 	})
 }
+
+func TestStatsdNamespace(t *testing.T) {
+	Convey("given a statsd collector for the command foo", t, func() {
+		sender := statsdtest.NewRecordingSender()
+		client, err := statsd.NewClientWithSender(sender, "test")
+		So(err, ShouldBeNil)
+		collector := (&StatsdCollectorClient{client: client, sampleRate: 1}).NewStatsdCollector("foo")
+
+		Convey("metrics without a namespace are named after the command", func() {
+			collector.Update(metricCollector.MetricResult{Attempts: 1})
+			So(sender.GetSent().CollectNamed("test.foo.attempts"), ShouldHaveLength, 1)
+		})
+
+		Convey("metrics with a namespace are grouped under it", func() {
+			collector.Update(metricCollector.MetricResult{Attempts: 1, Namespace: "payments"})
+			So(sender.GetSent().CollectNamed("test.payments.foo.attempts"), ShouldHaveLength, 1)
+		})
+	})
+}
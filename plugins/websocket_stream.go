@@ -0,0 +1,68 @@
+package plugins
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/gorilla/websocket"
+)
+
+// websocketWriteWait is how long a single frame may take to reach a client before it is dropped.
+const websocketWriteWait = 10 * time.Second
+
+// NewWebSocketStreamHandler returns a server which upgrades each request to a WebSocket and pushes
+// the same dashboard metrics as the hystrix.StreamHandler, one JSON text message per event.
+func NewWebSocketStreamHandler() *WebSocketStreamHandler {
+	return &WebSocketStreamHandler{}
+}
+
+// WebSocketStreamHandler publishes metrics for each command and each pool once per interval to all
+// connected WebSocket clients. It subscribes its clients to the embedded hystrix.StreamHandler, so the
+// two transports always carry the same events. Start and Stop behave as they do on the StreamHandler.
+type WebSocketStreamHandler struct {
+	hystrix.StreamHandler
+
+	// Upgrader performs the WebSocket handshake. Set its CheckOrigin to accept cross-origin dashboards.
+	Upgrader websocket.Upgrader
+}
+
+var _ http.Handler = (*WebSocketStreamHandler)(nil)
+
+func (wh *WebSocketStreamHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	conn, err := wh.Upgrader.Upgrade(rw, req, nil)
+	if err != nil {
+		// the upgrader has already replied with an error
+		return
+	}
+	defer conn.Close()
+
+	events, unsubscribe := wh.Subscribe(req)
+	defer unsubscribe()
+
+	// Clients aren't expected to send anything, but reading is the only way to notice a close
+	// frame or a dropped connection.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-gone:
+			// client is gone
+			return
+		case event := <-events:
+			conn.SetWriteDeadline(time.Now().Add(websocketWriteWait))
+			err := conn.WriteMessage(websocket.TextMessage, event)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package plugins
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWebSocketStream(t *testing.T) {
+	Convey("given a running websocket stream", t, func() {
+		defer hystrix.Flush()
+
+		handler := NewWebSocketStreamHandler()
+		handler.Interval = 20 * time.Millisecond
+		handler.Start()
+		defer handler.Stop()
+		returned := make(chan struct{}, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			handler.ServeHTTP(rw, req)
+			returned <- struct{}{}
+		}))
+		defer server.Close()
+
+		hystrix.Do("websocket", func() error { return nil }, nil)
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		Convey("each message should be a command or pool metric without SSE framing", func() {
+			var event struct {
+				Type         string `json:"type"`
+				Name         string `json:"name"`
+				RequestCount int    `json:"requestCount"`
+			}
+			for event.Type != "HystrixCommand" {
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				messageType, message, err := conn.ReadMessage()
+				So(err, ShouldBeNil)
+				So(messageType, ShouldEqual, websocket.TextMessage)
+				So(json.Unmarshal(message, &event), ShouldBeNil)
+			}
+
+			So(event.Name, ShouldEqual, "websocket")
+			So(event.RequestCount, ShouldEqual, 1)
+		})
+
+		Convey("the handler should return once the client disconnects", func() {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, _, err := conn.ReadMessage()
+			So(err, ShouldBeNil)
+
+			conn.Close()
+			select {
+			case <-returned:
+			case <-time.After(time.Second):
+				t.Error("the handler kept serving a closed connection")
+			}
+		})
+	})
+}